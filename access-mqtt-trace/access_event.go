@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Field layout of the access grant/deny events seen on /event topics. The
+// event is either the whole payload or the payloads field of a Message
+// envelope.
+const (
+	accessFieldResult     = 1 // "ACCESS" / "BLOCKED" (string) or 1 / 0 (varint)
+	accessFieldActor      = 2 // user name
+	accessFieldCredential = 3 // "NFC", "PIN_CODE", "MOBILE_TAP", ...
+	accessFieldDoor       = 4 // door name
+	accessFieldTimestamp  = 5 // unix seconds or milliseconds (varint)
+)
+
+// accessEvent is a decoded access grant/deny event
+type accessEvent struct {
+	path       string // "path" meta of the envelope, if any
+	granted    bool
+	actor      string
+	credential string
+	door       string
+	timestamp  time.Time
+}
+
+// decodeAccessEvent decodes an access grant/deny event. It reports false when
+// the payload doesn't match the access event layout, so the caller can fall
+// back to the generic decoder.
+func decodeAccessEvent(data []byte) (string, bool) {
+	event, ok := parseAccessEvent(data)
+	if !ok {
+		return "", false
+	}
+
+	var result strings.Builder
+	if event.granted {
+		result.WriteString(fmt.Sprintf("  %sACCESS GRANTED%s", colorBold+colorGreen, colorReset))
+	} else {
+		result.WriteString(fmt.Sprintf("  %sACCESS DENIED%s", colorBold+colorRed, colorReset))
+	}
+	if event.path != "" {
+		result.WriteString(fmt.Sprintf(" %s%s%s", colorGray, event.path, colorReset))
+	}
+	result.WriteString("\n")
+
+	if event.actor != "" {
+		result.WriteString(fmt.Sprintf("  %-20s %s%s%s\n", "actor", colorYellow, event.actor, colorReset))
+	}
+	if event.credential != "" {
+		result.WriteString(fmt.Sprintf("  %-20s %s%s%s\n", "credential", colorCyan, event.credential, colorReset))
+	}
+	if event.door != "" {
+		result.WriteString(fmt.Sprintf("  %-20s %s%s%s\n", "door", colorPurple, event.door, colorReset))
+	}
+	if !event.timestamp.IsZero() {
+		result.WriteString(fmt.Sprintf("  %-20s %s%s%s\n", "timestamp", colorGray, event.timestamp.Format(time.RFC3339), colorReset))
+	}
+	return result.String(), true
+}
+
+// parseAccessEvent unwraps a Message envelope if present and parses the
+// access event fields
+func parseAccessEvent(data []byte) (accessEvent, bool) {
+	var event accessEvent
+	fields := parseProtobufFields(data)
+
+	// Message envelope: repeated meta (1) followed by the payload (2)
+	if path, inner, ok := unwrapEnvelope(fields); ok {
+		event.path = path
+		fields = parseProtobufFields(inner)
+	}
+
+	hasResult := false
+	for _, field := range fields {
+		value := string(field.Data)
+		switch field.FieldNumber {
+		case accessFieldResult:
+			granted, ok := parseAccessResult(field)
+			if !ok {
+				return event, false
+			}
+			event.granted = granted
+			hasResult = true
+		case accessFieldActor, accessFieldCredential, accessFieldDoor:
+			if field.WireType != 2 || !isPrintableBytes(field.Data) {
+				return event, false
+			}
+			switch field.FieldNumber {
+			case accessFieldActor:
+				event.actor = sanitizeString(value)
+			case accessFieldCredential:
+				event.credential = sanitizeString(value)
+			case accessFieldDoor:
+				event.door = sanitizeString(value)
+			}
+		case accessFieldTimestamp:
+			if field.WireType != 0 {
+				return event, false
+			}
+			secs, err := parseUint(value)
+			if err != nil {
+				return event, false
+			}
+			// Values this large are milliseconds
+			if secs > 1e12 {
+				event.timestamp = time.UnixMilli(int64(secs))
+			} else {
+				event.timestamp = time.Unix(int64(secs), 0)
+			}
+		default:
+			return event, false
+		}
+	}
+
+	if !hasResult || (event.actor == "" && event.door == "") {
+		return event, false
+	}
+	return event, true
+}
+
+// parseAccessResult reads the result field as a string or a boolean varint
+func parseAccessResult(field ProtobufField) (bool, bool) {
+	value := strings.ToUpper(string(field.Data))
+	switch field.WireType {
+	case 0:
+		switch value {
+		case "1":
+			return true, true
+		case "0":
+			return false, true
+		}
+	case 2:
+		switch value {
+		case "ACCESS", "GRANTED", "SUCCESS":
+			return true, true
+		case "BLOCKED", "DENIED", "FAILED", "INCOMPLETE":
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// unwrapEnvelope returns the path meta and inner payload of a Message
+// envelope. It reports false when the fields don't form an envelope.
+func unwrapEnvelope(fields []ProtobufField) (string, []byte, bool) {
+	var path string
+	var inner []byte
+	hasMeta := false
+	for _, field := range fields {
+		if field.WireType != 2 {
+			return "", nil, false
+		}
+		switch field.FieldNumber {
+		case 1:
+			key, value, ok := parseMetaData(field.Data)
+			if !ok {
+				return "", nil, false
+			}
+			if key == "path" {
+				path = value
+			}
+			hasMeta = true
+		case 2:
+			inner = field.Data
+		default:
+			return "", nil, false
+		}
+	}
+	if !hasMeta || len(inner) == 0 {
+		return "", nil, false
+	}
+	return path, inner, true
+}
+
+// parseMetaData parses a MetaData key/value pair
+func parseMetaData(data []byte) (string, string, bool) {
+	var key, value string
+	fields := parseProtobufFields(data)
+	if len(fields) != 2 {
+		return "", "", false
+	}
+	for _, field := range fields {
+		if field.WireType != 2 {
+			return "", "", false
+		}
+		switch field.FieldNumber {
+		case 1:
+			key = string(field.Data)
+		case 2:
+			value = string(field.Data)
+		default:
+			return "", "", false
+		}
+	}
+	return key, value, key != ""
+}
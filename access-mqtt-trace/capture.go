@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Capture file format: the magic header, followed by one record per message:
+//
+//	uint32 record length (bytes after this field)
+//	int64  receive time (Unix nanoseconds)
+//	uint16 topic length, topic bytes
+//	payload bytes (the rest of the record)
+//
+// All integers are big endian.
+const captureMagic = "AMQTRACE1\n"
+
+// captureWriter appends received messages to a capture file
+type captureWriter struct {
+	file *os.File
+	w    *bufio.Writer
+	mu   sync.Mutex
+}
+
+// createCapture creates (or truncates) a capture file
+func createCapture(path string) (*captureWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(file)
+	if _, err := w.WriteString(captureMagic); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &captureWriter{file: file, w: w}, nil
+}
+
+// Write appends one message. The record is flushed right away so a capture
+// stays usable when the tool is killed.
+func (c *captureWriter) Write(received time.Time, topic string, payload []byte) error {
+	if len(topic) > 0xFFFF {
+		return fmt.Errorf("topic too long: %d bytes", len(topic))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header := make([]byte, 4+8+2)
+	binary.BigEndian.PutUint32(header[0:], uint32(8+2+len(topic)+len(payload)))
+	binary.BigEndian.PutUint64(header[4:], uint64(received.UnixNano()))
+	binary.BigEndian.PutUint16(header[12:], uint16(len(topic)))
+
+	if _, err := c.w.Write(header); err != nil {
+		return err
+	}
+	if _, err := c.w.WriteString(topic); err != nil {
+		return err
+	}
+	if _, err := c.w.Write(payload); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// Close flushes and closes the capture file
+func (c *captureWriter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.w.Flush(); err != nil {
+		c.file.Close()
+		return err
+	}
+	return c.file.Close()
+}
+
+// captureRecord is one message read back from a capture file
+type captureRecord struct {
+	Received time.Time
+	Topic    string
+	Payload  []byte
+}
+
+// replayCapture reads a capture file and calls fn for each record in order
+func replayCapture(path string, fn func(captureRecord)) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	magic := make([]byte, len(captureMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != captureMagic {
+		return 0, fmt.Errorf("%s is not a capture file", path)
+	}
+
+	count := 0
+	for {
+		var length uint32
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			if errors.Is(err, io.EOF) {
+				return count, nil
+			}
+			return count, err
+		}
+		if length < 8+2 {
+			return count, fmt.Errorf("record %d: invalid length %d", count+1, length)
+		}
+
+		record := make([]byte, length)
+		if _, err := io.ReadFull(r, record); err != nil {
+			return count, fmt.Errorf("record %d: truncated: %w", count+1, err)
+		}
+
+		topicLen := int(binary.BigEndian.Uint16(record[8:]))
+		if 10+topicLen > len(record) {
+			return count, fmt.Errorf("record %d: invalid topic length %d", count+1, topicLen)
+		}
+
+		fn(captureRecord{
+			Received: time.Unix(0, int64(binary.BigEndian.Uint64(record[0:]))),
+			Topic:    string(record[10 : 10+topicLen]),
+			Payload:  record[10+topicLen:],
+		})
+		count++
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// topicMessageTypes maps topic segments to the message type of their payload
+var topicMessageTypes = []struct {
+	segment     string
+	messageType string
+}{
+	{"/stat", "StatMessage"},
+	{"/rpc", "Message"},
+	{"/event", "Message"},
+}
+
+// rpcPayloadTypes maps the "path" meta of a Message envelope to the message
+// type of its inner payload
+var rpcPayloadTypes = map[string]string{
+	"/remote_view":          "DARemoteView",
+	"/remote_open_door":     "DARemoteOpenDoor",
+	"/third_party_sip_call": "ThirdPartySipCallRequest",
+}
+
+// descriptors holds the message types loaded with -descriptor (nil = heuristic decoding only)
+var descriptors *protoregistry.Files
+
+// loadDescriptors loads a compiled FileDescriptorSet, e.g. created with
+// protoc --include_imports --descriptor_set_out=unifi_access.pb proto/unifi_access.proto
+func loadDescriptors(path string) (*protoregistry.Files, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("not a FileDescriptorSet: %w", err)
+	}
+	return protodesc.NewFiles(&set)
+}
+
+// findMessageType looks up a message by full or short name
+func findMessageType(files *protoregistry.Files, name string) protoreflect.MessageDescriptor {
+	if d, err := files.FindDescriptorByName(protoreflect.FullName(name)); err == nil {
+		if md, ok := d.(protoreflect.MessageDescriptor); ok {
+			return md
+		}
+	}
+
+	var found protoreflect.MessageDescriptor
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		found = findInMessages(fd.Messages(), protoreflect.Name(name))
+		return found == nil
+	})
+	return found
+}
+
+// findInMessages searches messages and their nested messages by short name
+func findInMessages(messages protoreflect.MessageDescriptors, name protoreflect.Name) protoreflect.MessageDescriptor {
+	for i := 0; i < messages.Len(); i++ {
+		md := messages.Get(i)
+		if md.Name() == name {
+			return md
+		}
+		if nested := findInMessages(md.Messages(), name); nested != nil {
+			return nested
+		}
+	}
+	return nil
+}
+
+// decodeMessage decodes data as the given type. Payloads with fields the
+// type doesn't know are rejected, as they most likely are a different message.
+func decodeMessage(md protoreflect.MessageDescriptor, data []byte) (*dynamicpb.Message, bool) {
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, false
+	}
+	if hasUnknownFields(msg) {
+		return nil, false
+	}
+	return msg, true
+}
+
+// hasUnknownFields reports whether a message or any nested message has unknown fields
+func hasUnknownFields(msg protoreflect.Message) bool {
+	if len(msg.GetUnknown()) > 0 {
+		return true
+	}
+	unknown := false
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Message() == nil || fd.IsMap() {
+			return true
+		}
+		if fd.IsList() {
+			list := v.List()
+			for i := 0; i < list.Len() && !unknown; i++ {
+				unknown = hasUnknownFields(list.Get(i).Message())
+			}
+		} else {
+			unknown = hasUnknownFields(v.Message())
+		}
+		return !unknown
+	})
+	return unknown
+}
+
+// decodeWithDescriptor decodes a payload with the message type its topic maps
+// to. Returns false when no type is known or the payload doesn't match it.
+func decodeWithDescriptor(topic string, data []byte) (string, bool) {
+	if descriptors == nil || len(data) == 0 {
+		return "", false
+	}
+
+	typeName := ""
+	for _, t := range topicMessageTypes {
+		if strings.Contains(topic, t.segment) {
+			typeName = t.messageType
+			break
+		}
+	}
+	if typeName == "" {
+		return "", false
+	}
+
+	md := findMessageType(descriptors, typeName)
+	if md == nil {
+		return "", false
+	}
+	msg, ok := decodeMessage(md, data)
+	if !ok {
+		return "", false
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("  %s%s%s\n", colorGreen, md.FullName(), colorReset))
+	result.WriteString(formatMessage(msg))
+
+	// Decode the inner payload of RPC envelopes by their path
+	if inner, innerType := decodeRPCPayload(msg); inner != nil {
+		result.WriteString(fmt.Sprintf("  %spayloads as %s%s\n", colorGreen, innerType, colorReset))
+		result.WriteString(formatMessage(inner))
+	}
+	return result.String(), true
+}
+
+// decodeRPCPayload decodes the "payloads" field of a Message envelope using
+// the type registered for its "path" meta
+func decodeRPCPayload(msg *dynamicpb.Message) (*dynamicpb.Message, protoreflect.FullName) {
+	fields := msg.Descriptor().Fields()
+	metaField := fields.ByName("meta")
+	payloadField := fields.ByName("payloads")
+	if metaField == nil || payloadField == nil || !metaField.IsList() || metaField.Message() == nil {
+		return nil, ""
+	}
+
+	path := ""
+	meta := msg.Get(metaField).List()
+	for i := 0; i < meta.Len(); i++ {
+		entry := meta.Get(i).Message()
+		keyField := entry.Descriptor().Fields().ByName("key")
+		valueField := entry.Descriptor().Fields().ByName("value")
+		if keyField != nil && valueField != nil && entry.Get(keyField).String() == "path" {
+			path = entry.Get(valueField).String()
+		}
+	}
+
+	typeName, ok := rpcPayloadTypes[path]
+	if !ok {
+		return nil, ""
+	}
+	md := findMessageType(descriptors, typeName)
+	if md == nil {
+		return nil, ""
+	}
+	inner, ok := decodeMessage(md, msg.Get(payloadField).Bytes())
+	if !ok {
+		return nil, ""
+	}
+	return inner, md.FullName()
+}
+
+// formatMessage renders a message in text format with its field names
+func formatMessage(msg proto.Message) string {
+	text := prototext.MarshalOptions{Multiline: true, Indent: "  "}.Format(msg)
+
+	var result strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if line != "" {
+			result.WriteString("  " + line + "\n")
+		}
+	}
+	return result.String()
+}
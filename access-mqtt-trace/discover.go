@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// discoveredDevice is a device seen during -discover
+type discoveredDevice struct {
+	id         string
+	controller string // controller ID from the topic, if any
+	model      string
+	name       string
+	mac        string
+	lastSeen   time.Time
+}
+
+// discovery collects the topics and devices seen during -discover
+type discovery struct {
+	mu          sync.Mutex
+	topics      map[string]int // messages per topic
+	controllers map[string]bool
+	devices     map[string]*discoveredDevice
+}
+
+func newDiscovery() *discovery {
+	return &discovery{
+		topics:      make(map[string]int),
+		controllers: make(map[string]bool),
+		devices:     make(map[string]*discoveredDevice),
+	}
+}
+
+// record takes note of a message. Controller and device IDs come from the
+// topic (/uctrl/{controller}/device/{device}/...); model, name and MAC from
+// the DeviceStat payload of /stat topics.
+func (d *discovery) record(topicStr string, payload []byte, received time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.topics[topicStr]++
+
+	controller, deviceID := topicIDs(topicStr)
+	if controller != "" {
+		d.controllers[controller] = true
+	}
+
+	var stat deviceStat
+	if strings.Contains(topicStr, "/stat") {
+		stat, _ = parseDeviceStat(payload)
+	}
+	if deviceID == "" {
+		deviceID = stat.id
+	}
+	if deviceID == "" {
+		return
+	}
+
+	device := d.devices[deviceID]
+	if device == nil {
+		device = &discoveredDevice{id: deviceID}
+		d.devices[deviceID] = device
+	}
+	if controller != "" {
+		device.controller = controller
+	}
+	if stat.model != "" {
+		device.model = stat.model
+	}
+	if stat.name != "" {
+		device.name = stat.name
+	} else if name := stat.attr("name"); name != "" {
+		device.name = name
+	}
+	if mac := stat.attr("mac"); mac != "" {
+		device.mac = mac
+	}
+	if received.After(device.lastSeen) {
+		device.lastSeen = received
+	}
+}
+
+// topicIDs returns the controller and device ID of a
+// /uctrl/{controller}/device/{device}/... topic
+func topicIDs(topicStr string) (string, string) {
+	parts := strings.Split(strings.TrimPrefix(topicStr, "/"), "/")
+	if len(parts) < 2 || parts[0] != "uctrl" {
+		return "", ""
+	}
+	controller := parts[1]
+	if len(parts) >= 4 && parts[2] == "device" {
+		return controller, parts[3]
+	}
+	return controller, ""
+}
+
+// printSummary prints the topics, controllers and devices, sorted
+func (d *discovery) printSummary() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	fmt.Printf("\n%s[TOPICS]%s %d\n", colorCyan, colorReset, len(d.topics))
+	topics := make([]string, 0, len(d.topics))
+	for t := range d.topics {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, t := range topics {
+		fmt.Fprintf(w, "  %s\t%d\n", t, d.topics[t])
+	}
+	w.Flush()
+
+	fmt.Printf("\n%s[CONTROLLERS]%s %d\n", colorCyan, colorReset, len(d.controllers))
+	controllers := make([]string, 0, len(d.controllers))
+	for c := range d.controllers {
+		controllers = append(controllers, c)
+	}
+	sort.Strings(controllers)
+	for _, c := range controllers {
+		fmt.Printf("  %s\n", c)
+	}
+
+	fmt.Printf("\n%s[DEVICES]%s %d\n", colorCyan, colorReset, len(d.devices))
+	devices := make([]*discoveredDevice, 0, len(d.devices))
+	for _, device := range d.devices {
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].id < devices[j].id })
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  ID\tMODEL\tNAME\tMAC\tCONTROLLER\tLAST SEEN")
+	for _, device := range devices {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\n",
+			device.id, orDash(device.model), orDash(device.name), orDash(device.mac),
+			orDash(device.controller), device.lastSeen.Format("15:04:05"))
+	}
+	w.Flush()
+}
+
+// orDash returns s, or "-" when it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -1,8 +1,11 @@
 module github.com/philipparndt/unifi-access/access-mqtt-trace
 
-go 1.21
+go 1.23
 
-require github.com/eclipse/paho.mqtt.golang v1.5.0
+require (
+	github.com/eclipse/paho.mqtt.golang v1.5.0
+	google.golang.org/protobuf v1.36.12
+)
 
 require (
 	github.com/gorilla/websocket v1.5.3 // indirect
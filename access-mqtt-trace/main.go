@@ -12,6 +12,7 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -19,20 +20,45 @@ import (
 )
 
 var (
-	broker   = flag.String("broker", "", "MQTT broker address (e.g., 10.1.0.1)")
-	port     = flag.Int("port", 12812, "MQTT broker port")
-	caFile   = flag.String("ca", "ca-cert.pem", "CA certificate file")
-	certFile = flag.String("cert", "mqtt-client-cert.pem", "Client certificate file")
-	keyFile  = flag.String("key", "mqtt-client-priv.pem", "Client private key file")
-	topic    = flag.String("topic", "#", "MQTT topic to subscribe to")
-	verbose  = flag.Bool("v", false, "Verbose output (show hex dump)")
-	rawMode  = flag.Bool("raw", false, "Raw mode (no decoding)")
+	broker         = flag.String("broker", "", "MQTT broker address (e.g., 10.1.0.1)")
+	port           = flag.Int("port", 12812, "MQTT broker port")
+	caFile         = flag.String("ca", "ca-cert.pem", "CA certificate file")
+	certFile       = flag.String("cert", "mqtt-client-cert.pem", "Client certificate file")
+	keyFile        = flag.String("key", "mqtt-client-priv.pem", "Client private key file")
+	verifySSL      = flag.Bool("verify-ssl", false, "Verify the broker certificate against -ca (off by default: the certificate usually doesn't match the broker address)")
+	topic          = flag.String("topic", "#", "MQTT topic to subscribe to")
+	verbose        = flag.Bool("v", false, "Verbose output (show hex dump)")
+	rawMode        = flag.Bool("raw", false, "Raw mode (no decoding)")
+	packed         = flag.Bool("packed", true, "Show binary length-delimited fields that decode cleanly as packed varints as a list of values")
+	descriptorFile = flag.String("descriptor", "", "Compiled FileDescriptorSet (protoc --descriptor_set_out) used to decode payloads with real field names")
+	depth          = flag.Int("depth", 0, "Decode length-delimited fields that parse cleanly as protobuf up to this many levels deep and show them as an indented tree")
+
+	// Connection flags
+	keepAlive    = flag.Duration("keepalive", 30*time.Second, "MQTT keep-alive interval (keeps long idle traces alive behind NAT)")
+	cleanSession = flag.Bool("clean-session", true, "Start with a clean MQTT session")
+	qos          = flag.Int("qos", 0, "QoS of the subscription (0, 1 or 2)")
+	clientIDFlag = flag.String("clientid", "", "MQTT client ID (default: mqtt-trace-<time>); set it with -clean=false to resume a persistent session")
+
+	// Capture flags
+	saveFile   = flag.String("save", "", "Also write every received message to this capture file")
+	replayFile = flag.String("replay", "", "Decode the messages of a capture file instead of connecting to a broker")
+
+	// Discovery flags
+	discover    = flag.Bool("discover", false, "Collect topics and devices instead of printing messages, then print a summary")
+	discoverFor = flag.Duration("discover-duration", 30*time.Second, "How long -discover listens before printing the summary")
+
+	// Watch flags
+	watch         = flag.Bool("watch", false, "Track heartbeats per topic and warn about missed ones instead of printing messages")
+	watchInterval = flag.Duration("watch-interval", 0, "Expected heartbeat interval for -watch (default: learned per topic from the observed cadence)")
 
 	// RPC command flags
 	sendRPC      = flag.String("rpc", "", "Send RPC command: remote_view, remote_open_door")
 	controllerID = flag.String("controller", "", "Controller ID (MAC without colons, e.g., 28704e275599)")
 	viewerID     = flag.String("viewer", "", "Viewer device ID (MAC without colons)")
 	readerID     = flag.String("reader", "", "Reader device ID (for remote_view source)")
+	rpcTimeout   = flag.Duration("timeout", 10*time.Second, "How long -rpc waits for the response before exiting with status 1")
+
+	connectTimeout = flag.Duration("connect-timeout", 30*time.Second, "How long to wait for the initial broker connection (0 = retry forever)")
 )
 
 // ANSI colors for terminal output
@@ -48,9 +74,74 @@ const (
 	colorBold   = "\033[1m"
 )
 
+// capture receives a copy of every message when -save is set
+var capture *captureWriter
+
+// discovered collects topics and devices when -discover is set
+var discovered *discovery
+
+// watched tracks heartbeats when -watch is set
+var watched *watcher
+
+// rpcResponded is closed when the response to -rpc arrives
+var (
+	rpcResponded     = make(chan struct{})
+	rpcRespondedOnce sync.Once
+)
+
+// signed holds the varint fields rendered as signed values (-signed)
+var signed = signedFields{}
+
+func init() {
+	flag.BoolVar(cleanSession, "clean", true, "Alias for -clean-session")
+	flag.Var(signed, "signed", "Also show varint fields as signed values, e.g. 3=sint,7=int (repeatable)")
+}
+
 func main() {
 	flag.Parse()
 
+	if *descriptorFile != "" {
+		var err error
+		if descriptors, err = loadDescriptors(*descriptorFile); err != nil {
+			log.Fatalf("Failed to load descriptor: %v", err)
+		}
+	}
+
+	if *discover && *watch {
+		log.Fatal("-discover and -watch can't be combined")
+	}
+	if *discover {
+		discovered = newDiscovery()
+	}
+	if *watch {
+		watched = newWatcher(*watchInterval)
+	}
+
+	if *replayFile != "" {
+		count, err := replayCapture(*replayFile, func(r captureRecord) {
+			if discovered != nil {
+				discovered.record(r.Topic, r.Payload, r.Received)
+				return
+			}
+			if watched != nil {
+				watched.record(r.Topic, r.Payload, r.Received)
+				return
+			}
+			printMessage(r.Topic, r.Payload, r.Received)
+		})
+		if err != nil {
+			log.Fatalf("Failed to replay %s: %v", *replayFile, err)
+		}
+		fmt.Printf("\n%s[REPLAYED]%s %d messages from %s\n", colorGreen, colorReset, count, *replayFile)
+		if discovered != nil {
+			discovered.printSummary()
+		}
+		if watched != nil {
+			watched.printSummary()
+		}
+		return
+	}
+
 	if *broker == "" {
 		log.Fatal("Broker address is required. Use -broker flag.")
 	}
@@ -60,11 +151,33 @@ func main() {
 		log.Fatalf("Failed to create TLS config: %v", err)
 	}
 
-	clientID := fmt.Sprintf("mqtt-trace-%d", time.Now().UnixNano())
+	if *saveFile != "" {
+		capture, err = createCapture(*saveFile)
+		if err != nil {
+			log.Fatalf("Failed to create capture file: %v", err)
+		}
+		defer capture.Close()
+		fmt.Printf("%s[SAVING]%s messages to %s\n", colorCyan, colorReset, *saveFile)
+	}
+
+	if *qos < 0 || *qos > 2 {
+		log.Fatalf("Invalid -qos %d: must be 0, 1 or 2", *qos)
+	}
+
+	clientID := *clientIDFlag
+	if clientID == "" {
+		clientID = fmt.Sprintf("mqtt-trace-%d", time.Now().UnixNano())
+		if !*cleanSession {
+			fmt.Printf("%s[WARNING]%s persistent session with a generated client ID; use -clientid to resume it later\n", colorYellow, colorReset)
+		}
+	}
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(fmt.Sprintf("ssl://%s:%d", *broker, *port))
 	opts.SetClientID(clientID)
 	opts.SetTLSConfig(tlsConfig)
+	opts.SetKeepAlive(*keepAlive)
+	opts.SetPingTimeout(10 * time.Second)
+	opts.SetCleanSession(*cleanSession)
 	opts.SetAutoReconnect(true)
 	opts.SetConnectRetry(true)
 	opts.SetConnectRetryInterval(5 * time.Second)
@@ -78,12 +191,12 @@ func main() {
 			return
 		}
 
-		token := c.Subscribe(*topic, 0, messageHandler)
+		token := c.Subscribe(*topic, byte(*qos), messageHandler)
 		token.Wait()
 		if token.Error() != nil {
 			log.Printf("Subscribe error: %v", token.Error())
 		} else {
-			fmt.Printf("%s[SUBSCRIBED]%s to topic: %s\n", colorCyan, colorReset, *topic)
+			fmt.Printf("%s[SUBSCRIBED]%s to topic: %s (QoS %d)\n", colorCyan, colorReset, *topic, *qos)
 		}
 	})
 
@@ -92,24 +205,59 @@ func main() {
 	})
 
 	client := mqtt.NewClient(opts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
+	token := client.Connect()
+	if *connectTimeout > 0 {
+		if !token.WaitTimeout(*connectTimeout) {
+			log.Fatalf("Failed to connect to %s:%d within %s", *broker, *port, *connectTimeout)
+		}
+	} else {
+		token.Wait()
+	}
+	if token.Error() != nil {
 		log.Fatalf("Failed to connect: %v", token.Error())
 	}
 
-	// If RPC mode, wait a bit for response then exit
+	// If RPC mode, exit once the response arrived or the timeout passed
 	if *sendRPC != "" {
-		time.Sleep(3 * time.Second)
-		client.Disconnect(250)
+		select {
+		case <-rpcResponded:
+			client.Disconnect(250)
+		case <-time.After(*rpcTimeout):
+			fmt.Printf("%s[TIMEOUT]%s no RPC response within %s\n", colorRed, colorReset, *rpcTimeout)
+			client.Disconnect(250)
+			os.Exit(1)
+		}
 		return
 	}
 
-	// Wait for interrupt signal
+	// Wait for interrupt signal, or the end of discovery
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	if discovered != nil {
+		fmt.Printf("%s[DISCOVERING]%s for %s (Ctrl+C to stop early)\n", colorCyan, colorReset, *discoverFor)
+		select {
+		case <-sigChan:
+		case <-time.After(*discoverFor):
+		}
+	} else if watched != nil {
+		fmt.Printf("%s[WATCHING]%s heartbeats (Ctrl+C to stop)\n", colorCyan, colorReset)
+		stop := make(chan struct{})
+		go watched.check(stop)
+		<-sigChan
+		close(stop)
+	} else {
+		<-sigChan
+	}
 
 	fmt.Println("\nDisconnecting...")
 	client.Disconnect(250)
+
+	if discovered != nil {
+		discovered.printSummary()
+	}
+	if watched != nil {
+		watched.printSummary()
+	}
 }
 
 // sendRPCCommand sends an RPC command to a device
@@ -126,6 +274,7 @@ func sendRPCCommand(client mqtt.Client, clientID string) {
 	token := client.Subscribe(responseTopic, 0, func(c mqtt.Client, msg mqtt.Message) {
 		fmt.Printf("\n%s[RPC RESPONSE]%s on %s\n", colorGreen, colorReset, msg.Topic())
 		decodeRPCResponse(msg.Payload())
+		rpcRespondedOnce.Do(func() { close(rpcResponded) })
 	})
 	token.Wait()
 	if token.Error() != nil {
@@ -339,21 +488,39 @@ func newTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
 	return &tls.Config{
 		RootCAs:            caCertPool,
 		Certificates:       []tls.Certificate{cert},
-		InsecureSkipVerify: true,
+		InsecureSkipVerify: !*verifySSL,
 		MinVersion:         tls.VersionTLS12,
 	}, nil
 }
 
 func messageHandler(client mqtt.Client, msg mqtt.Message) {
-	topicStr := msg.Topic()
-	payload := msg.Payload()
-	timestamp := time.Now().Format("15:04:05.000")
+	received := time.Now()
+	if capture != nil {
+		if err := capture.Write(received, msg.Topic(), msg.Payload()); err != nil {
+			log.Printf("Capture error: %v", err)
+		}
+	}
+	if discovered != nil {
+		discovered.record(msg.Topic(), msg.Payload(), received)
+		return
+	}
+	if watched != nil {
+		watched.record(msg.Topic(), msg.Payload(), received)
+		return
+	}
+	printMessage(msg.Topic(), msg.Payload(), received)
+}
+
+// printMessage decodes and prints a message, live or replayed from a capture
+func printMessage(topicStr string, payload []byte, received time.Time) {
+	timestamp := received.Format("15:04:05.000")
 
 	// Determine topic type for coloring
 	topicColor := colorBlue
 	isHeartbeat := strings.Contains(topicStr, "/heart")
 	isStat := strings.Contains(topicStr, "/stat")
 	isRPC := strings.Contains(topicStr, "/rpc")
+	isEvent := strings.Contains(topicStr, "/event")
 
 	if isHeartbeat {
 		topicColor = colorGray
@@ -361,7 +528,7 @@ func messageHandler(client mqtt.Client, msg mqtt.Message) {
 		topicColor = colorCyan
 	} else if isRPC {
 		topicColor = colorYellow
-	} else if strings.Contains(topicStr, "/event") {
+	} else if isEvent {
 		topicColor = colorPurple
 	}
 
@@ -375,16 +542,25 @@ func messageHandler(client mqtt.Client, msg mqtt.Message) {
 		return
 	}
 
-	// Decode based on topic type
-	var decoded string
-	if isHeartbeat {
-		decoded = decodeHeartbeat(payload)
-	} else if isStat {
-		decoded = decodeDeviceStat(payload)
-	} else if isRPC {
-		decoded = decodeRPC(payload)
-	} else {
-		decoded = decodeGenericProtobuf(payload)
+	// Decode based on topic type, preferring the descriptor when one is loaded
+	decoded, ok := decodeWithDescriptor(topicStr, payload)
+	if !ok {
+		switch {
+		case isHeartbeat:
+			decoded = decodeHeartbeat(payload)
+		case isStat:
+			decoded = decodeDeviceStat(payload)
+		case isRPC:
+			decoded = decodeRPC(payload)
+		case isEvent:
+			if access, ok := decodeAccessEvent(payload); ok {
+				decoded = access
+			} else {
+				decoded = decodeGenericProtobuf(payload)
+			}
+		default:
+			decoded = decodeGenericProtobuf(payload)
+		}
 	}
 
 	fmt.Print(decoded)
@@ -428,50 +604,23 @@ func decodeDeviceStat(data []byte) string {
 
 	var result strings.Builder
 
-	// Skip outer wrapper if present (field 2 = 0x12, length-delimited)
-	innerData := data
-	if len(data) > 3 && data[0] == 0x12 {
-		length, bytesRead := decodeVarint(data[1:])
-		if bytesRead > 0 && int(length)+bytesRead+1 <= len(data) {
-			innerData = data[1+bytesRead : 1+bytesRead+int(length)]
-		}
-	}
-
-	// Parse the DeviceStat protobuf fields
-	fields := parseProtobufFields(innerData)
-	if len(fields) == 0 {
+	stat, ok := parseDeviceStat(data)
+	if !ok {
 		return formatHexClean(data)
 	}
 
-	// Extract known fields
-	var deviceID, model, deviceName string
-	var attrs []string
-
-	for _, field := range fields {
-		switch field.FieldNumber {
-		case 1: // id
-			deviceID = sanitizeString(string(field.Data))
-		case 2: // model
-			model = sanitizeString(string(field.Data))
-		case 3: // name
-			deviceName = sanitizeString(string(field.Data))
-		case 4: // attrs (repeated)
-			attrs = append(attrs, sanitizeString(string(field.Data)))
-		}
-	}
-
 	// Print header line
-	if model != "" || deviceName != "" {
+	if stat.model != "" || stat.name != "" {
 		result.WriteString(fmt.Sprintf("  %s%s%s %s%s%s\n",
-			colorBold+colorCyan, model, colorReset,
-			colorGreen, deviceName, colorReset))
+			colorBold+colorCyan, stat.model, colorReset,
+			colorGreen, stat.name, colorReset))
 	}
-	if deviceID != "" {
-		result.WriteString(fmt.Sprintf("  %sDevice ID:%s %s\n", colorGray, colorReset, deviceID))
+	if stat.id != "" {
+		result.WriteString(fmt.Sprintf("  %sDevice ID:%s %s\n", colorGray, colorReset, stat.id))
 	}
 
 	// Print attributes
-	for _, attr := range attrs {
+	for _, attr := range stat.attrs {
 		if attr == "" {
 			continue
 		}
@@ -516,6 +665,58 @@ func decodeDeviceStat(data []byte) string {
 	return result.String()
 }
 
+// deviceStat holds the known fields of a DeviceStat message
+type deviceStat struct {
+	id    string
+	model string
+	name  string
+	attrs []string // "key=value" pairs
+}
+
+// parseDeviceStat parses a DeviceStat message, unwrapping the outer wrapper
+// when present. It reports false when the payload has no protobuf fields.
+func parseDeviceStat(data []byte) (deviceStat, bool) {
+	var stat deviceStat
+
+	// Skip outer wrapper if present (field 2 = 0x12, length-delimited)
+	innerData := data
+	if len(data) > 3 && data[0] == 0x12 {
+		length, bytesRead := decodeVarint(data[1:])
+		if bytesRead > 0 && int(length)+bytesRead+1 <= len(data) {
+			innerData = data[1+bytesRead : 1+bytesRead+int(length)]
+		}
+	}
+
+	fields := parseProtobufFields(innerData)
+	if len(fields) == 0 {
+		return stat, false
+	}
+
+	for _, field := range fields {
+		switch field.FieldNumber {
+		case 1: // id
+			stat.id = sanitizeString(string(field.Data))
+		case 2: // model
+			stat.model = sanitizeString(string(field.Data))
+		case 3: // name
+			stat.name = sanitizeString(string(field.Data))
+		case 4: // attrs (repeated)
+			stat.attrs = append(stat.attrs, sanitizeString(string(field.Data)))
+		}
+	}
+	return stat, true
+}
+
+// attr returns the value of a "key=value" attribute, or ""
+func (s deviceStat) attr(key string) string {
+	for _, attr := range s.attrs {
+		if k, v, ok := strings.Cut(attr, "="); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
+
 // decodeRPC decodes an RPC message
 func decodeRPC(data []byte) string {
 	if len(data) == 0 {
@@ -531,7 +732,12 @@ func decodeRPC(data []byte) string {
 	result.WriteString(fmt.Sprintf("  %sRPC Message%s\n", colorYellow, colorReset))
 
 	for _, field := range fields {
-		value := sanitizeString(string(field.Data))
+		if nested, ok := nestedFields(field, *depth); ok {
+			result.WriteString(fmt.Sprintf("  field_%d:\n", field.FieldNumber))
+			result.WriteString(formatFieldTree(nested, 1, *depth-1))
+			continue
+		}
+		value := formatFieldValue(field)
 		if value != "" {
 			result.WriteString(fmt.Sprintf("  field_%d: %s\n", field.FieldNumber, value))
 		}
@@ -558,7 +764,12 @@ func decodeGenericProtobuf(data []byte) string {
 
 	var result strings.Builder
 	for _, field := range fields {
-		value := sanitizeString(string(field.Data))
+		if nested, ok := nestedFields(field, *depth); ok {
+			result.WriteString(fmt.Sprintf("  field_%d:\n", field.FieldNumber))
+			result.WriteString(formatFieldTree(nested, 1, *depth-1))
+			continue
+		}
+		value := formatFieldValue(field)
 		if value == "" {
 			continue
 		}
@@ -590,6 +801,13 @@ type ProtobufField struct {
 
 // parseProtobufFields parses protobuf wire format
 func parseProtobufFields(data []byte) []ProtobufField {
+	fields, _ := parseProtobufMessage(data)
+	return fields
+}
+
+// parseProtobufMessage parses protobuf wire format. It reports whether the
+// whole payload was consumed by well-formed fields.
+func parseProtobufMessage(data []byte) ([]ProtobufField, bool) {
 	var fields []ProtobufField
 	offset := 0
 
@@ -597,7 +815,7 @@ func parseProtobufFields(data []byte) []ProtobufField {
 		// Read tag (varint)
 		tag, bytesRead := decodeVarint(data[offset:])
 		if bytesRead == 0 {
-			break
+			return fields, false
 		}
 		offset += bytesRead
 
@@ -606,7 +824,7 @@ func parseProtobufFields(data []byte) []ProtobufField {
 
 		// Validate field number (should be 1-536870911 per protobuf spec, but we limit to reasonable values)
 		if fieldNumber == 0 || fieldNumber > 100 {
-			break
+			return fields, false
 		}
 
 		var fieldData []byte
@@ -615,14 +833,14 @@ func parseProtobufFields(data []byte) []ProtobufField {
 		case 0: // Varint
 			val, n := decodeVarint(data[offset:])
 			if n == 0 {
-				return fields
+				return fields, false
 			}
 			offset += n
 			fieldData = []byte(fmt.Sprintf("%d", val))
 
 		case 1: // 64-bit fixed
 			if offset+8 > len(data) {
-				return fields
+				return fields, false
 			}
 			val := binary.LittleEndian.Uint64(data[offset : offset+8])
 			fieldData = []byte(fmt.Sprintf("%d", val))
@@ -631,18 +849,18 @@ func parseProtobufFields(data []byte) []ProtobufField {
 		case 2: // Length-delimited
 			length, n := decodeVarint(data[offset:])
 			if n == 0 || length > 10000 { // Sanity check on length
-				return fields
+				return fields, false
 			}
 			offset += n
 			if offset+int(length) > len(data) {
-				return fields
+				return fields, false
 			}
 			fieldData = data[offset : offset+int(length)]
 			offset += int(length)
 
 		case 5: // 32-bit fixed
 			if offset+4 > len(data) {
-				return fields
+				return fields, false
 			}
 			val := binary.LittleEndian.Uint32(data[offset : offset+4])
 			fieldData = []byte(fmt.Sprintf("%d", val))
@@ -650,7 +868,7 @@ func parseProtobufFields(data []byte) []ProtobufField {
 
 		default:
 			// Unknown wire type
-			return fields
+			return fields, false
 		}
 
 		fields = append(fields, ProtobufField{
@@ -660,7 +878,46 @@ func parseProtobufFields(data []byte) []ProtobufField {
 		})
 	}
 
-	return fields
+	return fields, true
+}
+
+// formatFieldValue renders a field value for display. Varints get their signed
+// value where applicable, and binary length-delimited fields that decode
+// cleanly as packed varints are shown as a list.
+func formatFieldValue(field ProtobufField) string {
+	if field.WireType == 0 {
+		if v, err := parseUint(string(field.Data)); err == nil {
+			return formatVarint(field.FieldNumber, v)
+		}
+	}
+	if *packed && field.WireType == 2 && !isPrintableBytes(field.Data) {
+		if values, ok := decodePackedVarints(field.Data); ok {
+			strs := make([]string, len(values))
+			for i, v := range values {
+				strs[i] = fmt.Sprintf("%d", v)
+			}
+			return "[" + strings.Join(strs, ", ") + "]"
+		}
+	}
+	return sanitizeString(string(field.Data))
+}
+
+// decodePackedVarints decodes a packed repeated varint field. It only
+// succeeds when the whole payload is consumed by well-formed varints.
+func decodePackedVarints(data []byte) ([]uint64, bool) {
+	if len(data) == 0 {
+		return nil, false
+	}
+	var values []uint64
+	for offset := 0; offset < len(data); {
+		val, n := decodeVarint(data[offset:])
+		if n == 0 {
+			return nil, false
+		}
+		values = append(values, val)
+		offset += n
+	}
+	return values, true
 }
 
 // decodeVarint decodes a protobuf varint
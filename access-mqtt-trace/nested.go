@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// nestedFields decodes a length-delimited field as a nested message when
+// levels (from -depth) allows descending. Text is left alone, and the payload
+// must parse as protobuf without leftover bytes, so random binary data isn't
+// mistaken for a message.
+func nestedFields(field ProtobufField, levels int) ([]ProtobufField, bool) {
+	if levels <= 0 || field.WireType != 2 || isPrintableBytes(field.Data) {
+		return nil, false
+	}
+	fields, ok := parseProtobufMessage(field.Data)
+	if !ok || len(fields) == 0 {
+		return nil, false
+	}
+	return fields, true
+}
+
+// formatFieldTree renders the fields of a nested message indented by level,
+// descending at most levels further
+func formatFieldTree(fields []ProtobufField, level, levels int) string {
+	indent := "  " + strings.Repeat("  ", level)
+
+	var result strings.Builder
+	for _, field := range fields {
+		if nested, ok := nestedFields(field, levels); ok {
+			result.WriteString(fmt.Sprintf("%sfield_%d:\n", indent, field.FieldNumber))
+			result.WriteString(formatFieldTree(nested, level+1, levels-1))
+			continue
+		}
+		if value := formatFieldValue(field); value != "" {
+			result.WriteString(fmt.Sprintf("%sfield_%d: %s\n", indent, field.FieldNumber, value))
+		}
+	}
+	return result.String()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Signed interpretations of a varint field
+const (
+	signedInt  = "int"  // int32/int64: two's complement
+	signedSint = "sint" // sint32/sint64: zigzag encoded
+)
+
+// smallNegative bounds the two's complement values that are shown as a
+// negative int without being configured via -signed
+const smallNegative = -1 << 31
+
+// signedFields maps field numbers to the signed interpretation requested via
+// -signed
+type signedFields map[int]string
+
+func (s signedFields) String() string {
+	numbers := make([]int, 0, len(s))
+	for number := range s {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	parts := make([]string, len(numbers))
+	for i, number := range numbers {
+		parts[i] = fmt.Sprintf("%d=%s", number, s[number])
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set parses a comma-separated list of field=int|sint; the flag can be
+// repeated
+func (s signedFields) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		number, kind, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return fmt.Errorf("invalid %q, expected field=int or field=sint", part)
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid field number %q", number)
+		}
+		if kind != signedInt && kind != signedSint {
+			return fmt.Errorf("invalid type %q for field %d, expected int or sint", kind, n)
+		}
+		s[n] = kind
+	}
+	return nil
+}
+
+// zigzagDecode decodes a zigzag encoded sint value
+func zigzagDecode(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// formatVarint renders a varint field. Fields configured via -signed show
+// their signed value next to the unsigned one; other fields do so when the
+// value is a small negative number in two's complement, which is what a
+// negative int32/int64 looks like on the wire.
+func formatVarint(fieldNumber int, v uint64) string {
+	switch signed[fieldNumber] {
+	case signedSint:
+		return fmt.Sprintf("%d (sint: %d)", v, zigzagDecode(v))
+	case signedInt:
+		return fmt.Sprintf("%d (int: %d)", v, int64(v))
+	}
+	if n := int64(v); n < 0 && n >= smallNegative {
+		return fmt.Sprintf("%d (int: %d)", v, n)
+	}
+	return fmt.Sprintf("%d", v)
+}
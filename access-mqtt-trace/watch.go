@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Heartbeat gap detection of -watch
+const (
+	watchHistory    = 8   // gaps the observed cadence is averaged over
+	watchMinSamples = 2   // gaps needed before the observed cadence is trusted
+	watchSlack      = 1.5 // a heartbeat later than this many intervals counts as missed
+)
+
+// heartbeatTrack is the heartbeat history of one topic
+type heartbeatTrack struct {
+	last    time.Time
+	gaps    []time.Duration // latest gaps, oldest first
+	count   int
+	missed  int
+	maxGap  time.Duration
+	late    bool   // a missed heartbeat was reported and the next one hasn't arrived yet
+	uptime  uint64 // last uptime of the device in seconds, from /stat payloads
+	reboots int
+}
+
+// expected returns the interval the next heartbeat is due in: the -watch-interval
+// flag, or the average observed gap. It reports false while too few
+// heartbeats were seen.
+func (t *heartbeatTrack) expected(interval time.Duration) (time.Duration, bool) {
+	if interval > 0 {
+		return interval, true
+	}
+	if len(t.gaps) < watchMinSamples {
+		return 0, false
+	}
+	var sum time.Duration
+	for _, gap := range t.gaps {
+		sum += gap
+	}
+	return sum / time.Duration(len(t.gaps)), true
+}
+
+// watcher tracks heartbeat arrival per topic during -watch
+type watcher struct {
+	mu       sync.Mutex
+	interval time.Duration // expected heartbeat interval, 0 = learn it per topic
+	tracks   map[string]*heartbeatTrack
+}
+
+func newWatcher(interval time.Duration) *watcher {
+	return &watcher{interval: interval, tracks: make(map[string]*heartbeatTrack)}
+}
+
+// record takes note of a message. Heartbeats are checked for gaps; /stat
+// payloads for an uptime that went backwards, i.e. a reboot.
+func (w *watcher) record(topicStr string, payload []byte, received time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if strings.Contains(topicStr, "/stat") {
+		w.recordUptime(topicStr, payload, received)
+		return
+	}
+	if !strings.Contains(topicStr, "/heart") {
+		return
+	}
+
+	track := w.track(topicStr)
+	track.count++
+	if track.last.IsZero() {
+		fmt.Printf("%s[WATCHING]%s %s\n", colorCyan, colorReset, topicStr)
+		track.last = received
+		return
+	}
+
+	gap := received.Sub(track.last)
+	if gap > track.maxGap {
+		track.maxGap = gap
+	}
+	if track.late {
+		fmt.Printf("%s[%s] [RECOVERED]%s %s after %s\n",
+			colorGreen, received.Format("15:04:05"), colorReset, topicStr, gap.Round(time.Second))
+		track.late = false
+	} else if expected, ok := track.expected(w.interval); ok && gap > scaled(expected) {
+		// Reported on arrival when the checker didn't catch it, e.g. in -replay
+		track.missed++
+		fmt.Printf("%s[%s] [GAP]%s %s: %s since the previous heartbeat, expected every %s\n",
+			colorYellow, received.Format("15:04:05"), colorReset, topicStr, gap.Round(time.Second), expected.Round(time.Second))
+	}
+
+	// A gap after a missed heartbeat would skew the learned cadence
+	if expected, ok := track.expected(w.interval); !ok || gap <= scaled(expected) {
+		track.gaps = append(track.gaps, gap)
+		if len(track.gaps) > watchHistory {
+			track.gaps = track.gaps[1:]
+		}
+	}
+	track.last = received
+}
+
+// recordUptime reports a device whose uptime went backwards. Must be called
+// with w.mu held.
+func (w *watcher) recordUptime(topicStr string, payload []byte, received time.Time) {
+	stat, ok := parseDeviceStat(payload)
+	if !ok {
+		return
+	}
+	uptime, err := parseUint(stat.attr("uptime"))
+	if err != nil || stat.attr("uptime") == "" {
+		return
+	}
+
+	track := w.track(topicStr)
+	if track.uptime > 0 && uptime < track.uptime {
+		track.reboots++
+		fmt.Printf("%s[%s] [REBOOTED]%s %s: uptime dropped from %s to %s\n",
+			colorRed, received.Format("15:04:05"), colorReset, topicStr, formatDuration(track.uptime), formatDuration(uptime))
+	}
+	track.uptime = uptime
+}
+
+// track returns the history of a topic. Must be called with w.mu held.
+func (w *watcher) track(topicStr string) *heartbeatTrack {
+	track := w.tracks[topicStr]
+	if track == nil {
+		track = &heartbeatTrack{}
+		w.tracks[topicStr] = track
+	}
+	return track
+}
+
+// check reports heartbeats that are overdue. It runs every second until stop
+// is closed, so a device that stops sending entirely is noticed too.
+func (w *watcher) check(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			w.checkOverdue(now)
+		}
+	}
+}
+
+// checkOverdue reports every topic whose next heartbeat is overdue at now
+func (w *watcher) checkOverdue(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for topicStr, track := range w.tracks {
+		if track.last.IsZero() || track.late {
+			continue
+		}
+		expected, ok := track.expected(w.interval)
+		if !ok {
+			continue
+		}
+		if since := now.Sub(track.last); since > scaled(expected) {
+			track.late = true
+			track.missed++
+			fmt.Printf("%s[%s] [MISSED]%s %s: no heartbeat for %s, expected every %s\n",
+				colorYellow, now.Format("15:04:05"), colorReset, topicStr, since.Round(time.Second), expected.Round(time.Second))
+		}
+	}
+}
+
+// printSummary prints the heartbeat statistics per topic, sorted
+func (w *watcher) printSummary() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	topics := make([]string, 0, len(w.tracks))
+	for t, track := range w.tracks {
+		if track.count > 0 || track.reboots > 0 {
+			topics = append(topics, t)
+		}
+	}
+	sort.Strings(topics)
+
+	fmt.Printf("\n%s[HEARTBEATS]%s %d topics\n", colorCyan, colorReset, len(topics))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  TOPIC\tCOUNT\tINTERVAL\tMAX GAP\tMISSED\tREBOOTS")
+	for _, t := range topics {
+		track := w.tracks[t]
+		interval := "-"
+		if expected, ok := track.expected(w.interval); ok {
+			interval = expected.Round(time.Second).String()
+		}
+		maxGap := "-"
+		if track.maxGap > 0 {
+			maxGap = track.maxGap.Round(time.Second).String()
+		}
+		fmt.Fprintf(tw, "  %s\t%d\t%s\t%s\t%d\t%d\n", t, track.count, interval, maxGap, track.missed, track.reboots)
+	}
+	tw.Flush()
+}
+
+// scaled returns the time after which a heartbeat due every interval counts
+// as missed
+func scaled(interval time.Duration) time.Duration {
+	return time.Duration(float64(interval) * watchSlack)
+}
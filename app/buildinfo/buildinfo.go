@@ -0,0 +1,66 @@
+// Package buildinfo holds the version of the gateway binary.
+package buildinfo
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Set at build time with
+//
+//	-ldflags "-X github.com/mqtt-home/unifi-access-mqtt/buildinfo.Version=v1.2.3
+//	          -X github.com/mqtt-home/unifi-access-mqtt/buildinfo.Commit=abc123
+//	          -X github.com/mqtt-home/unifi-access-mqtt/buildinfo.Date=2026-01-01T00:00:00Z"
+//
+// Unset values are taken from the module and VCS information Go embeds.
+var (
+	Version string
+	Commit  string
+	Date    string
+)
+
+// Info describes the running binary
+type Info struct {
+	Version string // Release version, "(devel)" for local builds
+	Commit  string // VCS revision, "" when unknown
+	Date    string // Build date (RFC 3339), or the commit time without one
+}
+
+// Get returns the build info of the binary
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date}
+	build, ok := debug.ReadBuildInfo()
+	if ok {
+		if info.Version == "" {
+			info.Version = build.Main.Version
+		}
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = setting.Value
+				}
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "unknown"
+	}
+	return info
+}
+
+// String returns the build info in one line, e.g. for -version
+func (i Info) String() string {
+	s := i.Version
+	if i.Commit != "" {
+		s += fmt.Sprintf(" (commit %s)", i.Commit)
+	}
+	if i.Date != "" {
+		s += fmt.Sprintf(", built %s", i.Date)
+	}
+	return s
+}
@@ -1,8 +1,11 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/philipparndt/go-logger"
 	"github.com/philipparndt/mqtt-gateway/config"
@@ -11,18 +14,153 @@ import (
 var cfg Config
 
 type Config struct {
-	MQTT     config.MQTTConfig `json:"mqtt"`
-	UniFi    UniFiConfig       `json:"unifi"`
-	LogLevel string            `json:"loglevel,omitempty"`
+	MQTT            config.MQTTConfig    `json:"mqtt"`
+	UniFi           UniFiConfigs         `json:"unifi"` // One controller object or an array of controllers
+	HomeAssistant   *HomeAssistantConfig `json:"homeassistant,omitempty"`
+	HTTP            *HTTPConfig          `json:"http,omitempty"`
+	Discovery       *DiscoveryConfig     `json:"discovery,omitempty"`       // Publish Home Assistant MQTT discovery configs
+	PublishEvents   bool                 `json:"publishEvents,omitempty"`   // Republish every controller event to {topic}/_bridge/events
+	PublishSnapshot bool                 `json:"publishSnapshot,omitempty"` // Also publish all door states combined to {topic}/_bridge/snapshot
+	DoorsTopic      string               `json:"doorsTopic,omitempty"`      // Topic of the retained array of all door states (default "doors")
+	DefaultAction   string               `json:"defaultAction,omitempty"`   // Action for commands with an empty payload, e.g. "unlock" (default: ignore)
+	LogLevel        string               `json:"loglevel,omitempty"`
+	LogFile         string               `json:"logfile,omitempty"`       // Write logs to this file instead of stdout
+	LogMaxSizeMB    int                  `json:"logMaxSizeMB,omitempty"`  // Rotate the log file at this size (default 10)
+	LogKeep         int                  `json:"logKeep,omitempty"`       // Rotated log files to keep (default 3)
+	DryRun          bool                 `json:"dryRun,omitempty"`        // Log unlock, lock, ring and dismiss instead of sending them to the controller
+	FailOnNoDoors   bool                 `json:"failOnNoDoors,omitempty"` // Abort startup when a controller has no doors
+	AllowReboot     bool                 `json:"allowReboot,omitempty"`   // Accept the reboot command for door hubs and readers
+
+	MQTTClientID *string `json:"mqttClientId,omitempty"` // MQTT client ID prefix; a random suffix is appended (default "unifi_access_mqtt")
+	BaseTopic    string  `json:"baseTopic,omitempty"`    // Overrides mqtt.topic, e.g. to share one mqtt block between instances
+
+	PublishRawEvents bool `json:"publishRawEvents,omitempty"` // Republish every controller event to {topic}/events/{event_type}
+
+	MinPublishIntervalMs int `json:"minPublishIntervalMs,omitempty"` // Minimum time between two state publishes of the same door (default 0 = no limit)
+
+	UnlockRateLimit *UnlockRateLimitConfig `json:"unlockRateLimit,omitempty"`
+
+	Retain RetainConfig `json:"retain,omitzero"` // Retain flag per message category
+}
+
+// RetainConfig sets the retain flag per message category. Unset categories
+// keep their default: mqtt.retain for states, retained for discovery.
+type RetainConfig struct {
+	State     *bool `json:"state,omitempty"`     // Door state and the other state topics
+	Doorbell  *bool `json:"doorbell,omitempty"`  // {door}/doorbell
+	Discovery *bool `json:"discovery,omitempty"` // Home Assistant discovery configs
+}
+
+// UnlockRateLimitConfig limits the unlock commands forwarded per door
+type UnlockRateLimitConfig struct {
+	Unlocks       int  `json:"unlocks,omitempty"`       // Unlocks allowed per interval (default 1)
+	Seconds       int  `json:"seconds,omitempty"`       // Interval length (default 2)
+	PublishErrors bool `json:"publishErrors,omitempty"` // Publish dropped commands to {door}/error
+}
+
+// HomeAssistantConfig enables pushing state directly to Home Assistant's REST
+// API, as an alternative (or in addition) to MQTT.
+type HomeAssistantConfig struct {
+	URL          string `json:"url"`                    // Base URL, e.g. "http://homeassistant.local:8123"
+	Token        string `json:"token"`                  // Long-lived access token
+	EntityPrefix string `json:"entityPrefix,omitempty"` // Entity ID prefix (default "unifi_access")
+}
+
+// DiscoveryConfig enables Home Assistant MQTT discovery
+type DiscoveryConfig struct {
+	Prefix string `json:"prefix,omitempty"` // Discovery prefix (default "homeassistant")
+}
+
+// HTTPConfig enables the HTTP control API
+type HTTPConfig struct {
+	Listen string `json:"listen,omitempty"` // Listen address (default ":8080")
+	Token  string `json:"token,omitempty"`  // Bearer token required on every request
+}
+
+// UniFiConfigs is the list of controllers. In the config file it may be
+// given as a single object or as an array.
+type UniFiConfigs []UniFiConfig
+
+// UnmarshalJSON accepts a single controller object or an array of them
+func (u *UniFiConfigs) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var single UniFiConfig
+		if err := json.Unmarshal(data, &single); err != nil {
+			return err
+		}
+		*u = UniFiConfigs{single}
+		return nil
+	}
+	var list []UniFiConfig
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*u = list
+	return nil
 }
 
 type UniFiConfig struct {
-	Host      string          `json:"host"`
-	Username  string          `json:"username"`
-	Password  string          `json:"password"`
-	VerifySSL *bool           `json:"verify-ssl,omitempty"`
-	Doorbell  *DoorbellConfig `json:"doorbell,omitempty"`
-	Viewer    *ViewerConfig   `json:"viewer,omitempty"`
+	Name        string          `json:"name,omitempty"` // Topic prefix for this controller's doors; required with multiple controllers
+	Host        string          `json:"host"`
+	Site        string          `json:"site,omitempty"` // UniFi OS site of the Access app; default site when empty
+	Username    string          `json:"username"`
+	Password    string          `json:"password"`
+	Credentials []Credential    `json:"credentials,omitempty"` // Fallback accounts, tried in order when login with username/password is rejected
+	APIToken    string          `json:"apiToken,omitempty"`    // API token; when set, username/password login is skipped
+	VerifySSL   *bool           `json:"verify-ssl,omitempty"`
+	CAFile      string          `json:"caFile,omitempty"` // PEM file with the CA of the controller certificate; enables verification
+	Doorbell    *DoorbellConfig `json:"doorbell,omitempty"`
+	Viewer      *ViewerConfig   `json:"viewer,omitempty"`
+
+	EntryWindowSeconds int    `json:"entryWindowSeconds,omitempty"` // Opening within this time after an unlock is published as an entry (default 30)
+	EventTimestamp     string `json:"eventTimestamp,omitempty"`     // "event" (default): time embedded in the event, "received": time of receipt
+	TimeZone           string `json:"timeZone,omitempty"`           // IANA time zone of the controller, e.g. "Europe/Berlin", for schedule windows (default: the gateway's)
+	HeldOpenSeconds    int    `json:"heldOpenSeconds,omitempty"`    // A door open longer than this is reported as held open (default 300)
+	RingTimeoutSeconds int    `json:"ringTimeoutSeconds,omitempty"` // A call ringing longer than this without a cancel is cleared (default 60)
+
+	SessionRefreshMinutes int `json:"sessionRefreshMinutes,omitempty"` // Log in again after this many minutes to renew the session (default 720)
+
+	SuppressSelfTriggeredRings bool `json:"suppressSelfTriggeredRings,omitempty"` // Don't publish rings triggered by the gateway's own ring command
+
+	Doors map[string]DoorOptions `json:"doors,omitempty"` // Per-door options keyed by door name or ID
+
+	IncludeDoors []string `json:"includeDoors,omitempty"` // Only export these doors (name or ID); all when empty
+	ExcludeDoors []string `json:"excludeDoors,omitempty"` // Never export these doors (name or ID)
+
+	BootstrapCache string `json:"bootstrapCache,omitempty"` // File caching the last bootstrap, loaded at startup while the controller is unreachable
+
+	EventTypes []string `json:"eventTypes,omitempty"` // Only handle these WebSocket event types; all when empty
+
+	UserAgent string            `json:"userAgent,omitempty"` // User-Agent of the API requests and the WebSocket (default unifi-access-mqtt/{version})
+	Headers   map[string]string `json:"headers,omitempty"`   // Extra headers of the API requests and the WebSocket, e.g. for a reverse proxy
+
+	EventReconnect *bool `json:"eventReconnect,omitempty"` // Reconnect the event WebSocket when it drops (default true); false shuts the gateway down instead
+
+	Groups map[string][]string `json:"groups,omitempty"` // Door groups by name (door names or IDs), unlocked together with group/{name}/set
+}
+
+// DoorOptions are the options of a single door
+type DoorOptions struct {
+	ReadOnly bool `json:"readOnly,omitempty"` // Publish state only; reject unlock and lock commands over MQTT and HTTP
+}
+
+// ReadOnlyDoors returns the names or IDs of the doors configured read-only,
+// sorted
+func (c UniFiConfig) ReadOnlyDoors() []string {
+	var doors []string
+	for name, options := range c.Doors {
+		if options.ReadOnly {
+			doors = append(doors, name)
+		}
+	}
+	sort.Strings(doors)
+	return doors
+}
+
+// Credential is a login for the UniFi Access controller
+type Credential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
 // DoorbellConfig defines the devices to use for doorbell ring triggers
@@ -30,6 +168,7 @@ type DoorbellConfig struct {
 	SourceReader     string           `json:"sourceReader"`               // Device ID or MAC of the reader (UA-G3, UA-G3-Pro)
 	TargetViewers    []string         `json:"targetViewers"`              // Device IDs or MACs of viewers to notify
 	DismissOnContact []ContactBinding `json:"dismissOnContact,omitempty"` // External MQTT contact sensors that dismiss active calls when the door opens
+	FanOutViewers    bool             `json:"fanOutViewers,omitempty"`    // Ring every viewer with its own remote_call, so one offline viewer doesn't fail the ring
 }
 
 // ContactBinding subscribes to an external MQTT door-contact topic. When the
@@ -45,12 +184,12 @@ type ContactBinding struct {
 // MQTT broker (mTLS) used to send remote_view RPC commands that wake viewer
 // displays without ringing the doorbell reader.
 type ViewerConfig struct {
-	Broker        string          `json:"broker"`                 // host[:port] of the controller's MQTT broker (default port 12812)
-	CA            string          `json:"ca"`                     // path to the CA certificate file
-	Cert          string          `json:"cert"`                   // path to the client certificate file
-	Key           string          `json:"key"`                    // path to the client private key file
-	ControllerID  string          `json:"controllerID"`           // controller MAC without colons, e.g. "aabbccddeeff"
-	WakeOnMotion  []MotionBinding `json:"wakeOnMotion,omitempty"` // External MQTT motion sensors that wake viewers
+	Broker       string          `json:"broker"`                 // host[:port] of the controller's MQTT broker (default port 12812)
+	CA           string          `json:"ca"`                     // path to the CA certificate file
+	Cert         string          `json:"cert"`                   // path to the client certificate file
+	Key          string          `json:"key"`                    // path to the client private key file
+	ControllerID string          `json:"controllerID"`           // controller MAC without colons, e.g. "aabbccddeeff"
+	WakeOnMotion []MotionBinding `json:"wakeOnMotion,omitempty"` // External MQTT motion sensors that wake viewers
 }
 
 // MotionBinding subscribes to an external MQTT motion sensor topic and wakes
@@ -63,13 +202,47 @@ type MotionBinding struct {
 	SourceReader string   `json:"sourceReader,omitempty"` // Optional source reader device ID for the remote_view (defaults to doorbell.sourceReader)
 }
 
+// DefaultMQTTClientID is the MQTT client ID prefix used without mqttClientId
+const DefaultMQTTClientID = "unifi_access_mqtt"
+
+// GetMQTTClientID returns the MQTT client ID prefix. The mqtt-gateway library
+// appends a random suffix, so several instances never share a client ID.
+func (c *Config) GetMQTTClientID() string {
+	if c.MQTTClientID == nil {
+		return DefaultMQTTClientID
+	}
+	return strings.TrimSpace(*c.MQTTClientID)
+}
+
+// MQTTEnabled reports whether an MQTT broker is configured
+func (c *Config) MQTTEnabled() bool {
+	return c.MQTT.URL != ""
+}
+
+// GetCredentials returns all configured logins in the order they are tried:
+// username/password first, then the credentials list.
+func (u *UniFiConfig) GetCredentials() []Credential {
+	var creds []Credential
+	if u.Username != "" {
+		creds = append(creds, Credential{Username: u.Username, Password: u.Password})
+	}
+	return append(creds, u.Credentials...)
+}
+
 func (u *UniFiConfig) GetVerifySSL() bool {
 	if u.VerifySSL == nil {
-		return false // Default to false for self-signed certificates
+		// Default to false for self-signed certificates, unless their CA is given
+		return u.CAFile != ""
 	}
 	return *u.VerifySSL
 }
 
+// GetEventReconnect reports whether the event WebSocket reconnects when it
+// drops
+func (u *UniFiConfig) GetEventReconnect() bool {
+	return u.EventReconnect == nil || *u.EventReconnect
+}
+
 func LoadConfig(file string) (Config, error) {
 	data, err := os.ReadFile(file)
 	if err != nil {
@@ -86,11 +259,24 @@ func LoadConfig(file string) (Config, error) {
 		return Config{}, err
 	}
 
-	// Set default values
-	if cfg.LogLevel == "" {
-		cfg.LogLevel = "info"
+	return finishConfig(cfg)
+}
+
+// finishConfig sets the defaults of a loaded config, validates it and makes
+// it the config returned by Get
+func finishConfig(c Config) (Config, error) {
+	if c.LogLevel == "" {
+		c.LogLevel = "info"
+	}
+	if c.BaseTopic != "" {
+		c.MQTT.Topic = c.BaseTopic
+	}
+
+	if err := c.Validate(); err != nil {
+		return Config{}, err
 	}
 
+	cfg = c
 	return cfg, nil
 }
 
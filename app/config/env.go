@@ -0,0 +1,120 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/philipparndt/mqtt-gateway/config"
+)
+
+// DefaultEnvMQTTTopic is the base topic of the environment configuration
+// without MQTT_TOPIC
+const DefaultEnvMQTTTopic = "home/unifi-access"
+
+// EnvConfigured reports whether the environment holds a configuration for
+// LoadConfigFromEnv, i.e. UNIFI_HOST is set
+func EnvConfigured() bool {
+	return os.Getenv("UNIFI_HOST") != ""
+}
+
+// LoadConfigFromEnv builds the config of a single controller from environment
+// variables instead of a file. Only the common settings are available; the
+// others need a config file.
+//
+//	UNIFI_HOST, UNIFI_USERNAME, UNIFI_PASSWORD, UNIFI_API_TOKEN, UNIFI_SITE,
+//	UNIFI_VERIFY_SSL, UNIFI_CA_FILE, UNIFI_BOOTSTRAP_CACHE, UNIFI_USER_AGENT
+//	MQTT_URL, MQTT_TOPIC, MQTT_USERNAME, MQTT_PASSWORD, MQTT_RETAIN, MQTT_QOS,
+//	MQTT_CLIENT_ID
+//	HTTP_LISTEN, HTTP_TOKEN
+//	DISCOVERY, DISCOVERY_PREFIX
+//	LOG_LEVEL, LOG_FILE, DRY_RUN
+func LoadConfigFromEnv() (Config, error) {
+	var errs []error
+	env := envReader{errs: &errs}
+
+	c := Config{
+		MQTT: config.MQTTConfig{
+			URL:      env.str("MQTT_URL"),
+			Topic:    env.str("MQTT_TOPIC"),
+			Username: env.str("MQTT_USERNAME"),
+			Password: env.str("MQTT_PASSWORD"),
+			Retain:   env.boolean("MQTT_RETAIN"),
+		},
+		UniFi: UniFiConfigs{{
+			Host:           env.str("UNIFI_HOST"),
+			Username:       env.str("UNIFI_USERNAME"),
+			Password:       env.str("UNIFI_PASSWORD"),
+			APIToken:       env.str("UNIFI_API_TOKEN"),
+			Site:           env.str("UNIFI_SITE"),
+			CAFile:         env.str("UNIFI_CA_FILE"),
+			BootstrapCache: env.str("UNIFI_BOOTSTRAP_CACHE"),
+			UserAgent:      env.str("UNIFI_USER_AGENT"),
+		}},
+		LogLevel: env.str("LOG_LEVEL"),
+		LogFile:  env.str("LOG_FILE"),
+		DryRun:   env.boolean("DRY_RUN"),
+	}
+	// Checked before narrowing to a byte, which would turn 256 into 0
+	if qos := env.integer("MQTT_QOS"); qos < 0 || qos > 2 {
+		errs = append(errs, fmt.Errorf("MQTT_QOS: %d is not 0, 1 or 2", qos))
+	} else {
+		c.MQTT.QoS = byte(qos)
+	}
+	if c.MQTT.URL != "" && c.MQTT.Topic == "" {
+		c.MQTT.Topic = DefaultEnvMQTTTopic
+	}
+	if _, ok := os.LookupEnv("UNIFI_VERIFY_SSL"); ok {
+		verify := env.boolean("UNIFI_VERIFY_SSL")
+		c.UniFi[0].VerifySSL = &verify
+	}
+	if id, ok := os.LookupEnv("MQTT_CLIENT_ID"); ok {
+		c.MQTTClientID = &id
+	}
+	if listen, token := env.str("HTTP_LISTEN"), env.str("HTTP_TOKEN"); listen != "" || token != "" {
+		c.HTTP = &HTTPConfig{Listen: listen, Token: token}
+	}
+	if prefix := env.str("DISCOVERY_PREFIX"); env.boolean("DISCOVERY") || prefix != "" {
+		c.Discovery = &DiscoveryConfig{Prefix: prefix}
+	}
+
+	if len(errs) > 0 {
+		return Config{}, errors.Join(errs...)
+	}
+	return finishConfig(c)
+}
+
+// envReader reads typed environment variables, collecting malformed values
+type envReader struct {
+	errs *[]error
+}
+
+func (r envReader) str(name string) string {
+	return strings.TrimSpace(os.Getenv(name))
+}
+
+func (r envReader) boolean(name string) bool {
+	value := r.str(name)
+	if value == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		*r.errs = append(*r.errs, fmt.Errorf("%s: %q is not a boolean", name, value))
+	}
+	return b
+}
+
+func (r envReader) integer(name string) int {
+	value := r.str(name)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		*r.errs = append(*r.errs, fmt.Errorf("%s: %q is not a number", name, value))
+	}
+	return n
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// setEnv sets the environment of a minimal valid env config plus extra
+func setEnv(t *testing.T, extra map[string]string) {
+	t.Helper()
+	env := map[string]string{
+		"UNIFI_HOST":     "https://unifi.local",
+		"UNIFI_USERNAME": "admin",
+		"UNIFI_PASSWORD": "secret",
+		"MQTT_URL":       "tcp://broker:1883",
+	}
+	for name, value := range extra {
+		env[name] = value
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	setEnv(t, map[string]string{"MQTT_QOS": "2", "MQTT_RETAIN": "true", "UNIFI_VERIFY_SSL": "false"})
+
+	c, err := LoadConfigFromEnv()
+	if err != nil {
+		t.Fatalf("LoadConfigFromEnv: %v", err)
+	}
+	if c.MQTT.QoS != 2 || !c.MQTT.Retain || c.MQTT.Topic != DefaultEnvMQTTTopic {
+		t.Errorf("mqtt = %+v, want qos 2, retained, topic %q", c.MQTT, DefaultEnvMQTTTopic)
+	}
+	if len(c.UniFi) != 1 || c.UniFi[0].Host != "https://unifi.local" || c.UniFi[0].VerifySSL == nil || *c.UniFi[0].VerifySSL {
+		t.Errorf("unifi = %+v, want one controller without SSL verification", c.UniFi)
+	}
+}
+
+func TestLoadConfigFromEnvRejectsMalformedValues(t *testing.T) {
+	tests := []struct {
+		name, variable, value, want string
+	}{
+		{"qos that overflows a byte", "MQTT_QOS", "256", "MQTT_QOS: 256 is not 0, 1 or 2"},
+		{"negative qos", "MQTT_QOS", "-1", "MQTT_QOS: -1 is not 0, 1 or 2"},
+		{"qos that isn't a number", "MQTT_QOS", "high", `MQTT_QOS: "high" is not a number`},
+		{"malformed boolean", "MQTT_RETAIN", "sometimes", `MQTT_RETAIN: "sometimes" is not a boolean`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, map[string]string{tt.variable: tt.value})
+			if _, err := LoadConfigFromEnv(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
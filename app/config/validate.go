@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// macPattern matches a MAC address with ":" or "-" separators
+	macPattern = regexp.MustCompile(`^([0-9A-Fa-f]{2}[:-]){5}[0-9A-Fa-f]{2}$`)
+	// deviceIDPattern matches device IDs: a MAC without separators, a UUID or
+	// a similar opaque ID
+	deviceIDPattern = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z_-]*$`)
+)
+
+// MQTT URL schemes understood by the MQTT client
+var mqttSchemes = map[string]bool{"tcp": true, "mqtt": true, "ssl": true, "tls": true, "mqtts": true, "ws": true, "wss": true}
+
+// Validate checks the config for missing or malformed settings. It returns
+// every problem found, joined into one error, so all of them can be fixed at
+// once.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if len(c.UniFi) == 0 {
+		errs = append(errs, fmt.Errorf("no controller configured: set unifi"))
+	}
+	names := make(map[string]bool)
+	caches := make(map[string]bool)
+	for i := range c.UniFi {
+		u := &c.UniFi[i]
+		prefix := "unifi"
+		if len(c.UniFi) > 1 {
+			prefix = fmt.Sprintf("unifi[%d]", i)
+			if u.Name == "" {
+				errs = append(errs, fmt.Errorf("%s: name is required when multiple controllers are configured", prefix))
+			} else if names[u.Name] {
+				errs = append(errs, fmt.Errorf("%s: duplicate name %q", prefix, u.Name))
+			}
+			names[u.Name] = true
+		}
+		if u.BootstrapCache != "" {
+			if caches[u.BootstrapCache] {
+				errs = append(errs, fmt.Errorf("%s.bootstrapCache %q is used by another controller", prefix, u.BootstrapCache))
+			}
+			caches[u.BootstrapCache] = true
+		}
+		errs = append(errs, u.validate(prefix)...)
+	}
+
+	if c.MQTTEnabled() {
+		errs = append(errs, c.validateMQTT()...)
+	}
+
+	if !c.MQTTEnabled() && c.HomeAssistant == nil && c.HTTP == nil {
+		errs = append(errs, fmt.Errorf("no output configured: set mqtt.url, homeassistant and/or http"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validate checks the settings of one controller
+func (u *UniFiConfig) validate(prefix string) []error {
+	var errs []error
+
+	if u.Host == "" {
+		errs = append(errs, fmt.Errorf("%s.host is required, e.g. \"https://192.168.1.1\"", prefix))
+	} else if parsed, err := url.Parse(u.Host); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		errs = append(errs, fmt.Errorf("%s.host %q must be a URL like \"https://192.168.1.1\"", prefix, u.Host))
+	}
+
+	if u.CAFile != "" {
+		if u.VerifySSL != nil && !*u.VerifySSL {
+			errs = append(errs, fmt.Errorf("%s.caFile requires verify-ssl to be true or unset", prefix))
+		}
+		if _, err := os.Stat(u.CAFile); err != nil {
+			errs = append(errs, fmt.Errorf("%s.caFile: %w", prefix, err))
+		}
+	}
+
+	if u.APIToken == "" {
+		if u.Username == "" && len(u.Credentials) == 0 {
+			errs = append(errs, fmt.Errorf("%s: set username and password, credentials or apiToken", prefix))
+		}
+		if u.Username != "" && u.Password == "" {
+			errs = append(errs, fmt.Errorf("%s.password is required with username", prefix))
+		}
+		if u.Username == "" && u.Password != "" {
+			errs = append(errs, fmt.Errorf("%s.username is required with password", prefix))
+		}
+	}
+	for i, cred := range u.Credentials {
+		if cred.Username == "" || cred.Password == "" {
+			errs = append(errs, fmt.Errorf("%s.credentials[%d]: username and password are required", prefix, i))
+		}
+	}
+
+	if u.TimeZone != "" {
+		if _, err := time.LoadLocation(u.TimeZone); err != nil {
+			errs = append(errs, fmt.Errorf("%s.timeZone %q is not a known time zone, e.g. \"Europe/Berlin\"", prefix, u.TimeZone))
+		}
+	}
+
+	if u.Doorbell != nil {
+		if u.Doorbell.SourceReader != "" && !isDeviceID(u.Doorbell.SourceReader) {
+			errs = append(errs, fmt.Errorf("%s.doorbell.sourceReader %q is not a MAC address or device ID", prefix, u.Doorbell.SourceReader))
+		}
+		for i, viewer := range u.Doorbell.TargetViewers {
+			if !isDeviceID(viewer) {
+				errs = append(errs, fmt.Errorf("%s.doorbell.targetViewers[%d] %q is not a MAC address or device ID", prefix, i, viewer))
+			}
+		}
+	}
+
+	return errs
+}
+
+// validateMQTT checks the MQTT block
+func (c *Config) validateMQTT() []error {
+	var errs []error
+
+	parsed, err := url.Parse(c.MQTT.URL)
+	if err != nil || !mqttSchemes[strings.ToLower(parsed.Scheme)] || parsed.Host == "" {
+		errs = append(errs, fmt.Errorf("mqtt.url %q must be a URL like \"tcp://192.168.0.1:1883\"", c.MQTT.URL))
+	}
+	if c.MQTT.Topic == "" {
+		errs = append(errs, fmt.Errorf("mqtt.topic is required, e.g. \"home/unifi-access\""))
+	} else if strings.ContainsAny(c.MQTT.Topic, "+#") {
+		errs = append(errs, fmt.Errorf("mqtt.topic %q must not contain wildcards", c.MQTT.Topic))
+	}
+	if c.MQTT.QoS > 2 {
+		errs = append(errs, fmt.Errorf("mqtt.qos must be 0, 1 or 2, got %d", c.MQTT.QoS))
+	}
+	if c.GetMQTTClientID() == "" {
+		errs = append(errs, fmt.Errorf("mqttClientId is empty; check the environment variables it references"))
+	}
+
+	return errs
+}
+
+// isDeviceID reports whether s looks like a MAC address or a device ID
+func isDeviceID(s string) bool {
+	return macPattern.MatchString(s) || deviceIDPattern.MatchString(s)
+}
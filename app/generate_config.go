@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/mqtt-home/unifi-access-mqtt/unifi"
+)
+
+// configTemplate is the config written by -generate-config. Credentials are
+// never written; they are replaced by environment variable references.
+type configTemplate struct {
+	MQTT       mqttTemplate       `json:"mqtt"`
+	UniFi      unifiTemplate      `json:"unifi"`
+	LogLevel   string             `json:"loglevel"`
+	Discovered discoveredTopology `json:"_discovered"` // informational, ignored when loading
+}
+
+type mqttTemplate struct {
+	URL    string `json:"url"`
+	Topic  string `json:"topic"`
+	Retain bool   `json:"retain"`
+	QoS    int    `json:"qos"`
+}
+
+type unifiTemplate struct {
+	Host      string            `json:"host"`
+	Username  string            `json:"username"`
+	Password  string            `json:"password"`
+	VerifySSL bool              `json:"verify-ssl"`
+	Doorbell  *doorbellTemplate `json:"doorbell,omitempty"`
+}
+
+type doorbellTemplate struct {
+	SourceReader  string   `json:"sourceReader"`
+	TargetViewers []string `json:"targetViewers"`
+}
+
+type discoveredTopology struct {
+	Doors   []discoveredDoor   `json:"doors"`
+	Readers []discoveredDevice `json:"readers"`
+	Viewers []discoveredDevice `json:"viewers"`
+}
+
+type discoveredDoor struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Topic string `json:"topic"` // suggested topic suffix: {topic}/<this>
+	Type  string `json:"type"`
+}
+
+type discoveredDevice struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Door string `json:"door,omitempty"`
+}
+
+// generateConfig logs in, bootstraps and writes a config template for the
+// discovered topology to stdout.
+func generateConfig(host, username, password string, verifySSL bool) error {
+	client := unifi.NewClient(host, username, password, verifySSL)
+	if err := client.Login(); err != nil {
+		return err
+	}
+	bootstrap, err := client.Bootstrap()
+	if err != nil {
+		return err
+	}
+
+	tmpl := configTemplate{
+		MQTT: mqttTemplate{
+			URL:    "tcp://localhost:1883",
+			Topic:  "home/unifi-access",
+			Retain: true,
+			QoS:    1,
+		},
+		UniFi: unifiTemplate{
+			Host:      host,
+			Username:  "${UNIFI_USERNAME}",
+			Password:  "${UNIFI_PASSWORD}",
+			VerifySSL: verifySSL,
+		},
+		LogLevel: "info",
+		Discovered: discoveredTopology{
+			Doors:   []discoveredDoor{},
+			Readers: []discoveredDevice{},
+			Viewers: []discoveredDevice{},
+		},
+	}
+
+	for i := range bootstrap.Devices {
+		device := &bootstrap.Devices[i]
+		switch {
+		case device.HasCapability(unifi.CapabilityIsHub):
+			name := device.Name
+			if device.Door != nil {
+				name = device.Door.Name
+			}
+			tmpl.Discovered.Doors = append(tmpl.Discovered.Doors, discoveredDoor{
+				ID:    device.UniqueID,
+				Name:  name,
+				Topic: unifi.SanitizeName(name),
+				Type:  device.DeviceType,
+			})
+		case device.IsReader():
+			tmpl.Discovered.Readers = append(tmpl.Discovered.Readers, newDiscoveredDevice(device))
+		}
+	}
+
+	viewerIDs := []string{}
+	for i := range bootstrap.Viewers {
+		viewer := &bootstrap.Viewers[i]
+		tmpl.Discovered.Viewers = append(tmpl.Discovered.Viewers, newDiscoveredDevice(viewer))
+		viewerIDs = append(viewerIDs, viewer.GetID())
+	}
+
+	// Pre-fill the doorbell with the first reader; users with several readers
+	// pick theirs from _discovered.readers.
+	if len(tmpl.Discovered.Readers) > 0 {
+		tmpl.UniFi.Doorbell = &doorbellTemplate{
+			SourceReader:  tmpl.Discovered.Readers[0].ID,
+			TargetViewers: viewerIDs,
+		}
+	}
+
+	data, err := json.MarshalIndent(tmpl, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(data))
+	return err
+}
+
+func newDiscoveredDevice(device *unifi.DeviceConfig) discoveredDevice {
+	d := discoveredDevice{ID: device.GetID(), Name: device.Name, Type: device.DeviceType}
+	if device.Door != nil {
+		d.Door = device.Door.Name
+	}
+	return d
+}
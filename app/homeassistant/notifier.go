@@ -0,0 +1,222 @@
+package homeassistant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mqtt-home/unifi-access-mqtt/unifi"
+	"github.com/philipparndt/go-logger"
+)
+
+// DefaultEntityPrefix is the prefix for entity IDs created by the gateway
+const DefaultEntityPrefix = "unifi_access"
+
+var invalidEntityChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// Notifier pushes door state directly into Home Assistant through its REST
+// API (POST /api/states/<entity_id>). It is an alternative to MQTT for users
+// who don't run a broker. Entities created this way are read-only: commands
+// (unlock, ring) still require MQTT.
+//
+// Only the standard library is used, so enabling it adds no dependency.
+type Notifier struct {
+	controller   *unifi.Controller
+	baseURL      string
+	token        string
+	entityPrefix string
+	httpClient   *http.Client
+
+	// State updates waiting to be sent, latest per entity. They are sent by
+	// a goroutine of their own, so a slow Home Assistant doesn't hold up the
+	// event callbacks.
+	mu      sync.Mutex
+	pending map[string]stateRequest
+	order   []string // entity IDs in pending, oldest first
+	wake    chan struct{}
+	ctx     context.Context // cancelled by Stop, also aborts a running request
+	stop    context.CancelFunc
+}
+
+// NewNotifier creates a Home Assistant notifier. entityPrefix may be empty.
+func NewNotifier(controller *unifi.Controller, baseURL, token, entityPrefix string) *Notifier {
+	if entityPrefix == "" {
+		entityPrefix = DefaultEntityPrefix
+	}
+	n := &Notifier{
+		controller:   controller,
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		token:        token,
+		entityPrefix: entityPrefix,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		pending:      make(map[string]stateRequest),
+		wake:         make(chan struct{}, 1),
+	}
+	n.ctx, n.stop = context.WithCancel(context.Background())
+	go n.run()
+	return n
+}
+
+// Stop stops sending state updates; updates that are still pending are
+// dropped. Safe to call more than once.
+func (n *Notifier) Stop() {
+	n.stop()
+}
+
+// stateRequest is the body of POST /api/states/<entity_id>
+type stateRequest struct {
+	State      string         `json:"state"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// PublishDoorState updates the lock and door-position entities of a door
+func (n *Notifier) PublishDoorState(door *unifi.Door) {
+	attrs := map[string]any{
+		"friendly_name": door.Name,
+		"door_id":       door.ID,
+		"device_type":   door.Device.DeviceType,
+		"is_online":     door.IsOnline,
+	}
+	n.setState(n.entityID("lock", door, ""), door.LockStatus, attrs)
+
+	position := "off"
+	if door.DoorStatus == "open" {
+		position = "on"
+	}
+	n.setState(n.entityID("binary_sensor", door, "door"), position, map[string]any{
+		"friendly_name": door.Name + " Door",
+		"device_class":  "door",
+	})
+}
+
+// PublishDoorbellState updates the doorbell entity of a door
+func (n *Notifier) PublishDoorbellState(door *unifi.Door) {
+	state := "off"
+	if door.DoorbellRinging {
+		state = "on"
+	}
+	n.setState(n.entityID("binary_sensor", door, "doorbell"), state, map[string]any{
+		"friendly_name":  door.Name + " Doorbell",
+		"device_class":   "sound",
+		"request_id":     door.DoorbellRequestID,
+		"self_triggered": door.SelfTriggeredRing,
+	})
+}
+
+// PublishAllDoors pushes the state of all doors
+func (n *Notifier) PublishAllDoors() {
+	doors := n.controller.GetDoors()
+	logger.Info("Pushing initial state to Home Assistant", "count", len(doors))
+	for _, door := range doors {
+		n.PublishDoorState(door)
+		if door.Device.HasCapability(unifi.CapabilityDoorbell) {
+			n.PublishDoorbellState(door)
+		}
+	}
+}
+
+// entityID builds a Home Assistant entity ID, e.g. lock.unifi_access_front_door
+func (n *Notifier) entityID(domain string, door *unifi.Door, suffix string) string {
+	object := n.entityPrefix + "_" + door.TopicName()
+	if suffix != "" {
+		object += "_" + suffix
+	}
+	object = invalidEntityChars.ReplaceAllString(strings.ToLower(object), "_")
+	return domain + "." + strings.Trim(object, "_")
+}
+
+// setState queues a state update for the sender. An update of an entity that
+// is still pending replaces it, so only the latest state is sent.
+func (n *Notifier) setState(entityID, state string, attrs map[string]any) {
+	n.mu.Lock()
+	if _, queued := n.pending[entityID]; !queued {
+		n.order = append(n.order, entityID)
+	}
+	n.pending[entityID] = stateRequest{State: state, Attributes: attrs}
+	n.mu.Unlock()
+
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run sends the queued state updates until Stop
+func (n *Notifier) run() {
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-n.wake:
+		}
+		for {
+			entityID, body, ok := n.next()
+			if !ok {
+				break
+			}
+			n.send(entityID, body)
+			select {
+			case <-n.ctx.Done():
+				return
+			default:
+			}
+		}
+	}
+}
+
+// next takes the oldest pending state update
+func (n *Notifier) next() (string, stateRequest, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.order) == 0 {
+		return "", stateRequest{}, false
+	}
+	entityID := n.order[0]
+	n.order = n.order[1:]
+	body := n.pending[entityID]
+	delete(n.pending, entityID)
+	return entityID, body, true
+}
+
+// send posts a state update, logging failures
+func (n *Notifier) send(entityID string, body stateRequest) {
+	if err := n.postState(entityID, body); err != nil {
+		logger.Error("Failed to update Home Assistant entity", "entity", entityID, "err", err)
+		return
+	}
+	logger.Debug("Updated Home Assistant entity", "entity", entityID, "state", body.State)
+}
+
+func (n *Notifier) postState(entityID string, body stateRequest) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/api/states/%s", n.baseURL, entityID)
+	req, err := http.NewRequestWithContext(n.ctx, "POST", url, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+n.token)
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
@@ -0,0 +1,467 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mqtt-home/unifi-access-mqtt/unifi"
+	"github.com/philipparndt/go-logger"
+)
+
+// DefaultListen is the default address of the HTTP API
+const DefaultListen = ":8080"
+
+// Server is an optional HTTP API for scripts that don't speak MQTT. It serves
+// the doors of all controllers of the gateway.
+type Server struct {
+	controllers []*unifi.Controller
+	token       string // bearer token required on every request ("" = no authentication)
+	server      *http.Server
+	checks      []healthCheck
+}
+
+// healthCheck reports whether a subsystem is up
+type healthCheck struct {
+	name  string
+	check func() bool
+}
+
+// healthResponse is returned by GET /healthz
+type healthResponse struct {
+	Status string          `json:"status"`         // "ok" or "unavailable"
+	Checks map[string]bool `json:"checks"`         // state of every subsystem
+	Down   []string        `json:"down,omitempty"` // subsystems that are down
+}
+
+// DoorState is the JSON representation of a door
+type DoorState struct {
+	DoorID          string `json:"door_id"`
+	Name            string `json:"name"`
+	LockStatus      string `json:"lock_status"`
+	DoorStatus      string `json:"door_status"`
+	DeviceType      string `json:"device_type"`
+	IsOnline        bool   `json:"is_online"`
+	HasDoorbell     bool   `json:"has_doorbell"`
+	DoorbellRinging bool   `json:"doorbell_ringing"`
+	Building        string `json:"building,omitempty"`
+	Floor           string `json:"floor,omitempty"`
+
+	LastAccessMethod  string `json:"last_access_method,omitempty"`
+	ScheduledUnlocked bool   `json:"scheduled_unlocked"`
+	ScheduleName      string `json:"schedule_name,omitempty"`
+}
+
+// pinCodeRequest is the body of POST /users/{id}/pin_codes. Omitted times
+// leave that end of the validity open.
+type pinCodeRequest struct {
+	Pin       string    `json:"pin"`
+	ValidFrom time.Time `json:"valid_from,omitzero"`
+	ValidTo   time.Time `json:"valid_to,omitzero"`
+}
+
+// credentialResponse is returned for a created credential
+type credentialResponse struct {
+	ID string `json:"id"`
+}
+
+// unlockTokenRequest is the optional body of POST /doors/{id}/unlock_token
+type unlockTokenRequest struct {
+	TTLSeconds int `json:"ttl_seconds,omitempty"` // Validity of the token (default 300)
+}
+
+// unlockTokenResponse is returned for an issued unlock token
+type unlockTokenResponse struct {
+	Token     string    `json:"token"`
+	DoorID    string    `json:"door_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// groupUnlockResponse is returned by POST /groups/{name}/unlock
+type groupUnlockResponse struct {
+	Group   string             `json:"group"`
+	Results []unifi.DoorResult `json:"results"`
+}
+
+// errorResponse is returned with every non-2xx status
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewServer creates an HTTP API listening on listen (DefaultListen when empty).
+// Without a token only the read-only endpoints are served, since anyone who
+// can reach the port could otherwise unlock doors.
+func NewServer(listen, token string, controllers []*unifi.Controller) *Server {
+	if listen == "" {
+		listen = DefaultListen
+	}
+
+	s := &Server{
+		controllers: controllers,
+		token:       token,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /doors", s.handleDoors)
+	if token != "" {
+		mux.HandleFunc("POST /doors/{id}/unlock", s.handleUnlock)
+		mux.HandleFunc("POST /doors/{id}/doorbell/dismiss", s.handleDismiss)
+		mux.HandleFunc("POST /doors/{id}/doorbell/answer", s.handleAnswer)
+		mux.HandleFunc("POST /doors/{id}/unlock_token", s.handleIssueUnlockToken)
+		mux.HandleFunc("POST /groups/{name}/unlock", s.handleGroupUnlock)
+		mux.HandleFunc("POST /users/{id}/pin_codes", s.handleCreatePinCode)
+		mux.HandleFunc("DELETE /credentials/{id}", s.handleDeleteCredential)
+		mux.HandleFunc("POST /refresh", s.handleRefresh)
+	}
+
+	s.server = &http.Server{
+		Addr:              listen,
+		Handler:           s.authenticate(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// AddHealthCheck adds a subsystem to GET /healthz. Checks must be added
+// before Start.
+func (s *Server) AddHealthCheck(name string, check func() bool) {
+	s.checks = append(s.checks, healthCheck{name: name, check: check})
+}
+
+// Start serves the API in the background
+func (s *Server) Start() {
+	if s.token == "" {
+		logger.Warn("HTTP API has no token configured, only GET /healthz and GET /doors are served")
+	}
+
+	go func() {
+		logger.Info("HTTP API listening", "addr", s.server.Addr)
+		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("HTTP API failed", "err", err)
+		}
+	}()
+}
+
+// Stop shuts the server down, waiting briefly for running requests
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		logger.Warn("HTTP API shutdown", "err", err)
+	}
+}
+
+// authenticate requires "Authorization: Bearer <token>" when a token is set.
+// The health check is open so liveness probes work without the token.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" && r.URL.Path != "/healthz" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleHealth returns 200 when all subsystems are up and 503 otherwise
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	resp := healthResponse{Status: "ok", Checks: make(map[string]bool, len(s.checks))}
+	for _, c := range s.checks {
+		up := c.check()
+		resp.Checks[c.name] = up
+		if !up {
+			resp.Down = append(resp.Down, c.name)
+		}
+	}
+
+	status := http.StatusOK
+	if len(resp.Down) > 0 {
+		resp.Status = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
+
+// handleDoors returns all doors with their current state
+func (s *Server) handleDoors(w http.ResponseWriter, r *http.Request) {
+	doors := []DoorState{}
+	for _, controller := range s.controllers {
+		for _, door := range controller.GetDoors() {
+			doors = append(doors, newDoorState(door))
+		}
+	}
+	writeJSON(w, http.StatusOK, doors)
+}
+
+// handleUnlock unlocks a door
+func (s *Server) handleUnlock(w http.ResponseWriter, r *http.Request) {
+	controller, door := s.findDoor(r.PathValue("id"))
+	if door == nil {
+		writeError(w, http.StatusNotFound, "unknown door")
+		return
+	}
+
+	if controller.IsReadOnly(door) {
+		logger.Warn("Rejected HTTP API unlock for read-only door", "door", door.Name)
+		writeError(w, http.StatusForbidden, "door is read-only")
+		return
+	}
+
+	logger.Info("HTTP API unlock", "door", door.Name)
+	err := controller.UnlockDoor(door)
+	if errors.Is(err, unifi.ErrUnlockRateLimited) {
+		writeError(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to unlock door", "door", door.Name, "err", err)
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, newDoorState(door))
+}
+
+// handleDismiss dismisses the active doorbell call of a door
+func (s *Server) handleDismiss(w http.ResponseWriter, r *http.Request) {
+	controller, door := s.findDoor(r.PathValue("id"))
+	if door == nil {
+		writeError(w, http.StatusNotFound, "unknown door")
+		return
+	}
+
+	logger.Info("HTTP API dismiss doorbell call", "door", door.Name)
+	if err := controller.DismissDoorbellCall(door); err != nil {
+		logger.Error("Failed to dismiss doorbell call", "door", door.Name, "err", err)
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, newDoorState(door))
+}
+
+// handleAnswer accepts the active doorbell call of a door
+func (s *Server) handleAnswer(w http.ResponseWriter, r *http.Request) {
+	controller, door := s.findDoor(r.PathValue("id"))
+	if door == nil {
+		writeError(w, http.StatusNotFound, "unknown door")
+		return
+	}
+
+	logger.Info("HTTP API answer doorbell call", "door", door.Name)
+	if err := controller.AnswerDoorbellCall(door); err != nil {
+		logger.Error("Failed to answer doorbell call", "door", door.Name, "err", err)
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, newDoorState(door))
+}
+
+// handleGroupUnlock unlocks every door of a group of the controller given by
+// the "controller" query parameter. Read-only doors are skipped and a failing
+// door doesn't stop the others; the outcome of each is returned.
+func (s *Server) handleGroupUnlock(w http.ResponseWriter, r *http.Request) {
+	controller, err := s.findController(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	name := r.PathValue("name")
+	doors, results, err := controller.GroupDoors(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	logger.Info("HTTP API group unlock", "group", name, "doors", len(doors))
+	var unlock []*unifi.Door
+	for _, door := range doors {
+		if controller.IsReadOnly(door) {
+			logger.Warn("Rejected group unlock for read-only door", "group", name, "door", door.Name)
+			results = append(results, unifi.DoorResult{Door: unifi.SanitizeName(door.TopicName()), Error: "door is read-only"})
+			continue
+		}
+		unlock = append(unlock, door)
+	}
+	results = append(results, controller.UnlockDoors(unlock)...)
+	if results == nil {
+		results = []unifi.DoorResult{}
+	}
+	writeJSON(w, http.StatusOK, groupUnlockResponse{Group: name, Results: results})
+}
+
+// handleIssueUnlockToken issues a one-time unlock token for a door, redeemed
+// with an MQTT unlock command
+func (s *Server) handleIssueUnlockToken(w http.ResponseWriter, r *http.Request) {
+	controller, door := s.findDoor(r.PathValue("id"))
+	if door == nil {
+		writeError(w, http.StatusNotFound, "unknown door")
+		return
+	}
+
+	var req unlockTokenRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TTLSeconds < 0 {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+
+	logger.Info("HTTP API issue unlock token", "door", door.Name, "ttl_seconds", req.TTLSeconds)
+	token, expiresAt := controller.IssueUnlockToken(door, time.Duration(req.TTLSeconds)*time.Second)
+	writeJSON(w, http.StatusCreated, unlockTokenResponse{Token: token, DoorID: door.ID, ExpiresAt: expiresAt})
+}
+
+// handleCreatePinCode creates a time-limited PIN code for a user and returns
+// the credential ID
+func (s *Server) handleCreatePinCode(w http.ResponseWriter, r *http.Request) {
+	controller, err := s.findController(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req pinCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	userID := r.PathValue("id")
+	logger.Info("HTTP API create PIN code", "user", userID, "valid_from", req.ValidFrom, "valid_to", req.ValidTo)
+	id, err := controller.CreatePinCredential(userID, req.Pin, req.ValidFrom, req.ValidTo)
+	if errors.Is(err, unifi.ErrInvalidCredential) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		logger.Error("Failed to create PIN code", "user", userID, "err", err)
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, credentialResponse{ID: id})
+}
+
+// handleDeleteCredential revokes a credential
+func (s *Server) handleDeleteCredential(w http.ResponseWriter, r *http.Request) {
+	controller, err := s.findController(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id := r.PathValue("id")
+	logger.Info("HTTP API delete credential", "credential", id)
+	if err := controller.DeleteCredential(id); err != nil {
+		logger.Error("Failed to delete credential", "credential", id, "err", err)
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRefresh bootstraps the controller given by the "controller" query
+// parameter, or all controllers without it, and returns the doors
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	controllers := s.controllers
+	if r.URL.Query().Get("controller") != "" {
+		controller, err := s.findController(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		controllers = []*unifi.Controller{controller}
+	}
+
+	logger.Info("HTTP API refresh", "controllers", len(controllers))
+	doors := []DoorState{}
+	for _, controller := range controllers {
+		if err := controller.Refresh(); err != nil && !errors.Is(err, unifi.ErrNoDoors) {
+			logger.Error("Failed to refresh doors", "controller", controller.Name(), "err", err)
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		for _, door := range controller.GetDoors() {
+			doors = append(doors, newDoorState(door))
+		}
+	}
+	writeJSON(w, http.StatusOK, doors)
+}
+
+// findController resolves the controller of a request from its "controller"
+// query parameter, which may be omitted with a single controller
+func (s *Server) findController(r *http.Request) (*unifi.Controller, error) {
+	name := r.URL.Query().Get("controller")
+	if name == "" {
+		if len(s.controllers) != 1 {
+			return nil, errors.New("controller query parameter is required with multiple controllers")
+		}
+		return s.controllers[0], nil
+	}
+	for _, controller := range s.controllers {
+		if strings.EqualFold(controller.Name(), name) {
+			return controller, nil
+		}
+	}
+	return nil, errors.New("unknown controller")
+}
+
+// findDoor resolves a door by ID, topic name or display name across all
+// controllers
+func (s *Server) findDoor(id string) (*unifi.Controller, *unifi.Door) {
+	for _, controller := range s.controllers {
+		if door := controller.GetDoor(id); door != nil {
+			return controller, door
+		}
+	}
+	for _, controller := range s.controllers {
+		for _, door := range controller.GetDoors() {
+			if unifi.SanitizeName(door.TopicName()) == id {
+				return controller, door
+			}
+		}
+		if door := controller.GetDoorByName(id); door != nil {
+			return controller, door
+		}
+	}
+	return nil, nil
+}
+
+// newDoorState builds the JSON representation of a door
+func newDoorState(door *unifi.Door) DoorState {
+	return DoorState{
+		DoorID:          door.ID,
+		Name:            door.Name,
+		LockStatus:      door.LockStatus,
+		DoorStatus:      door.DoorStatus,
+		DeviceType:      door.Device.DeviceType,
+		IsOnline:        door.IsOnline,
+		HasDoorbell:     door.Device.HasCapability(unifi.CapabilityDoorbell),
+		DoorbellRinging: door.DoorbellRinging,
+		Building:        door.BuildingName,
+		Floor:           door.FloorName,
+
+		LastAccessMethod:  door.LastAccessMethod,
+		ScheduledUnlocked: door.ScheduledUnlocked,
+		ScheduleName:      door.ScheduleName,
+	}
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Debug("Failed to write HTTP response", "err", err)
+	}
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
@@ -0,0 +1,140 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mqtt-home/unifi-access-mqtt/unifi"
+)
+
+const testToken = "secret"
+
+// newTestController returns a dry-run controller with a front door and a
+// gate, so no controller is needed
+func newTestController(t *testing.T) *unifi.Controller {
+	t.Helper()
+	bootstrap := &unifi.BootstrapResponse{
+		Version: "2.2.0",
+		Devices: []unifi.DeviceConfig{
+			{UniqueID: "hub-front", Name: "Front Door", DeviceType: unifi.DeviceTypeUAH, IsOnline: true,
+				Capabilities: []string{unifi.CapabilityIsHub},
+				Door:         &unifi.DoorReference{UniqueID: "location-front", Name: "Front Door"}},
+			{UniqueID: "hub-gate", Name: "Gate", DeviceType: unifi.DeviceTypeUAH, IsOnline: true,
+				Capabilities: []string{unifi.CapabilityIsHub},
+				Door:         &unifi.DoorReference{UniqueID: "location-gate", Name: "Gate"}},
+		},
+		Doors: []unifi.DoorConfig{
+			{UniqueID: "location-front", Name: "Front Door"},
+			{UniqueID: "location-gate", Name: "Gate"},
+		},
+	}
+	controller, err := unifi.NewControllerFromBootstrap(bootstrap)
+	if err != nil {
+		t.Fatalf("NewControllerFromBootstrap: %v", err)
+	}
+	controller.SetDryRun(true)
+	t.Cleanup(controller.Disconnect)
+	return controller
+}
+
+// serve sends a request to the server's handler and returns the response
+func serve(s *Server, method, path, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthentication(t *testing.T) {
+	s := NewServer("", testToken, []*unifi.Controller{newTestController(t)})
+
+	tests := []struct {
+		name, method, path, token string
+		status                    int
+	}{
+		{"health check without token", http.MethodGet, "/healthz", "", http.StatusOK},
+		{"doors without token", http.MethodGet, "/doors", "", http.StatusUnauthorized},
+		{"unlock without token", http.MethodPost, "/doors/front-door/unlock", "", http.StatusUnauthorized},
+		{"unlock with a wrong token", http.MethodPost, "/doors/front-door/unlock", "wrong", http.StatusUnauthorized},
+		{"unlock with the token", http.MethodPost, "/doors/front-door/unlock", testToken, http.StatusOK},
+		{"unknown door", http.MethodPost, "/doors/garage/unlock", testToken, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := serve(s, tt.method, tt.path, tt.token); w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, w.Code, tt.status, w.Body)
+		}
+	}
+}
+
+func TestWithoutTokenOnlyReadOnlyEndpoints(t *testing.T) {
+	s := NewServer("", "", []*unifi.Controller{newTestController(t)})
+
+	if w := serve(s, http.MethodGet, "/doors", ""); w.Code != http.StatusOK {
+		t.Errorf("GET /doors: status = %d, want 200", w.Code)
+	}
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPost, "/doors/front-door/unlock"},
+		{http.MethodPost, "/doors/front-door/doorbell/answer"},
+		{http.MethodPost, "/doors/front-door/unlock_token"},
+		{http.MethodPost, "/groups/all/unlock"},
+		{http.MethodPost, "/users/user-1/pin_codes"},
+		{http.MethodDelete, "/credentials/credential-1"},
+		{http.MethodPost, "/refresh"},
+	} {
+		if w := serve(s, route.method, route.path, ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s %s without a token: status = %d, want 404", route.method, route.path, w.Code)
+		}
+	}
+}
+
+func TestUnlockGuards(t *testing.T) {
+	controller := newTestController(t)
+	controller.SetReadOnlyDoors([]string{"Gate"})
+	controller.SetUnlockRateLimit(1, time.Minute)
+	s := NewServer("", testToken, []*unifi.Controller{controller})
+
+	if w := serve(s, http.MethodPost, "/doors/gate/unlock", testToken); w.Code != http.StatusForbidden {
+		t.Errorf("unlock of a read-only door: status = %d, want 403", w.Code)
+	}
+	if w := serve(s, http.MethodPost, "/doors/front-door/unlock", testToken); w.Code != http.StatusOK {
+		t.Errorf("first unlock: status = %d, want 200", w.Code)
+	}
+	if w := serve(s, http.MethodPost, "/doors/front-door/unlock", testToken); w.Code != http.StatusTooManyRequests {
+		t.Errorf("unlock beyond the rate limit: status = %d, want 429", w.Code)
+	}
+}
+
+func TestGroupUnlock(t *testing.T) {
+	controller := newTestController(t)
+	controller.SetReadOnlyDoors([]string{"Gate"})
+	controller.SetDoorGroups(map[string][]string{"all": {"Front Door", "hub-front", "Gate", "Garage"}})
+	s := NewServer("", testToken, []*unifi.Controller{controller})
+
+	if w := serve(s, http.MethodPost, "/groups/lobby/unlock", testToken); w.Code != http.StatusNotFound {
+		t.Errorf("unknown group: status = %d, want 404", w.Code)
+	}
+
+	w := serve(s, http.MethodPost, "/groups/ALL/unlock", testToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("group unlock: status = %d, want 200 (%s)", w.Code, w.Body)
+	}
+	var resp groupUnlockResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []unifi.DoorResult{
+		{Door: "Garage", Error: "unknown door"},
+		{Door: "gate", Error: "door is read-only"},
+		{Door: "front-door", OK: true},
+	}
+	if !slices.Equal(resp.Results, want) {
+		t.Errorf("results = %+v, want %+v", resp.Results, want)
+	}
+}
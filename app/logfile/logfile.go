@@ -0,0 +1,116 @@
+// Package logfile writes log output to a file with size-based rotation.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+)
+
+// Defaults for the rotation limits
+const (
+	DefaultMaxSizeMB = 10
+	DefaultKeep      = 3
+)
+
+// ansiEscape matches the color codes of the console log format
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// Writer is an io.Writer appending to a file. When the file would grow past
+// the maximum size it is renamed to path.1 (path.1 to path.2, ...) and a new
+// file is started; only the newest keep rotated files are kept.
+type Writer struct {
+	path    string
+	maxSize int64
+	keep    int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens (or creates) the log file at path. Zero limits keep the defaults.
+func Open(path string, maxSizeMB, keep int) (*Writer, error) {
+	if maxSizeMB <= 0 {
+		maxSizeMB = DefaultMaxSizeMB
+	}
+	if keep <= 0 {
+		keep = DefaultKeep
+	}
+
+	w := &Writer{
+		path:    path,
+		maxSize: int64(maxSizeMB) * 1024 * 1024,
+		keep:    keep,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write appends a log line, rotating the file first when it is full. Color
+// codes are stripped.
+func (w *Writer) Write(p []byte) (int, error) {
+	line := ansiEscape.ReplaceAll(p, nil)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.size > 0 && w.size+int64(len(line)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			// Keep writing to the current file rather than losing logs
+			fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", err)
+		}
+	}
+
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the log file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+// open opens the log file for appending
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	return nil
+}
+
+// rotate shifts the rotated files by one, dropping the oldest, and starts a
+// new file
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", w.path, w.keep))
+	for i := w.keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+	}
+	renameErr := os.Rename(w.path, w.path+".1")
+
+	if err := w.open(); err != nil {
+		return err
+	}
+	return renameErr
+}
@@ -1,142 +1,541 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/mqtt-home/unifi-access-mqtt/buildinfo"
 	"github.com/mqtt-home/unifi-access-mqtt/config"
+	"github.com/mqtt-home/unifi-access-mqtt/homeassistant"
+	"github.com/mqtt-home/unifi-access-mqtt/httpapi"
+	"github.com/mqtt-home/unifi-access-mqtt/logfile"
 	"github.com/mqtt-home/unifi-access-mqtt/metrics"
 	mqttpub "github.com/mqtt-home/unifi-access-mqtt/mqtt"
+	"github.com/mqtt-home/unifi-access-mqtt/notifier"
 	"github.com/mqtt-home/unifi-access-mqtt/unifi"
 	"github.com/philipparndt/go-logger"
 	"github.com/philipparndt/mqtt-gateway/mqtt"
 )
 
+// defaultConfigFile is read when no config file is given, unless it is
+// missing and the config comes from environment variables instead
+const defaultConfigFile = "/var/lib/unifi-access-mqtt/config.json"
+
 func main() {
-	logger.Init("debug", logger.Logger())
-	if len(os.Args) < 2 {
-		logger.Error("Usage: unifi-access-mqtt <config-file>")
-		os.Exit(1)
+	generate := flag.Bool("generate-config", false, "Log in, discover the topology and print a config template to stdout")
+	host := flag.String("host", "", "UniFi Access host for -generate-config, e.g. https://192.168.1.1")
+	username := flag.String("username", os.Getenv("UNIFI_USERNAME"), "Username for -generate-config (default $UNIFI_USERNAME)")
+	password := flag.String("password", "", "Password for -generate-config (default $UNIFI_PASSWORD)")
+	verifySSL := flag.Bool("verify-ssl", false, "Verify the controller certificate in -generate-config")
+	version := flag.Bool("version", false, "Print the version, commit and build date and exit")
+	flag.Parse()
+
+	if *version {
+		fmt.Println("unifi-access-mqtt", buildinfo.Get())
+		return
 	}
 
-	configFile := os.Args[1]
+	if *generate {
+		// Logs go to stderr so stdout can be piped into a config file
+		logger.Init("warn", logger.Logger())
+		logger.LogTo(os.Stderr)
+		if *password == "" {
+			*password = os.Getenv("UNIFI_PASSWORD")
+		}
+		if err := generateConfig(*host, *username, *password, *verifySSL); err != nil {
+			logger.Error("Failed to generate config", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// Load configuration
-	cfg, err := config.LoadConfig(configFile)
+	logger.Init("debug", logger.Logger())
+	// Load configuration: a config file takes precedence; without one the
+	// config is built from environment variables. A file given as argument
+	// must exist; only the container's default file may be missing.
+	configFile := flag.Arg(0)
+	if configFile == "" {
+		if _, statErr := os.Stat(defaultConfigFile); statErr == nil {
+			configFile = defaultConfigFile
+		}
+	}
+	var cfg config.Config
+	var err error
+	switch {
+	case configFile != "":
+		cfg, err = config.LoadConfig(configFile)
+	case config.EnvConfigured():
+		logger.Info("No config file found, reading the config from environment variables")
+		cfg, err = config.LoadConfigFromEnv()
+	default:
+		logger.Error("Usage: unifi-access-mqtt [config-file] (default " + defaultConfigFile + ", or set UNIFI_HOST and the other environment variables)")
+		os.Exit(1)
+	}
 	if err != nil {
-		logger.Error("Failed to load config", "err", err)
+		// Validation reports every problem on its own line
+		for _, line := range strings.Split(err.Error(), "\n") {
+			logger.Error("Failed to load config", "err", line)
+		}
 		os.Exit(1)
 	}
 
 	// Set log level
 	logger.SetLevel(cfg.LogLevel)
 
-	logger.Info("UniFi Access MQTT Gateway starting...")
-	logger.Info("Connecting to UniFi Access", "host", cfg.UniFi.Host)
+	if cfg.LogFile != "" {
+		logFile, err := logfile.Open(cfg.LogFile, cfg.LogMaxSizeMB, cfg.LogKeep)
+		if err != nil {
+			logger.Error("Failed to open log file", "file", cfg.LogFile, "err", err)
+			os.Exit(1)
+		}
+		defer logFile.Close()
+		logger.Info("Logging to file", "file", cfg.LogFile)
+		logger.LogTo(logFile)
+	}
+
+	logger.Info("UniFi Access MQTT Gateway starting...", "version", buildinfo.Get().Version)
+
+	// Cancelled on SIGINT/SIGTERM, also while still connecting
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	// Also cancelled when an event WebSocket drops with eventReconnect off
+	ctx, shutdown := context.WithCancelCause(signalCtx)
+	defer shutdown(nil)
+
+	if cfg.MQTTEnabled() {
+		// Connect to MQTT broker
+		mqtt.Start(cfg.MQTT, cfg.GetMQTTClientID())
+
+		// The library publishes "online" with the configured retain flag;
+		// republish retained so late subscribers see the gateway available
+		mqttpub.PublishAvailability(true)
+
+		// Round trips to the broker detect outages; states published
+		// meanwhile are queued and sent once it is back
+		stopHealthProbe := mqttpub.StartHealthProbe(mqttpub.DefaultHealthProbeInterval)
+		defer stopHealthProbe()
+	} else {
+		logger.Info("No MQTT broker configured, MQTT commands and listeners are disabled")
+	}
+
+	// One controller, event listener and publisher per configured console
+	var stops []func()
+	var controllers []*unifi.Controller
+	for _, unifiCfg := range cfg.UniFi {
+		controller, stop := startController(ctx, cfg, unifiCfg)
+		controllers = append(controllers, controller)
+		stops = append(stops, stop)
+
+		go func() {
+			select {
+			case <-controller.EventsLost():
+				logger.Error("Event WebSocket disconnected, shutting down", "host", unifiCfg.Host)
+				shutdown(errEventsLost)
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	if cfg.HTTP != nil {
+		server := httpapi.NewServer(cfg.HTTP.Listen, cfg.HTTP.Token, controllers)
+		for _, controller := range controllers {
+			name := "unifi"
+			if controller.Name() != "" {
+				name += "_" + unifi.SanitizeName(controller.Name())
+			}
+			server.AddHealthCheck(name, controller.EventsConnected)
+		}
+		if cfg.MQTTEnabled() {
+			server.AddHealthCheck("mqtt", mqttpub.MQTTConnected)
+		}
+		server.Start()
+		stops = append(stops, server.Stop)
+	}
+
+	logger.Info("UniFi Access MQTT Gateway is running", "controllers", len(cfg.UniFi))
+
+	// Wait for shutdown signal
+	<-ctx.Done()
+
+	logger.Info("Shutting down...")
+	if cfg.MQTTEnabled() {
+		mqttpub.PublishAvailability(false)
+	}
+	for i := len(stops) - 1; i >= 0; i-- {
+		stops[i]()
+	}
+	if errors.Is(context.Cause(ctx), errEventsLost) {
+		os.Exit(1)
+	}
+}
+
+// errEventsLost is the shutdown cause when an event WebSocket dropped and
+// reconnecting is disabled
+var errEventsLost = errors.New("event WebSocket disconnected")
+
+// startController connects to one UniFi Access controller and wires it to the
+// configured outputs. The controller is disconnected when ctx is cancelled;
+// the returned function stops everything else that was started for it.
+func startController(ctx context.Context, cfg config.Config, unifiCfg config.UniFiConfig) (*unifi.Controller, func()) {
+	var stops []func()
+	stop := func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+
+	logger.Info("Connecting to UniFi Access", "host", unifiCfg.Host, "name", unifiCfg.Name)
 
 	// Create UniFi Access controller
-	controller := unifi.NewController(
-		cfg.UniFi.Host,
-		cfg.UniFi.Username,
-		cfg.UniFi.Password,
-		cfg.UniFi.GetVerifySSL(),
+	var credentials []unifi.Credential
+	for _, cred := range unifiCfg.GetCredentials() {
+		credentials = append(credentials, unifi.Credential{Username: cred.Username, Password: cred.Password})
+	}
+	controller := unifi.NewControllerWithCredentials(
+		unifiCfg.Host,
+		credentials,
+		unifiCfg.GetVerifySSL(),
 	)
+	controller.SetName(unifiCfg.Name)
+	if unifiCfg.CAFile != "" {
+		if err := controller.SetCAFile(unifiCfg.CAFile); err != nil {
+			logger.Error("Failed to load CA file", "host", unifiCfg.Host, "err", err)
+			os.Exit(1)
+		}
+		logger.Info("Verifying the controller certificate", "host", unifiCfg.Host, "ca", unifiCfg.CAFile)
+	}
 
 	// Set doorbell configuration if present
-	if cfg.UniFi.Doorbell != nil {
-		controller.SetDoorbellConfig(cfg.UniFi.Doorbell.SourceReader, cfg.UniFi.Doorbell.TargetViewers)
+	if unifiCfg.Doorbell != nil {
+		controller.SetDoorbellConfig(unifiCfg.Doorbell.SourceReader, unifiCfg.Doorbell.TargetViewers)
+		controller.SetDoorbellFanOut(unifiCfg.Doorbell.FanOutViewers)
 	}
 
-	// Connect to UniFi Access
-	if err := controller.Connect(); err != nil {
-		logger.Error("Failed to connect to UniFi Access", "err", err)
-		os.Exit(1)
+	if unifiCfg.EntryWindowSeconds > 0 {
+		controller.SetEntryWindow(time.Duration(unifiCfg.EntryWindowSeconds) * time.Second)
+	}
+
+	if unifiCfg.HeldOpenSeconds > 0 {
+		controller.SetHeldOpenThreshold(time.Duration(unifiCfg.HeldOpenSeconds) * time.Second)
+	}
+
+	if unifiCfg.RingTimeoutSeconds > 0 {
+		controller.SetRingTimeout(time.Duration(unifiCfg.RingTimeoutSeconds) * time.Second)
+	}
+
+	if unifiCfg.Site != "" {
+		controller.SetSite(unifiCfg.Site)
+		logger.Info("Using UniFi OS site", "host", unifiCfg.Host, "site", unifiCfg.Site)
+	}
+
+	if unifiCfg.EventTimestamp != "" {
+		controller.SetEventTimestampSource(unifiCfg.EventTimestamp)
+	}
+	if unifiCfg.TimeZone != "" {
+		// Validated with the config
+		loc, _ := time.LoadLocation(unifiCfg.TimeZone)
+		controller.SetTimeZone(loc)
 	}
-	defer controller.Disconnect()
 
-	// Connect to MQTT broker
-	mqtt.Start(cfg.MQTT, "unifi_access_mqtt")
+	if len(unifiCfg.EventTypes) > 0 {
+		controller.SetEventFilter(unifiCfg.EventTypes)
+		logger.Info("Handling only listed WebSocket events", "host", unifiCfg.Host, "events", unifiCfg.EventTypes)
+	}
+
+	if !unifiCfg.GetEventReconnect() {
+		controller.SetEventReconnect(false)
+		logger.Info("The gateway shuts down when the event WebSocket drops (eventReconnect is off)", "host", unifiCfg.Host)
+	}
+
+	controller.SetUserAgent(unifiCfg.UserAgent)
+	if len(unifiCfg.Headers) > 0 {
+		controller.SetHeaders(unifiCfg.Headers)
+	}
 
-	// Create MQTT publisher
-	publisher := mqttpub.NewPublisher(controller)
+	if unifiCfg.APIToken != "" {
+		controller.SetAPIToken(unifiCfg.APIToken)
+		logger.Info("Using API token authentication", "host", unifiCfg.Host)
+	}
+
+	controller.SetSuppressSelfTriggeredRings(unifiCfg.SuppressSelfTriggeredRings)
+	controller.SetDoorFilter(unifiCfg.IncludeDoors, unifiCfg.ExcludeDoors)
+	if len(unifiCfg.Groups) > 0 {
+		controller.SetDoorGroups(unifiCfg.Groups)
+	}
+	if readOnly := unifiCfg.ReadOnlyDoors(); len(readOnly) > 0 {
+		controller.SetReadOnlyDoors(readOnly)
+	}
+	if limit := cfg.UnlockRateLimit; limit != nil {
+		controller.SetUnlockRateLimit(limit.Unlocks, time.Duration(limit.Seconds)*time.Second)
+	}
+	if cfg.DryRun {
+		logger.Warn("Dry run: door commands are logged but not sent to the controller", "host", unifiCfg.Host)
+		controller.SetDryRun(true)
+	}
+
+	if unifiCfg.BootstrapCache != "" {
+		controller.SetBootstrapCache(unifiCfg.BootstrapCache)
+	}
+
+	// Disconnecting on shutdown also aborts a Connect that hangs and closes the
+	// keep-alive connections to the controller
+	context.AfterFunc(ctx, controller.Disconnect)
+
+	// Connect to UniFi Access
+	warmStarted := false
+	if err := controller.Connect(); errors.Is(err, unifi.ErrNoDoors) {
+		if cfg.FailOnNoDoors {
+			logger.Error("No doors found on UniFi Access controller, aborting (failOnNoDoors)", "host", unifiCfg.Host)
+			os.Exit(1)
+		}
+		logger.Warn("No doors found on UniFi Access controller, nothing will be published until it is fixed and the gateway restarts", "host", unifiCfg.Host)
+	} else if err != nil {
+		if ctx.Err() != nil {
+			logger.Info("Shut down while connecting to UniFi Access", "host", unifiCfg.Host)
+			os.Exit(0)
+		}
+		if unifiCfg.BootstrapCache == "" {
+			logger.Error("Failed to connect to UniFi Access", "host", unifiCfg.Host, "err", err)
+			os.Exit(1)
+		}
+		logger.Warn("Failed to connect to UniFi Access, starting from the bootstrap cache", "host", unifiCfg.Host, "err", err)
+		if cacheErr := controller.WarmStart(); cacheErr != nil && !errors.Is(cacheErr, unifi.ErrNoDoors) {
+			logger.Error("Failed to load the bootstrap cache", "host", unifiCfg.Host, "path", unifiCfg.BootstrapCache, "err", cacheErr)
+			os.Exit(1)
+		}
+		warmStarted = true
+	}
+	stops = append(stops, controller.Disconnect)
+
+	if unifiCfg.APIToken == "" {
+		controller.StartSessionRefresh(time.Duration(unifiCfg.SessionRefreshMinutes) * time.Minute)
+	}
 
 	// Metrics store: viewer wakes + doorbell ring/miss counters
 	metricsStore := metrics.New()
 
+	// Outputs: MQTT publisher and/or native Home Assistant integration
+	var notifiers notifier.Multi
+	var publisher *mqttpub.Publisher
+	if cfg.MQTTEnabled() {
+		// Create MQTT publisher
+		publisher = mqttpub.NewPublisher(controller)
+		publisher.SetTopicPrefix(unifiCfg.Name)
+		notifiers = append(notifiers, publisher)
+	}
+	if cfg.HomeAssistant != nil {
+		entityPrefix := cfg.HomeAssistant.EntityPrefix
+		if unifiCfg.Name != "" {
+			if entityPrefix == "" {
+				entityPrefix = homeassistant.DefaultEntityPrefix
+			}
+			entityPrefix += "_" + unifiCfg.Name
+		}
+		haNotifier := homeassistant.NewNotifier(
+			controller,
+			cfg.HomeAssistant.URL,
+			cfg.HomeAssistant.Token,
+			entityPrefix,
+		)
+		notifiers = append(notifiers, haNotifier)
+		stops = append(stops, haNotifier.Stop)
+		logger.Info("Home Assistant integration enabled", "url", cfg.HomeAssistant.URL)
+	}
+
 	// Set up event callbacks
 	controller.OnDoorUpdate = func(door *unifi.Door) {
-		publisher.PublishDoorState(door)
+		notifiers.PublishDoorState(door)
 		if door.LockStatus == "unlocked" {
-			metricsStore.MarkDoorbellHandled(door.ID)
+			metricsStore.MarkDoorbellHandled(door.Key)
 		}
 	}
 
 	controller.OnDoorbellRing = func(door *unifi.Door) {
-		publisher.PublishDoorbellState(door)
-		metricsStore.RecordDoorbellRing(door.ID, door.Name)
+		notifiers.PublishDoorbellState(door)
+		metricsStore.RecordDoorbellRing(door.Key, door.Name)
 		logger.Info("Doorbell ringing", "door", door.Name)
 	}
 
 	controller.OnDoorbellCancel = func(door *unifi.Door) {
-		publisher.PublishDoorbellState(door)
-		metricsStore.RecordDoorbellCancel(door.ID)
-		publisher.PublishMetrics(metricsStore.Snapshot())
+		notifiers.PublishDoorbellState(door)
+		metricsStore.RecordDoorbellCancel(door.Key)
+		if publisher != nil {
+			publisher.PublishMetrics(metricsStore.Snapshot())
+		}
 		logger.Info("Doorbell call ended", "door", door.Name)
 	}
 
 	controller.OnDoorbellDismiss = func(door *unifi.Door) {
-		metricsStore.MarkDoorbellHandled(door.ID)
+		metricsStore.MarkDoorbellHandled(door.Key)
 	}
 
-	// Subscribe to MQTT commands
-	publisher.SubscribeToCommands()
-
-	// Subscribe to external door-contact topics that should dismiss active calls
-	if cfg.UniFi.Doorbell != nil && len(cfg.UniFi.Doorbell.DismissOnContact) > 0 {
-		mqttpub.NewContactListener(controller, cfg.UniFi.Doorbell.DismissOnContact).Start()
+	// Publish doors that appeared (or changed) since the last bootstrap
+	controller.OnRefresh = func() {
+		notifiers.PublishAllDoors()
+		if publisher != nil {
+			if cfg.Discovery != nil {
+				publisher.PublishDiscovery(cfg.Discovery.Prefix)
+			}
+			publisher.PublishCapabilities()
+			publisher.PublishGatewayInfo()
+		}
 	}
 
-	// Connect to the controller's internal MQTT broker (mTLS) for viewer wake-up
-	if cfg.UniFi.Viewer != nil && len(cfg.UniFi.Viewer.WakeOnMotion) > 0 {
-		waker := unifi.NewViewerWaker(
-			cfg.UniFi.Viewer.Broker,
-			cfg.UniFi.Viewer.ControllerID,
-			cfg.UniFi.Viewer.CA,
-			cfg.UniFi.Viewer.Cert,
-			cfg.UniFi.Viewer.Key,
-		)
-		waker.OnWake = func(viewerID string) {
-			metricsStore.RecordViewerWake(viewerID)
+	if publisher != nil {
+		controller.OnDoorEntry = publisher.PublishDoorEntry
+		controller.OnCycleCount = publisher.PublishCycleCount
+		controller.OnScheduleChange = func(door *unifi.Door) {
+			publisher.PublishScheduleState(door)
+			publisher.PublishDoorState(door)
+		}
+		controller.OnDoorAccess = publisher.PublishDoorAccess
+		controller.OnAccessDenied = publisher.PublishDoorAccess
+		controller.OnDoorHeldOpen = publisher.PublishHeldOpen
+		controller.OnDoorAlarm = publisher.PublishDoorAlarm
+		controller.OnDoorUnlockPulse = publisher.PublishDoorUnlockPulse
+		controller.OnDoorOnlineChange = publisher.PublishDoorAvailability
+		controller.OnDoorRemoved = func(door *unifi.Door) {
+			publisher.RemoveDoor(door)
+			if cfg.Discovery != nil {
+				publisher.RemoveDiscovery(door, cfg.Discovery.Prefix)
+			}
 		}
-		if err := waker.Connect(); err != nil {
-			logger.Error("Failed to connect viewer waker", "err", err)
-		} else {
-			defer waker.Disconnect()
-			mqttpub.NewMotionListener(controller, waker, cfg.UniFi.Viewer.WakeOnMotion).Start()
+
+		publisher.SetDefaultAction(cfg.DefaultAction)
+		publisher.SetAllowReboot(cfg.AllowReboot)
+		publisher.SetRetain(cfg.Retain)
+		publisher.SetMinPublishInterval(time.Duration(cfg.MinPublishIntervalMs) * time.Millisecond)
+
+		publisher.SetDoorsTopic(cfg.DoorsTopic)
+		if limit := cfg.UnlockRateLimit; limit != nil && limit.PublishErrors {
+			controller.OnUnlockLimited = publisher.PublishUnlockLimited
+		}
+		if cfg.PublishSnapshot {
+			publisher.EnableKeyedSnapshot()
+		}
+		if cfg.Discovery != nil {
+			publisher.EnableDeviceTriggers()
+		}
+
+		var eventHooks []func(unifi.EventPacket)
+		if cfg.PublishEvents {
+			eventHooks = append(eventHooks, publisher.PublishEvent)
+			logger.Info("Publishing all controller events", "topic", "_bridge/events")
+		}
+		if cfg.PublishRawEvents {
+			eventHooks = append(eventHooks, publisher.PublishRawEvent)
+			logger.Info("Publishing all controller events by type", "topic", "events/{event_type}")
+		}
+		if len(eventHooks) > 0 {
+			controller.OnAnyEvent = func(event unifi.EventPacket) {
+				for _, hook := range eventHooks {
+					hook(event)
+				}
+			}
+		}
+
+		// Subscribe to MQTT commands
+		publisher.SubscribeToCommands()
+
+		// Subscribe to external door-contact topics that should dismiss active calls
+		if unifiCfg.Doorbell != nil && len(unifiCfg.Doorbell.DismissOnContact) > 0 {
+			mqttpub.NewContactListener(controller, unifiCfg.Doorbell.DismissOnContact).Start()
+		}
+
+		// Connect to the controller's internal MQTT broker (mTLS) for viewer wake-up
+		if unifiCfg.Viewer != nil && len(unifiCfg.Viewer.WakeOnMotion) > 0 {
+			waker := unifi.NewViewerWaker(
+				unifiCfg.Viewer.Broker,
+				unifiCfg.Viewer.ControllerID,
+				unifiCfg.Viewer.CA,
+				unifiCfg.Viewer.Cert,
+				unifiCfg.Viewer.Key,
+			)
+			waker.OnWake = func(viewerID string) {
+				metricsStore.RecordViewerWake(viewerID)
+			}
+			if err := waker.Connect(); err != nil {
+				logger.Error("Failed to connect viewer waker", "err", err)
+			} else {
+				stops = append(stops, waker.Disconnect)
+				mqttpub.NewMotionListener(controller, waker, unifiCfg.Viewer.WakeOnMotion).Start()
+			}
 		}
 	}
 
 	// Publish initial state for all doors
-	publisher.PublishAllDoors()
-	publisher.PublishMetrics(metricsStore.Snapshot())
-
-	// Periodically refresh metrics so rolling windows decay in the broker.
-	metricsTicker := time.NewTicker(time.Minute)
-	defer metricsTicker.Stop()
-	go func() {
-		for range metricsTicker.C {
-			publisher.PublishMetrics(metricsStore.Snapshot())
+	if publisher != nil && !mqttpub.WaitForBroker() {
+		logger.Warn("MQTT broker not answering yet, initial states are queued until it does")
+	}
+	notifiers.PublishAllDoors()
+	if publisher != nil {
+		if cfg.Discovery != nil {
+			publisher.PublishDiscovery(cfg.Discovery.Prefix)
 		}
-	}()
+		publisher.PublishCapabilities()
+		publisher.PublishGatewayInfo()
+		publisher.PublishMetrics(metricsStore.Snapshot())
 
-	logger.Info("UniFi Access MQTT Gateway is running")
+		stops = append(stops, mqttpub.OnReconnect(publisher.Reconnected))
 
-	// Wait for shutdown signal
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+		// Periodically refresh metrics so rolling windows decay in the broker.
+		metricsTicker := time.NewTicker(time.Minute)
+		stops = append(stops, metricsTicker.Stop)
+		go func() {
+			for range metricsTicker.C {
+				publisher.PublishMetrics(metricsStore.Snapshot())
+			}
+		}()
 
-	logger.Info("Shutting down...")
+		// Follow lock rules so scheduled unlocks aren't mistaken for doors
+		// left unlocked
+		controller.StartLockRuleMonitor(time.Minute)
+
+		// Probe the REST API independently of the WebSocket, so outages of
+		// the notification channel can be told apart from controller outages.
+		probeTicker := time.NewTicker(time.Minute)
+		probeDone := make(chan struct{})
+		stops = append(stops, func() {
+			probeTicker.Stop()
+			close(probeDone)
+		})
+		go func() {
+			last := ""
+			for {
+				r := controller.CheckReachability()
+				if r.Status != last {
+					if r.Status == unifi.ReachabilityOK {
+						logger.Info("Controller REST API reachable", "latency_ms", r.LatencyMs)
+					} else {
+						logger.Warn("Controller REST API check failed", "status", r.Status, "err", r.Error)
+					}
+					last = r.Status
+				}
+				publisher.PublishControllerReachable(r)
+				select {
+				case <-probeTicker.C:
+				case <-probeDone:
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	// Keep connecting in the background; OnRefresh publishes the current
+	// states once connected
+	if warmStarted {
+		go controller.RetryConnect()
+	}
+
+	return controller, stop
 }
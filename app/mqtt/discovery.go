@@ -0,0 +1,332 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mqtt-home/unifi-access-mqtt/config"
+	"github.com/mqtt-home/unifi-access-mqtt/unifi"
+	"github.com/philipparndt/go-logger"
+)
+
+// DefaultDiscoveryPrefix is Home Assistant's default MQTT discovery prefix
+const DefaultDiscoveryPrefix = "homeassistant"
+
+// doorbellAnnounceTopic is the topic below a door that doorbell presses are
+// announced on, for the Home Assistant device trigger
+const doorbellAnnounceTopic = "doorbell/announce"
+
+// discoveryDevice is the device block of a discovery config. Doors are
+// separate devices linked to the controller through via_device.
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+	ViaDevice    string   `json:"via_device,omitempty"`
+}
+
+// discoveryAvailability is one entry of the availability list of an entity
+type discoveryAvailability struct {
+	Topic string `json:"topic"`
+}
+
+// discoveryConfig is the discovery config of a single entity
+type discoveryConfig struct {
+	Name                string                  `json:"name"`
+	UniqueID            string                  `json:"unique_id"`
+	Device              discoveryDevice         `json:"device"`
+	StateTopic          string                  `json:"state_topic"`
+	ValueTemplate       string                  `json:"value_template,omitempty"`
+	JSONAttributesTopic string                  `json:"json_attributes_topic,omitempty"`
+	Availability        []discoveryAvailability `json:"availability,omitempty"`
+	AvailabilityMode    string                  `json:"availability_mode,omitempty"`
+	DeviceClass         string                  `json:"device_class,omitempty"`
+	EntityCategory      string                  `json:"entity_category,omitempty"`
+
+	// binary_sensor
+	PayloadOn  string `json:"payload_on,omitempty"`
+	PayloadOff string `json:"payload_off,omitempty"`
+
+	// lock
+	CommandTopic  string `json:"command_topic,omitempty"`
+	PayloadLock   string `json:"payload_lock,omitempty"`
+	PayloadUnlock string `json:"payload_unlock,omitempty"`
+	StateLocked   string `json:"state_locked,omitempty"`
+	StateUnlocked string `json:"state_unlocked,omitempty"`
+}
+
+// discoveryTrigger is the discovery config of a device_automation trigger.
+// Without a payload filter, every message on the topic fires it.
+type discoveryTrigger struct {
+	AutomationType string          `json:"automation_type"`
+	Topic          string          `json:"topic"`
+	Type           string          `json:"type"`
+	Subtype        string          `json:"subtype"`
+	Device         discoveryDevice `json:"device"`
+}
+
+// doorbellPress is announced on {door}/doorbell/announce when a doorbell rings
+type doorbellPress struct {
+	DoorID    string `json:"door_id"`
+	Name      string `json:"name"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// PublishDiscovery publishes retained Home Assistant MQTT discovery configs
+// below prefix (DefaultDiscoveryPrefix when empty): a lock and a door sensor
+// for every door, a doorbell sensor and a doorbell press trigger for
+// doorbell-capable doors and a connectivity sensor for the controller.
+func (p *Publisher) PublishDiscovery(prefix string) {
+	if prefix == "" {
+		prefix = DefaultDiscoveryPrefix
+	}
+
+	host := p.controller.Host()
+	controllerID := "unifi_access_" + discoveryID(host.MAC)
+	if host.MAC == "" {
+		controllerID = "unifi_access_" + discoveryID(p.prefixOr("controller"))
+	}
+	controllerName := host.Name
+	if controllerName == "" {
+		controllerName = "UniFi Access"
+	}
+	controllerDevice := discoveryDevice{
+		Identifiers:  []string{controllerID},
+		Name:         controllerName,
+		Manufacturer: "Ubiquiti",
+		Model:        "UniFi Access",
+		SWVersion:    host.FirmwareVersion,
+	}
+
+	base := config.Get().MQTT.Topic
+	gatewayAvailability := base + "/" + availabilityTopic
+
+	p.publishDiscoveryConfig(prefix, "binary_sensor", controllerID, discoveryConfig{
+		Name:           "Gateway",
+		UniqueID:       controllerID + "_gateway",
+		Device:         controllerDevice,
+		StateTopic:     gatewayAvailability,
+		DeviceClass:    "connectivity",
+		EntityCategory: "diagnostic",
+		PayloadOn:      "online",
+		PayloadOff:     "offline",
+	})
+
+	doors := p.controller.GetDoors()
+	positionDoors := make(map[string]bool, len(doors))
+	for _, door := range doors {
+		positionDoors[door.Key] = door.HasPositionSensor
+	}
+	p.discoveryMu.Lock()
+	p.discoveryPrefix, p.discovered, p.positionDoors = prefix, true, positionDoors
+	p.discoveryMu.Unlock()
+
+	for _, door := range doors {
+		doorID := p.discoveryDoorID(door)
+		stateTopic := base + "/" + p.topic(p.getDoorTopic(door))
+		device := discoveryDevice{
+			Identifiers:  []string{doorID},
+			Name:         door.TopicName(),
+			Manufacturer: "Ubiquiti",
+			Model:        door.Model,
+			SWVersion:    door.Firmware,
+			ViaDevice:    controllerID,
+		}
+		// Door entities are unavailable when either the gateway or the door's hub is offline
+		availability := []discoveryAvailability{
+			{Topic: gatewayAvailability},
+			{Topic: stateTopic + "/availability"},
+		}
+
+		lock := discoveryConfig{
+			Name:                "Lock",
+			UniqueID:            doorID + "_lock",
+			Device:              device,
+			StateTopic:          stateTopic,
+			ValueTemplate:       "{{ value_json.lock_status }}",
+			JSONAttributesTopic: stateTopic,
+			Availability:        availability,
+			AvailabilityMode:    "all",
+			StateLocked:         "locked",
+			StateUnlocked:       "unlocked",
+		}
+		if !p.isReadOnly(door) {
+			lock.CommandTopic = stateTopic + "/set"
+			lock.PayloadLock = `{"action":"lock"}`
+			lock.PayloadUnlock = `{"action":"unlock"}`
+		}
+		// A lock entity requires a command topic; read-only doors are
+		// exposed as a lock sensor instead
+		if lock.CommandTopic != "" {
+			p.publishDiscoveryConfig(prefix, "lock", doorID, lock)
+		} else {
+			p.publishDiscoveryConfig(prefix, "binary_sensor", doorID+"_lock", discoveryConfig{
+				Name:             "Lock",
+				UniqueID:         doorID + "_lock",
+				Device:           device,
+				StateTopic:       stateTopic,
+				ValueTemplate:    "{{ value_json.lock_status }}",
+				Availability:     availability,
+				AvailabilityMode: "all",
+				DeviceClass:      "lock",
+				PayloadOn:        "unlocked",
+				PayloadOff:       "locked",
+			})
+		}
+
+		doorSensor := discoveryConfig{
+			Name:             "Door",
+			UniqueID:         doorID + "_door",
+			Device:           device,
+			StateTopic:       stateTopic,
+			ValueTemplate:    "{{ value_json.door_status }}",
+			Availability:     availability,
+			AvailabilityMode: "all",
+			DeviceClass:      "door",
+			PayloadOn:        "open",
+			PayloadOff:       "closed",
+		}
+		// With a position sensor the plain position topic is the source
+		if door.HasPositionSensor {
+			doorSensor.StateTopic = stateTopic + "/position"
+			doorSensor.ValueTemplate = ""
+		}
+		p.publishDiscoveryConfig(prefix, "binary_sensor", doorID+"_door", doorSensor)
+
+		if door.Device.HasCapability(unifi.CapabilityDoorbell) {
+			p.publishDiscoveryConfig(prefix, "binary_sensor", doorID+"_doorbell", discoveryConfig{
+				Name:             "Doorbell",
+				UniqueID:         doorID + "_doorbell",
+				Device:           device,
+				StateTopic:       stateTopic + "/doorbell",
+				ValueTemplate:    "{{ value_json.status }}",
+				Availability:     availability,
+				AvailabilityMode: "all",
+				DeviceClass:      "sound",
+				PayloadOn:        "ringing",
+				PayloadOff:       "idle",
+			})
+			p.publishDiscoveryConfig(prefix, "device_automation", doorID+"_doorbell_press", discoveryTrigger{
+				AutomationType: "trigger",
+				Topic:          stateTopic + "/" + doorbellAnnounceTopic,
+				Type:           "doorbell",
+				Subtype:        "press",
+				Device:         device,
+			})
+		}
+	}
+
+	logger.Info("Published Home Assistant discovery", "prefix", prefix, "doors", len(doors))
+}
+
+// republishDiscoveryOnPositionSensor republishes the discovery configs when
+// a door's position sensor appeared after they were published, e.g. with the
+// first position event, so its door sensor reads {door}/position
+func (p *Publisher) republishDiscoveryOnPositionSensor(door *unifi.Door) {
+	p.discoveryMu.Lock()
+	stale := p.discovered && p.positionDoors[door.Key] != door.HasPositionSensor
+	prefix := p.discoveryPrefix
+	p.discoveryMu.Unlock()
+
+	if stale {
+		logger.Info("Door position sensor changed, republishing discovery", "door", door.Name, "position_sensor", door.HasPositionSensor)
+		p.PublishDiscovery(prefix)
+	}
+}
+
+// RemoveDiscovery deletes the discovery configs of a removed door below prefix
+// (DefaultDiscoveryPrefix when empty), so Home Assistant drops its entities
+func (p *Publisher) RemoveDiscovery(door *unifi.Door, prefix string) {
+	if prefix == "" {
+		prefix = DefaultDiscoveryPrefix
+	}
+	doorID := p.discoveryDoorID(door)
+	for _, entity := range []struct{ component, objectID string }{
+		{"lock", doorID},
+		{"binary_sensor", doorID + "_lock"},
+		{"binary_sensor", doorID + "_door"},
+		{"binary_sensor", doorID + "_doorbell"},
+		{"device_automation", doorID + "_doorbell_press"},
+	} {
+		publishAbsolute(fmt.Sprintf("%s/%s/%s/config", prefix, entity.component, entity.objectID), "", true)
+	}
+	logger.Info("Removed Home Assistant discovery", "prefix", prefix, "door", door.Name)
+}
+
+// publishDiscoveryConfig publishes one retained discovery config to
+// {prefix}/{component}/{objectID}/config
+func (p *Publisher) publishDiscoveryConfig(prefix, component, objectID string, cfg any) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		logger.Error("Error marshaling to JSON", "error", err)
+		return
+	}
+	publishAbsolute(fmt.Sprintf("%s/%s/%s/config", prefix, component, objectID), data, retainFlag(p.retain.Discovery, true))
+}
+
+// EnableDeviceTriggers announces doorbell presses on {door}/doorbell/announce
+// for the device triggers published by PublishDiscovery
+func (p *Publisher) EnableDeviceTriggers() {
+	p.deviceTriggers = true
+}
+
+// announceDoorbellPress fires the Home Assistant doorbell trigger once per
+// ring. Rings the gateway triggered itself are not announced.
+func (p *Publisher) announceDoorbellPress(door *unifi.Door) {
+	if !p.deviceTriggers || !door.DoorbellRinging || door.SelfTriggeredRing {
+		return
+	}
+	topic := p.getDoorTopic(door)
+
+	p.triggerMu.Lock()
+	if p.announced[topic].Equal(door.RingStartedAt) {
+		p.triggerMu.Unlock()
+		return
+	}
+	if p.announced == nil {
+		p.announced = make(map[string]time.Time)
+	}
+	p.announced[topic] = door.RingStartedAt
+	p.triggerMu.Unlock()
+
+	p.publishEvent(topic+"/"+doorbellAnnounceTopic, doorbellPress{
+		DoorID:    door.ID,
+		Name:      door.Name,
+		RequestID: door.DoorbellRequestID,
+	})
+}
+
+// prefixOr returns the topic prefix of the publisher, or fallback without one
+func (p *Publisher) prefixOr(fallback string) string {
+	if p.prefix == "" {
+		return fallback
+	}
+	return p.prefix
+}
+
+// discoveryDoorID returns the device and object ID of a door. It is made from
+// the door key, so doors with the same ID in two buildings differ, and from
+// the topic prefix of the controller when there is one.
+func (p *Publisher) discoveryDoorID(door *unifi.Door) string {
+	if p.prefix == "" {
+		return "unifi_access_" + discoveryID(door.Key)
+	}
+	return "unifi_access_" + discoveryID(p.prefix) + "_" + discoveryID(door.Key)
+}
+
+// discoveryID turns an ID into a discovery object ID ([a-z0-9_])
+func discoveryID(id string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(id) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mqtt-home/unifi-access-mqtt/unifi"
+)
+
+// doorbellBootstrap has the hub of a doorbell-capable door
+func doorbellBootstrap() *unifi.BootstrapResponse {
+	bootstrap := frontDoorBootstrap()
+	hub := &bootstrap.Devices[0]
+	hub.Capabilities = append(hub.Capabilities, unifi.CapabilityDoorbell)
+	return bootstrap
+}
+
+func TestDoorbellPressTriggerDiscovery(t *testing.T) {
+	broker := captureBroker(t)
+	p := newTestPublisher(t, doorbellBootstrap())
+
+	p.PublishDiscovery("")
+
+	msg, ok := broker.last("_doorbell_press/config")
+	if !ok {
+		t.Fatal("no doorbell press trigger published")
+	}
+	if !strings.HasPrefix(msg.topic, DefaultDiscoveryPrefix+"/device_automation/") || !msg.retained {
+		t.Errorf("trigger published to %q (retained %v), want a retained device_automation config", msg.topic, msg.retained)
+	}
+	var trigger discoveryTrigger
+	if err := json.Unmarshal([]byte(msg.payload), &trigger); err != nil {
+		t.Fatal(err)
+	}
+	if trigger.AutomationType != "trigger" || trigger.Type != "doorbell" || trigger.Subtype != "press" {
+		t.Errorf("trigger = %+v, want a doorbell press trigger", trigger)
+	}
+	if !strings.HasSuffix(trigger.Topic, "/front-door/"+doorbellAnnounceTopic) {
+		t.Errorf("trigger topic = %q, want the door's announce topic", trigger.Topic)
+	}
+	if len(trigger.Device.Identifiers) != 1 || trigger.Device.Identifiers[0] != p.discoveryDoorID(p.controller.GetDoorByName("Front Door")) {
+		t.Errorf("trigger device = %+v, want the door's device", trigger.Device)
+	}
+}
+
+func TestDoorbellPressAnnouncedOncePerRing(t *testing.T) {
+	broker := captureBroker(t)
+	p := newTestPublisher(t, doorbellBootstrap())
+	door := p.controller.GetDoorByName("Front Door")
+	const announce = "/front-door/" + doorbellAnnounceTopic
+
+	door.DoorbellRinging = true
+	door.DoorbellRequestID = "call-1"
+	door.RingStartedAt = time.Now()
+	p.PublishDoorbellState(door)
+	if n := broker.count(announce); n != 0 {
+		t.Fatalf("press announced %d times without device triggers", n)
+	}
+
+	p.EnableDeviceTriggers()
+	p.PublishDoorbellState(door)
+	p.PublishDoorbellState(door)
+	if n := broker.count(announce); n != 1 {
+		t.Fatalf("press announced %d times for one ring, want 1", n)
+	}
+	msg, _ := broker.last(announce)
+	var press doorbellPress
+	if err := json.Unmarshal([]byte(msg.payload), &press); err != nil {
+		t.Fatal(err)
+	}
+	if press.Name != "Front Door" || press.RequestID != "call-1" || msg.retained {
+		t.Errorf("press = %+v (retained %v), want an unretained press of call-1", press, msg.retained)
+	}
+
+	// A ring the gateway triggered itself isn't a visitor at the door
+	door.DoorbellRequestID = "call-2"
+	door.RingStartedAt = door.RingStartedAt.Add(time.Minute)
+	door.SelfTriggeredRing = true
+	p.PublishDoorbellState(door)
+	if n := broker.count(announce); n != 1 {
+		t.Errorf("self-triggered ring announced, %d presses", n)
+	}
+
+	door.DoorbellRequestID = "call-3"
+	door.RingStartedAt = door.RingStartedAt.Add(time.Minute)
+	door.SelfTriggeredRing = false
+	p.PublishDoorbellState(door)
+	if n := broker.count(announce); n != 2 {
+		t.Errorf("press announced %d times after a second ring, want 2", n)
+	}
+}
@@ -0,0 +1,38 @@
+package mqtt
+
+import (
+	"github.com/mqtt-home/unifi-access-mqtt/config"
+	"github.com/mqtt-home/unifi-access-mqtt/unifi"
+	"github.com/philipparndt/go-logger"
+)
+
+// doorStateTopics are the retained topics of a door, relative to its topic
+var doorStateTopics = []string{"", "/doorbell", "/doorbell/last", "/cycle_count", "/held_open", "/scheduled_unlocked", "/availability", "/position"}
+
+// RemoveDoor clears the retained topics of a removed door by publishing an
+// empty retained payload to each, and republishes the combined door states
+// without it
+func (p *Publisher) RemoveDoor(door *unifi.Door) {
+	doorTopic := p.getDoorTopic(door)
+
+	p.stateMu.Lock()
+	delete(p.lastState, doorTopic)
+	delete(p.lastStateAt, doorTopic)
+	if timer := p.pendingState[doorTopic]; timer != nil {
+		timer.Stop()
+		delete(p.pendingState, doorTopic)
+	}
+	p.stateMu.Unlock()
+
+	p.queueMu.Lock()
+	for _, suffix := range doorStateTopics {
+		delete(p.queued, doorTopic+suffix)
+	}
+	p.queueMu.Unlock()
+
+	for _, suffix := range doorStateTopics {
+		publishAbsolute(config.Get().MQTT.Topic+"/"+p.topic(doorTopic+suffix), "", true)
+	}
+	p.PublishSnapshot()
+	logger.Info("Cleared retained state of removed door", "door", door.Name, "topic", doorTopic)
+}
@@ -0,0 +1,75 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/mqtt-home/unifi-access-mqtt/unifi"
+	"github.com/philipparndt/go-logger"
+)
+
+// SetMinPublishInterval sets the minimum time between two door state
+// publishes of the same door. Changes within the interval are coalesced and
+// the latest state is published when it has passed. Zero disables the limit.
+func (p *Publisher) SetMinPublishInterval(interval time.Duration) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	p.minPublishInterval = interval
+}
+
+// shouldPublishDoorState reports whether the state of a door has to be
+// published now. Identical states are skipped; states arriving within the
+// minimum publish interval are deferred to the end of the interval.
+func (p *Publisher) shouldPublishDoorState(topic string, door *unifi.Door, state DoorState) bool {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return true
+	}
+
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	if p.lastState == nil {
+		p.lastState = make(map[string][]byte)
+		p.lastStateAt = make(map[string]time.Time)
+		p.pendingState = make(map[string]*time.Timer)
+	}
+
+	if bytes.Equal(p.lastState[topic], data) {
+		logger.Debug("Door state unchanged, skipping publish", "topic", topic)
+		return false
+	}
+
+	if wait := p.minPublishInterval - time.Since(p.lastStateAt[topic]); wait > 0 {
+		// Later changes don't restart the timer, so a door that keeps
+		// changing is still published once per interval
+		if p.pendingState[topic] == nil {
+			p.pendingState[topic] = time.AfterFunc(wait, func() {
+				p.stateMu.Lock()
+				delete(p.pendingState, topic)
+				p.stateMu.Unlock()
+				// Publishes the door's state at the end of the interval
+				p.PublishDoorState(door)
+			})
+		}
+		return false
+	}
+
+	p.lastState[topic] = data
+	p.lastStateAt[topic] = time.Now()
+	return true
+}
+
+// forgetDoorStates drops the last published states, so the next publish of
+// every door goes out even when its state is unchanged
+func (p *Publisher) forgetDoorStates() {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	p.lastState = nil
+	p.lastStateAt = nil
+	for _, timer := range p.pendingState {
+		timer.Stop()
+	}
+	p.pendingState = nil
+}
@@ -0,0 +1,46 @@
+package mqtt
+
+import (
+	"time"
+
+	"github.com/mqtt-home/unifi-access-mqtt/buildinfo"
+	"github.com/philipparndt/go-logger"
+)
+
+// gatewayInfoTopic is the retained topic (relative to the base topic and
+// prefix) describing the gateway and its controller
+const gatewayInfoTopic = "gateway/info"
+
+// GatewayInfo describes the gateway and the controller it is connected to
+type GatewayInfo struct {
+	Controller       string    `json:"controller"`                   // Controller name
+	MAC              string    `json:"mac,omitempty"`                // Controller MAC
+	Firmware         string    `json:"firmware,omitempty"`           // Controller firmware
+	Version          string    `json:"version,omitempty"`            // Access application version
+	Doors            int       `json:"doors"`                        // Doors published by the gateway
+	GatewayVersion   string    `json:"gateway_version"`              // Version of this gateway
+	GatewayRevision  string    `json:"gateway_revision,omitempty"`   // VCS revision the gateway was built from
+	GatewayBuildDate string    `json:"gateway_build_date,omitempty"` // Build date of the gateway
+	UpdatedAt        time.Time `json:"updated_at"`                   // Time of the bootstrap this is based on
+}
+
+// PublishGatewayInfo publishes the controller and gateway versions and the
+// door count (retained) to {topic}/gateway/info. Call it after every
+// successful bootstrap so the door count stays accurate.
+func (p *Publisher) PublishGatewayInfo() {
+	host := p.controller.Host()
+	build := buildinfo.Get()
+	info := GatewayInfo{
+		Controller:       host.Name,
+		MAC:              host.MAC,
+		Firmware:         host.FirmwareVersion,
+		Version:          p.controller.Version(),
+		Doors:            len(p.controller.GetDoors()),
+		GatewayVersion:   build.Version,
+		GatewayRevision:  build.Commit,
+		GatewayBuildDate: build.Date,
+		UpdatedAt:        time.Now(),
+	}
+	p.publishRetained(gatewayInfoTopic, info)
+	logger.Debug("Published gateway info", "controller", info.Controller, "doors", info.Doors)
+}
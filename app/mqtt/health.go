@@ -0,0 +1,119 @@
+package mqtt
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mqtt-home/unifi-access-mqtt/config"
+	"github.com/philipparndt/mqtt-gateway/mqtt"
+)
+
+// Health probe topic (relative to the base topic, not retained). The gateway
+// publishes to it and subscribes to it; a probe that comes back proves the
+// broker connection works in both directions.
+const healthTopic = "_bridge/health"
+
+// DefaultHealthProbeInterval is the interval between two health probes
+const DefaultHealthProbeInterval = 15 * time.Second
+
+var (
+	healthMu       sync.Mutex
+	healthInterval time.Duration
+	lastProbeEcho  time.Time
+	onBrokerUp     []func() // called when a probe comes back after the broker was unreachable
+)
+
+// StartHealthProbe publishes a probe every interval (DefaultHealthProbeInterval
+// when zero) and records when it is received back. It returns a function that
+// stops the probe.
+func StartHealthProbe(interval time.Duration) func() {
+	if interval <= 0 {
+		interval = DefaultHealthProbeInterval
+	}
+	healthMu.Lock()
+	healthInterval = interval
+	healthMu.Unlock()
+
+	mqtt.SubscribeRelative(healthTopic, func(_ string, _ []byte) {
+		healthMu.Lock()
+		wasDown := brokerDownLocked()
+		lastProbeEcho = time.Now()
+		callbacks := onBrokerUp
+		healthMu.Unlock()
+
+		if wasDown {
+			for _, fn := range callbacks {
+				go fn()
+			}
+		}
+	})
+
+	probe := func() {
+		publishAbsolute(config.Get().MQTT.Topic+"/"+healthTopic, strconv.FormatInt(time.Now().UnixMilli(), 10), false)
+	}
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		probe()
+		for {
+			select {
+			case <-ticker.C:
+				probe()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// MQTTConnected reports whether a health probe came back from the broker
+// within the last two probe intervals
+func MQTTConnected() bool {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	return healthInterval != 0 && !brokerDownLocked()
+}
+
+// brokerDown reports whether the health probe found the broker unreachable.
+// Without a running probe the broker is assumed to be reachable.
+func brokerDown() bool {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	return brokerDownLocked()
+}
+
+func brokerDownLocked() bool {
+	if healthInterval == 0 {
+		return false
+	}
+	return lastProbeEcho.IsZero() || time.Since(lastProbeEcho) > 2*healthInterval
+}
+
+// onBrokerReachable registers fn to be called whenever the broker becomes
+// reachable again
+func onBrokerReachable(fn func()) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	onBrokerUp = append(onBrokerUp, fn)
+}
+
+// WaitForBroker waits until the health probe has reached the broker, retrying
+// with backoff for a bounded time. It reports whether the broker is reachable.
+func WaitForBroker() bool {
+	delay := 100 * time.Millisecond
+	for attempt := 0; attempt < 7; attempt++ {
+		if !brokerDown() {
+			return true
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return !brokerDown()
+}
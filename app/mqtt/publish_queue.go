@@ -0,0 +1,90 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"expvar"
+
+	"github.com/mqtt-home/unifi-access-mqtt/config"
+	"github.com/philipparndt/go-logger"
+	"github.com/philipparndt/mqtt-gateway/mqtt"
+)
+
+// publishFailures counts the states queued and events dropped while the
+// health probe found the broker unreachable. The MQTT client doesn't report
+// errors of single publishes, so those are not counted.
+var publishFailures = expvar.NewInt("mqtt_publish_failures")
+
+// PublishFailures returns the number of publishes queued or dropped since
+// startup because the broker was unreachable
+func PublishFailures() int64 {
+	return publishFailures.Value()
+}
+
+// queuedPublish is a state waiting to be republished
+type queuedPublish struct {
+	data     []byte
+	retained bool
+}
+
+// publishAbsolute sends a message to the broker; replaced in tests
+var publishAbsolute = mqtt.PublishAbsolute
+
+// sendState publishes a state as JSON, or queues it while the broker is
+// unreachable. Only the most recent state per topic is kept; it is published
+// once the broker can be reached again.
+func (p *Publisher) sendState(topic string, payload any, retained bool) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		logger.Error("Error marshaling to JSON", "error", err)
+		return
+	}
+	p.sendData(topic, data, retained)
+}
+
+// sendPlain publishes a plain-text state like sendState, e.g. "online"
+func (p *Publisher) sendPlain(topic, payload string, retained bool) {
+	p.sendData(topic, []byte(payload), retained)
+}
+
+// sendData publishes an encoded state, or queues it while the broker is
+// unreachable
+func (p *Publisher) sendData(topic string, data []byte, retained bool) {
+	if brokerDown() {
+		p.queuePublish(topic, queuedPublish{data: data, retained: retained})
+		return
+	}
+	publishAbsolute(config.Get().MQTT.Topic+"/"+p.topic(topic), data, retained)
+}
+
+// queuePublish keeps the latest state of a topic until the broker is back
+func (p *Publisher) queuePublish(topic string, msg queuedPublish) {
+	publishFailures.Add(1)
+
+	p.queueMu.Lock()
+	defer p.queueMu.Unlock()
+	if p.queued == nil {
+		p.queued = make(map[string]queuedPublish)
+	}
+	if len(p.queued) == 0 {
+		logger.Warn("MQTT broker unreachable, queueing states until it is back", "topic", p.topic(topic))
+	} else {
+		logger.Debug("MQTT broker unreachable, state queued", "topic", p.topic(topic))
+	}
+	p.queued[topic] = msg
+}
+
+// flushQueued republishes the states queued while the broker was unreachable
+func (p *Publisher) flushQueued() {
+	p.queueMu.Lock()
+	queued := p.queued
+	p.queued = nil
+	p.queueMu.Unlock()
+
+	if len(queued) == 0 {
+		return
+	}
+	logger.Info("MQTT broker reachable again, republishing queued states", "count", len(queued), "failures", publishFailures.Value())
+	for topic, msg := range queued {
+		p.sendData(topic, msg.data, msg.retained)
+	}
+}
@@ -1,17 +1,25 @@
 package mqtt
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/mqtt-home/unifi-access-mqtt/config"
 	"github.com/mqtt-home/unifi-access-mqtt/metrics"
 	"github.com/mqtt-home/unifi-access-mqtt/unifi"
 	"github.com/philipparndt/go-logger"
 	"github.com/philipparndt/mqtt-gateway/mqtt"
 )
 
-// Note: retain is configured globally in the mqtt-gateway library through the config
+// Note: retain is chosen per message category (mqtt.retain in the config, see
+// retainFlag). QoS is always mqtt.qos: the mqtt-gateway library publishes
+// every message with the QoS of its connection and has no per-message QoS.
 
 // DoorState represents the state published to MQTT
 type DoorState struct {
@@ -22,6 +30,25 @@ type DoorState struct {
 	DeviceType  string `json:"device_type"`
 	IsOnline    bool   `json:"is_online"`
 	HasDoorbell bool   `json:"has_doorbell"`
+	Model       string `json:"model,omitempty"`    // Display model of the hub, e.g. "UA Hub"
+	Firmware    string `json:"firmware,omitempty"` // Firmware version of the hub
+	Building    string `json:"building,omitempty"` // Building of the door in the topology
+	Floor       string `json:"floor,omitempty"`    // Floor of the door in the topology
+
+	LastAccessMethod string `json:"last_access_method,omitempty"` // Method of the last granted access, e.g. "face" or "wave"
+
+	Capabilities []string `json:"capabilities"` // What the door supports, e.g. "doorbell", "nfc", "pin"
+
+	ScheduledUnlocked bool   `json:"scheduled_unlocked"`      // Door is inside a keep-unlocked schedule window
+	ScheduleName      string `json:"schedule_name,omitempty"` // Unlock schedule whose window is active
+
+	LastChanged *time.Time `json:"last_changed,omitempty"` // Event time of the last lock/position change
+
+	BatteryLevel   *int `json:"battery_level,omitempty"`   // Reader battery in percent, if reported
+	SignalStrength *int `json:"signal_strength,omitempty"` // Reader RSSI in dBm, if reported
+
+	UnlockDurationSeconds int        `json:"unlock_duration_seconds,omitempty"` // Time the door stays unlocked after an unlock, if reported
+	ExpectedRelockAt      *time.Time `json:"expected_relock_at,omitempty"`      // Expected end of the current unlock
 }
 
 // DoorbellState represents doorbell state published to MQTT
@@ -30,29 +57,288 @@ type DoorbellState struct {
 	Name      string `json:"name"`
 	Status    string `json:"status"` // "ringing" or "idle"
 	RequestID string `json:"request_id,omitempty"`
+
+	SelfTriggered bool `json:"self_triggered"` // Ring was triggered by the gateway (MQTT ring command), not a visitor
+
+	// Call details, only set while ringing
+	DeviceID      string     `json:"device_id,omitempty"`       // Device that started the call
+	RoomID        string     `json:"room_id,omitempty"`         // Room of the call, e.g. for a WebRTC viewer
+	Channel       string     `json:"channel,omitempty"`         // Doorbell channel of the call
+	AgoraChannel  string     `json:"agora_channel,omitempty"`   // Agora channel to join the call from a custom client
+	RingStartedAt *time.Time `json:"ring_started_at,omitempty"` // Time the call started
+}
+
+// DoorbellCall carries the Agora token of a ringing call. It is a call
+// credential, so it is only published as a non-retained event to
+// {door}/doorbell/call, never in the retained doorbell state.
+type DoorbellCall struct {
+	DoorID       string `json:"door_id"`
+	Name         string `json:"name"`
+	RequestID    string `json:"request_id,omitempty"`
+	AgoraChannel string `json:"agora_channel,omitempty"`
+	AgoraToken   string `json:"agora_token"`
+}
+
+// LastDoorbellState is the most recent completed doorbell call of a door,
+// published retained to {door}/doorbell/last
+type LastDoorbellState struct {
+	DoorID        string    `json:"door_id"`
+	Name          string    `json:"name"`
+	RequestID     string    `json:"request_id,omitempty"`
+	DeviceID      string    `json:"device_id,omitempty"` // Device that started the call
+	RoomID        string    `json:"room_id,omitempty"`
+	SelfTriggered bool      `json:"self_triggered"`
+	StartedAt     time.Time `json:"started_at"`
+	EndedAt       time.Time `json:"ended_at"`
+	EndedBy       string    `json:"ended_by"` // "cancel", "dismiss", "answer" or "timeout"
+}
+
+// EventMessage is a raw UniFi Access WebSocket event republished to MQTT
+type EventMessage struct {
+	Event      string                 `json:"event"`
+	ObjectID   string                 `json:"event_object_id,omitempty"`
+	Meta       *unifi.EventMeta       `json:"meta,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+	DataString string                 `json:"data_string,omitempty"`
+	Timestamp  time.Time              `json:"timestamp"`
+}
+
+// EntryState is published when a door is opened shortly after an unlock
+type EntryState struct {
+	DoorID             string    `json:"door_id"`
+	Name               string    `json:"name"`
+	UnlockedAt         time.Time `json:"unlocked_at"`
+	OpenedAt           time.Time `json:"opened_at"`
+	SecondsAfterUnlock float64   `json:"seconds_after_unlock"`
+}
+
+// AccessState is published to {door}/access when an access log reports who
+// unlocked a door, or that an access attempt was denied
+type AccessState struct {
+	DoorID     string    `json:"door_id"`
+	Name       string    `json:"name"`
+	Actor      string    `json:"actor,omitempty"`      // User name, omitted when the controller doesn't report one
+	Method     string    `json:"method,omitempty"`     // "nfc", "pin", "mobile", "face", "wave", "qr", ...
+	Capability string    `json:"capability,omitempty"` // Reader capability of the method, e.g. "hand_wave"
+	Result     string    `json:"result"`               // "granted" or "denied"
+	Reason     string    `json:"reason,omitempty"`     // Denial reason
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// AlarmState is published to {door}/alarm when a door is forced open or a
+// hub or reader is tampered with, and when a forced-open door closes again
+type AlarmState struct {
+	DoorID    string    `json:"door_id"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`   // "forced_open" or "tamper"
+	Active    bool      `json:"active"` // false once a forced-open door is closed again
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// UnlockPulseEvent is published to {door}/unlocked once per unlock
+type UnlockPulseEvent struct {
+	DoorID    string    `json:"door_id"`
+	Name      string    `json:"name"`
+	Actor     string    `json:"actor,omitempty"`
+	Source    string    `json:"source"` // "gateway" or "remote"
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ErrorState is published to {door}/error when a command for a door is rejected
+type ErrorState struct {
+	DoorID string `json:"door_id"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Error  string `json:"error"`
+}
+
+// Availability topic (relative to the base topic); shared with the last will
+// registered by the mqtt-gateway library
+const availabilityTopic = "bridge/state"
+
+// Bulk command topics (relative to the base topic)
+const (
+	bulkCommandTopic = "_bridge/bulk/set"
+	bulkResultTopic  = "_bridge/bulk/result"
+)
+
+// Group commands are published to {groupCommandPrefix}{name}/set (relative to
+// the base topic)
+const groupCommandPrefix = "group/"
+
+// Refresh command topic (relative to the base topic). It is below _bridge so
+// it doesn't collide with a door named "refresh".
+const refreshCommandTopic = "_bridge/refresh/set"
+
+// DefaultDoorsTopic is the topic (relative to the base topic) of the combined
+// door state array
+const DefaultDoorsTopic = "doors"
+
+// Door changes within this interval are coalesced into one snapshot publish
+const snapshotDebounce = time.Second
+
+// A snapshot is published at the latest this long after the first coalesced
+// change, even when doors keep changing
+const snapshotMaxDelay = 5 * time.Second
+
+// CycleCountState is the relay actuation count of a door
+type CycleCountState struct {
+	DoorID string `json:"door_id"`
+	Name   string `json:"name"`
+	Count  int64  `json:"count"`
+	Source string `json:"source"` // "device" (reported by the hub) or "internal" (unlocks issued by the gateway since start)
+}
+
+// HeldOpenState tells whether a door has been open longer than allowed
+type HeldOpenState struct {
+	DoorID   string     `json:"door_id"`
+	Name     string     `json:"name"`
+	HeldOpen bool       `json:"held_open"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+}
+
+// ScheduleState tells whether a door is unlocked on purpose by its schedule
+type ScheduleState struct {
+	DoorID            string     `json:"door_id"`
+	Name              string     `json:"name"`
+	ScheduledUnlocked bool       `json:"scheduled_unlocked"`
+	Rule              string     `json:"rule,omitempty"`
+	Until             *time.Time `json:"until,omitempty"`
+	Schedule          string     `json:"schedule,omitempty"`
 }
 
 // Command represents an incoming MQTT command
 type Command struct {
-	Action string `json:"action"` // "unlock", "lock"
+	Action          string   `json:"action"`                     // "unlock", "lock"
+	Target          string   `json:"target,omitempty"`           // Device to reboot: "hub" (default) or "reader"
+	DurationSeconds int      `json:"duration_seconds,omitempty"` // Keep the door unlocked this long instead of its unlock duration
+	RequestID       string   `json:"request_id,omitempty"`       // Echoed in the command result, to correlate it with the command
+	Token           string   `json:"token,omitempty"`            // One-time unlock token; the unlock is rejected unless it is valid and unused
+	Viewers         []string `json:"viewers,omitempty"`          // Viewer device IDs to call; empty = the doorbell viewers of the door
+}
+
+// BulkCommand is a command for several doors at once
+type BulkCommand struct {
+	Action string   `json:"action"`          // "unlock" or "dismiss"
+	Doors  []string `json:"doors,omitempty"` // Door topic names or IDs; empty = all ringing doors for "dismiss"
+}
+
+// BulkResult reports the per-door outcome of a bulk or group command
+type BulkResult struct {
+	Action    string             `json:"action"`
+	Group     string             `json:"group,omitempty"`      // Group of a group command
+	RequestID string             `json:"request_id,omitempty"` // request_id of a group command, if it had one
+	Results   []unifi.DoorResult `json:"results"`
+}
+
+// CommandResult is published to {door}/set/result after a command was executed
+type CommandResult struct {
+	Action    string `json:"action"`
+	Result    string `json:"result"` // "ok", "error" or "already_ringing"
+	Error     string `json:"error,omitempty"`
+	RequestID string `json:"request_id,omitempty"` // request_id of the command, if it had one
 }
 
 // Publisher handles MQTT publishing and subscribing
 type Publisher struct {
 	controller *unifi.Controller
+	prefix     string // topic prefix below the base topic ("" = none), e.g. the controller name
+
+	defaultAction string              // action for commands with an empty payload ("" = ignore them)
+	allowReboot   bool                // accept the reboot action
+	retain        config.RetainConfig // retain flag per message category
+
+	doorsTopic    string // topic of the combined door state array
+	keyedSnapshot bool   // also publish the door states keyed by topic name to _bridge/snapshot
+	snapshotTimer *time.Timer
+	snapshotSince time.Time // first change coalesced into the pending snapshot
+	snapshotMu    sync.Mutex
+
+	// Latest state per topic queued while the broker is unreachable
+	queued  map[string]queuedPublish
+	queueMu sync.Mutex
+
+	// Home Assistant doorbell triggers: ring start of the last announced
+	// press per door topic, so a republished ring isn't announced twice
+	deviceTriggers bool
+	announced      map[string]time.Time
+	triggerMu      sync.Mutex
+
+	// Home Assistant discovery: prefix of the last PublishDiscovery and
+	// the doors it published with a position sensor, by door key
+	discoveryPrefix string
+	discovered      bool
+	positionDoors   map[string]bool
+	discoveryMu     sync.Mutex
+
+	// Last published door state per topic, to skip duplicate publishes
+	minPublishInterval time.Duration
+	lastState          map[string][]byte
+	lastStateAt        map[string]time.Time
+	pendingState       map[string]*time.Timer
+	stateMu            sync.Mutex
 }
 
 // NewPublisher creates a new MQTT publisher
 func NewPublisher(controller *unifi.Controller) *Publisher {
-	return &Publisher{
+	p := &Publisher{
 		controller: controller,
+		doorsTopic: DefaultDoorsTopic,
 	}
+	onBrokerReachable(p.flushQueued)
+	return p
+}
+
+// SetTopicPrefix places all topics of this publisher below {topic}/{prefix},
+// so several controllers can share one base topic. The gateway availability
+// topic is not prefixed.
+func (p *Publisher) SetTopicPrefix(prefix string) {
+	p.prefix = unifi.SanitizeName(prefix)
+}
+
+// SetRetain sets the retain flag per message category
+func (p *Publisher) SetRetain(retain config.RetainConfig) {
+	p.retain = retain
+}
+
+// SetAllowReboot enables the reboot action. It is rejected by default since
+// a reboot takes the device offline.
+func (p *Publisher) SetAllowReboot(allow bool) {
+	p.allowReboot = allow
+}
+
+// isReadOnly reports whether unlock and lock commands are rejected for a door
+func (p *Publisher) isReadOnly(door *unifi.Door) bool {
+	return p.controller.IsReadOnly(door)
 }
 
 // PublishDoorState publishes the current state of a door
 func (p *Publisher) PublishDoorState(door *unifi.Door) {
 	topic := p.getDoorTopic(door)
+	state := newDoorState(door)
+	if !p.shouldPublishDoorState(topic, door, state) {
+		return
+	}
+
+	logger.Info("Publishing door state", "topic", topic, "lock", door.LockStatus, "door", door.DoorStatus)
+	p.publish(topic, state)
+	p.republishDiscoveryOnPositionSensor(door)
+	p.publishPosition(door)
+	p.scheduleSnapshot()
+}
 
+// publishPosition publishes the door position as plain "open" or "closed" to
+// {door}/position, for doors with a position sensor
+func (p *Publisher) publishPosition(door *unifi.Door) {
+	if !door.HasPositionSensor {
+		return
+	}
+	topic := fmt.Sprintf("%s/position", p.getDoorTopic(door))
+	p.sendPlain(topic, door.DoorStatus, retainFlag(p.retain.State, config.Get().MQTT.Retain))
+}
+
+// newDoorState builds the published state of a door
+func newDoorState(door *unifi.Door) DoorState {
 	state := DoorState{
 		DoorID:      door.ID,
 		Name:        door.Name,
@@ -61,10 +347,108 @@ func (p *Publisher) PublishDoorState(door *unifi.Door) {
 		DeviceType:  door.Device.DeviceType,
 		IsOnline:    door.IsOnline,
 		HasDoorbell: door.Device.HasCapability(unifi.CapabilityDoorbell),
+		Model:       door.Model,
+		Firmware:    door.Firmware,
+		Building:    door.BuildingName,
+		Floor:       door.FloorName,
+
+		LastAccessMethod: door.LastAccessMethod,
+
+		Capabilities: door.Capabilities,
+
+		ScheduledUnlocked: door.ScheduledUnlocked,
+		ScheduleName:      door.ScheduleName,
+	}
+	if !door.LastChangedAt.IsZero() {
+		changed := door.LastChangedAt
+		state.LastChanged = &changed
+	}
+	state.UnlockDurationSeconds = door.UnlockDurationSeconds
+	if door.LockStatus == "unlocked" && !door.ExpectedRelockAt.IsZero() {
+		relock := door.ExpectedRelockAt
+		state.ExpectedRelockAt = &relock
 	}
+	if door.HasBattery {
+		battery := door.BatteryLevel
+		state.BatteryLevel = &battery
+	}
+	if door.HasSignal {
+		signal := door.SignalStrength
+		state.SignalStrength = &signal
+	}
+	return state
+}
 
-	logger.Info("Publishing door state", "topic", topic, "lock", door.LockStatus, "door", door.DoorStatus)
-	p.publish(topic, state)
+// SetDefaultAction sets the action executed for commands with an empty
+// payload, e.g. "unlock". Empty payloads are rejected when not set.
+func (p *Publisher) SetDefaultAction(action string) {
+	p.defaultAction = action
+}
+
+// SetDoorsTopic sets the topic of the combined door state array. An empty
+// topic keeps the default "doors".
+func (p *Publisher) SetDoorsTopic(topic string) {
+	if topic == "" {
+		topic = DefaultDoorsTopic
+	}
+	p.snapshotMu.Lock()
+	defer p.snapshotMu.Unlock()
+	p.doorsTopic = topic
+}
+
+// EnableKeyedSnapshot additionally publishes the door states to
+// _bridge/snapshot as one object keyed by door topic name.
+func (p *Publisher) EnableKeyedSnapshot() {
+	p.snapshotMu.Lock()
+	defer p.snapshotMu.Unlock()
+	p.keyedSnapshot = true
+}
+
+// scheduleSnapshot (re)starts the debounce timer for the snapshot topics. The
+// timer never runs past snapshotMaxDelay after the first pending change.
+func (p *Publisher) scheduleSnapshot() {
+	p.snapshotMu.Lock()
+	defer p.snapshotMu.Unlock()
+
+	if p.snapshotTimer != nil {
+		p.snapshotTimer.Stop()
+	} else {
+		p.snapshotSince = time.Now()
+	}
+	delay := min(snapshotDebounce, time.Until(p.snapshotSince.Add(snapshotMaxDelay)))
+	p.snapshotTimer = time.AfterFunc(max(delay, 0), p.PublishSnapshot)
+}
+
+// PublishSnapshot publishes the state of all doors as one retained array,
+// sorted by door topic name.
+func (p *Publisher) PublishSnapshot() {
+	p.snapshotMu.Lock()
+	if p.snapshotTimer != nil {
+		p.snapshotTimer.Stop()
+		p.snapshotTimer = nil
+	}
+	topic, keyed := p.doorsTopic, p.keyedSnapshot
+	p.snapshotMu.Unlock()
+
+	doors := p.controller.GetDoors()
+	sort.Slice(doors, func(i, j int) bool {
+		return p.getDoorTopic(doors[i]) < p.getDoorTopic(doors[j])
+	})
+
+	states := make([]DoorState, 0, len(doors))
+	for _, door := range doors {
+		states = append(states, newDoorState(door))
+	}
+	p.publishRetained(topic, states)
+
+	if keyed {
+		snapshot := make(map[string]DoorState, len(doors))
+		for i, door := range doors {
+			snapshot[p.getDoorTopic(door)] = states[i]
+		}
+		p.publishRetained("_bridge/snapshot", snapshot)
+	}
+	logger.Debug("Published door snapshot", "topic", topic, "count", len(states))
 }
 
 // PublishDoorbellState publishes the doorbell state
@@ -81,10 +465,76 @@ func (p *Publisher) PublishDoorbellState(door *unifi.Door) {
 		Name:      door.Name,
 		Status:    status,
 		RequestID: door.DoorbellRequestID,
+
+		SelfTriggered: door.SelfTriggeredRing,
+	}
+	if door.DoorbellRinging {
+		state.DeviceID = door.DoorbellDeviceID
+		state.RoomID = door.DoorbellRoomID
+		state.Channel = door.DoorbellChannel
+		state.AgoraChannel = door.AgoraChannel
+		if !door.RingStartedAt.IsZero() {
+			startedAt := door.RingStartedAt
+			state.RingStartedAt = &startedAt
+		}
 	}
 
-	p.publish(topic, state)
+	p.sendState(topic, state, retainFlag(p.retain.Doorbell, config.Get().MQTT.Retain))
 	logger.Debug("Published doorbell state", "door", door.Name, "status", status)
+	p.announceDoorbellPress(door)
+	if door.DoorbellRinging {
+		p.publishCallToken(door)
+	} else {
+		p.publishLastRing(door)
+	}
+}
+
+// publishCallToken publishes the Agora token of a ringing call (not retained)
+// to {door}/doorbell/call, when the controller sent one
+func (p *Publisher) publishCallToken(door *unifi.Door) {
+	if door.AgoraToken == "" {
+		return
+	}
+	p.publishEvent(p.getDoorTopic(door)+"/doorbell/call", DoorbellCall{
+		DoorID:       door.ID,
+		Name:         door.Name,
+		RequestID:    door.DoorbellRequestID,
+		AgoraChannel: door.AgoraChannel,
+		AgoraToken:   door.AgoraToken,
+	})
+}
+
+// publishLastRing publishes the last completed call of a door (retained) to
+// {door}/doorbell/last, so it is known while the doorbell is idle. Nothing is
+// published before the first call ended.
+func (p *Publisher) publishLastRing(door *unifi.Door) {
+	last := door.LastRing
+	if last == nil {
+		return
+	}
+	p.publishRetained(p.getDoorTopic(door)+"/doorbell/last", LastDoorbellState{
+		DoorID:        door.ID,
+		Name:          door.Name,
+		RequestID:     last.RequestID,
+		DeviceID:      last.DeviceID,
+		RoomID:        last.RoomID,
+		SelfTriggered: last.SelfTriggered,
+		StartedAt:     last.StartedAt,
+		EndedAt:       last.EndedAt,
+		EndedBy:       last.EndedBy,
+	})
+}
+
+// PublishAvailability publishes "online" or "offline" (retained) to
+// {topic}/bridge/state. The mqtt-gateway library registers the same topic as
+// last will with "offline", so the gateway also shows offline when it dies.
+// The topic is shared by all controllers of the gateway.
+func PublishAvailability(online bool) {
+	state := "offline"
+	if online {
+		state = "online"
+	}
+	publishAbsolute(config.Get().MQTT.Topic+"/"+availabilityTopic, state, true)
 }
 
 // PublishMetrics publishes the current metrics snapshot.
@@ -92,6 +542,168 @@ func (p *Publisher) PublishMetrics(snap metrics.Snapshot) {
 	p.publish("metrics", snap)
 }
 
+// PublishCapabilities publishes the capability report of all readers.
+func (p *Publisher) PublishCapabilities() {
+	p.publish("_bridge/capabilities", p.controller.GetCapabilityReports())
+}
+
+// PublishControllerReachable publishes the result of the REST API probe.
+func (p *Publisher) PublishControllerReachable(r unifi.Reachability) {
+	p.publish("_bridge/controller_reachable", r)
+}
+
+// PublishEvent republishes a raw controller event to the debug event topic.
+func (p *Publisher) PublishEvent(event unifi.EventPacket) {
+	p.publishEvent("_bridge/events", EventMessage{
+		Event:      event.Event,
+		ObjectID:   event.EventObjectID,
+		Meta:       event.Meta,
+		Data:       event.Data,
+		DataString: event.DataString,
+		Timestamp:  event.Timestamp,
+	})
+}
+
+// PublishRawEvent republishes a raw controller event to events/{event_type},
+// so automations can subscribe to single event types.
+func (p *Publisher) PublishRawEvent(event unifi.EventPacket) {
+	p.publishEvent("events/"+rawEventTopic(event.Event), EventMessage{
+		Event:      event.Event,
+		ObjectID:   event.EventObjectID,
+		Meta:       event.Meta,
+		Data:       event.Data,
+		DataString: event.DataString,
+		Timestamp:  event.Timestamp,
+	})
+}
+
+// rawEventTopic turns an event type into a single topic level
+func rawEventTopic(eventType string) string {
+	if eventType == "" {
+		return "unknown"
+	}
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(eventType)
+}
+
+// PublishDoorEntry publishes an entry event: the door was opened after an unlock.
+func (p *Publisher) PublishDoorEntry(door *unifi.Door, entry unifi.EntryEvent) {
+	topic := fmt.Sprintf("%s/entry", p.getDoorTopic(door))
+	p.publishEvent(topic, EntryState{
+		DoorID:             door.ID,
+		Name:               door.Name,
+		UnlockedAt:         entry.UnlockedAt,
+		OpenedAt:           entry.OpenedAt,
+		SecondsAfterUnlock: entry.OpenedAt.Sub(entry.UnlockedAt).Seconds(),
+	})
+	logger.Info("Published door entry", "door", door.Name)
+}
+
+// PublishDoorAccess publishes who unlocked a door and how, or a denied attempt
+func (p *Publisher) PublishDoorAccess(door *unifi.Door, access unifi.AccessEvent) {
+	topic := fmt.Sprintf("%s/access", p.getDoorTopic(door))
+	p.publishEvent(topic, AccessState{
+		DoorID:     door.ID,
+		Name:       door.Name,
+		Actor:      access.Actor,
+		Method:     access.Method,
+		Capability: access.Capability,
+		Result:     access.Result,
+		Reason:     access.Reason,
+		Timestamp:  access.At,
+	})
+	logger.Debug("Published door access", "door", door.Name, "actor", access.Actor, "method", access.Method, "result", access.Result)
+
+	// A granted access changes last_access_method of the door state
+	if access.Result == unifi.AccessGranted {
+		p.PublishDoorState(door)
+	}
+}
+
+// PublishDoorUnlockPulse publishes a momentary unlock event (not retained) to
+// {door}/unlocked
+func (p *Publisher) PublishDoorUnlockPulse(door *unifi.Door, pulse unifi.UnlockPulse) {
+	topic := fmt.Sprintf("%s/unlocked", p.getDoorTopic(door))
+	p.publishEvent(topic, UnlockPulseEvent{
+		DoorID:    door.ID,
+		Name:      door.Name,
+		Actor:     pulse.Actor,
+		Source:    pulse.Source,
+		Timestamp: pulse.At,
+	})
+	logger.Debug("Published door unlock pulse", "door", door.Name, "source", pulse.Source)
+}
+
+// PublishDoorAlarm publishes a raised or cleared door alarm
+func (p *Publisher) PublishDoorAlarm(door *unifi.Door, alarm unifi.AlarmEvent) {
+	topic := fmt.Sprintf("%s/alarm", p.getDoorTopic(door))
+	p.publishEvent(topic, AlarmState{
+		DoorID:    door.ID,
+		Name:      door.Name,
+		Type:      alarm.Type,
+		Active:    alarm.Active,
+		Timestamp: alarm.At,
+	})
+	logger.Debug("Published door alarm", "door", door.Name, "type", alarm.Type, "active", alarm.Active)
+}
+
+// PublishCycleCount publishes the relay cycle count of a door
+func (p *Publisher) PublishCycleCount(door *unifi.Door) {
+	if door.CycleCountSource == "" {
+		return
+	}
+	topic := fmt.Sprintf("%s/cycle_count", p.getDoorTopic(door))
+	p.publish(topic, CycleCountState{
+		DoorID: door.ID,
+		Name:   door.Name,
+		Count:  door.CycleCount,
+		Source: door.CycleCountSource,
+	})
+}
+
+// PublishScheduleState publishes whether the door is scheduled-unlocked
+func (p *Publisher) PublishScheduleState(door *unifi.Door) {
+	state := ScheduleState{
+		DoorID:            door.ID,
+		Name:              door.Name,
+		ScheduledUnlocked: door.ScheduledUnlocked,
+		Rule:              door.LockRule,
+		Schedule:          door.ScheduleName,
+	}
+	if !door.LockRuleEndsAt.IsZero() {
+		until := door.LockRuleEndsAt
+		state.Until = &until
+	} else if door.ScheduledUnlocked && !door.ScheduleEndsAt.IsZero() {
+		until := door.ScheduleEndsAt
+		state.Until = &until
+	}
+	p.publish(fmt.Sprintf("%s/scheduled_unlocked", p.getDoorTopic(door)), state)
+}
+
+// PublishHeldOpen publishes whether a door is held open
+func (p *Publisher) PublishHeldOpen(door *unifi.Door) {
+	state := HeldOpenState{
+		DoorID:   door.ID,
+		Name:     door.Name,
+		HeldOpen: door.HeldOpen,
+	}
+	if door.HeldOpen && !door.OpenedAt.IsZero() {
+		openedAt := door.OpenedAt
+		state.OpenedAt = &openedAt
+	}
+	p.publish(fmt.Sprintf("%s/held_open", p.getDoorTopic(door)), state)
+}
+
+// PublishDoorAvailability publishes "online" or "offline" (retained) to
+// {door}/availability, so a single lock can show unavailable while the
+// gateway is still online
+func (p *Publisher) PublishDoorAvailability(door *unifi.Door) {
+	state := "offline"
+	if door.IsOnline {
+		state = "online"
+	}
+	p.sendPlain(fmt.Sprintf("%s/availability", p.getDoorTopic(door)), state, true)
+}
+
 // PublishAllDoors publishes state for all doors
 func (p *Publisher) PublishAllDoors() {
 	doors := p.controller.GetDoors()
@@ -101,7 +713,11 @@ func (p *Publisher) PublishAllDoors() {
 		if door.Device.HasCapability(unifi.CapabilityDoorbell) {
 			p.PublishDoorbellState(door)
 		}
+		p.PublishCycleCount(door)
+		p.PublishHeldOpen(door)
+		p.PublishDoorAvailability(door)
 	}
+	p.PublishSnapshot()
 }
 
 // SubscribeToCommands subscribes to command topics for all doors
@@ -109,11 +725,172 @@ func (p *Publisher) SubscribeToCommands() {
 	// Subscribe to wildcard topic for all doors (base topic is added by mqtt library)
 	topic := "+/set"
 
-	mqtt.SubscribeRelative(topic, func(topic string, payload []byte) {
+	mqtt.SubscribeRelative(p.topic(topic), func(topic string, payload []byte) {
 		p.handleCommand(topic, payload)
 	})
 
-	logger.Info("Subscribed to command topic", "topic", topic)
+	logger.Info("Subscribed to command topic", "topic", p.topic(topic))
+
+	// Commands addressed by door ID are immune to renames in the UniFi UI
+	idTopic := "id/+/set"
+
+	mqtt.SubscribeRelative(p.topic(idTopic), func(topic string, payload []byte) {
+		p.handleIDCommand(topic, payload)
+	})
+
+	logger.Info("Subscribed to command topic", "topic", p.topic(idTopic))
+
+	mqtt.SubscribeRelative(p.topic(bulkCommandTopic), func(topic string, payload []byte) {
+		p.handleBulkCommand(payload)
+	})
+
+	logger.Info("Subscribed to command topic", "topic", p.topic(bulkCommandTopic))
+
+	groupTopic := groupCommandPrefix + "+/set"
+
+	mqtt.SubscribeRelative(p.topic(groupTopic), func(topic string, payload []byte) {
+		p.handleGroupCommand(topic, payload)
+	})
+
+	logger.Info("Subscribed to command topic", "topic", p.topic(groupTopic))
+
+	mqtt.SubscribeRelative(p.topic(refreshCommandTopic), func(topic string, payload []byte) {
+		p.handleRefreshCommand(payload)
+	})
+
+	logger.Info("Subscribed to command topic", "topic", p.topic(refreshCommandTopic))
+}
+
+// handleRefreshCommand bootstraps the controller again. An empty payload is
+// accepted as well as {"action":"refresh"}.
+func (p *Publisher) handleRefreshCommand(payload []byte) {
+	if len(payload) > 0 {
+		var cmd Command
+		if err := json.Unmarshal(payload, &cmd); err != nil {
+			logger.Warn("Invalid refresh command payload", "payload", string(payload))
+			return
+		}
+		if !strings.EqualFold(cmd.Action, "refresh") {
+			logger.Warn("Unknown refresh action", "action", cmd.Action)
+			return
+		}
+	}
+
+	logger.Info("Received refresh command")
+	if err := p.controller.Refresh(); err != nil {
+		logger.Error("Failed to refresh doors", "err", err)
+	}
+}
+
+// handleBulkCommand executes a command for several doors and publishes the
+// result of each door, so one failing door doesn't hide the others.
+func (p *Publisher) handleBulkCommand(payload []byte) {
+	var cmd BulkCommand
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		logger.Warn("Invalid bulk command payload", "payload", string(payload))
+		return
+	}
+
+	logger.Info("Received bulk command", "action", cmd.Action, "doors", cmd.Doors)
+
+	var results []unifi.DoorResult
+	var doors []*unifi.Door
+	for _, name := range cmd.Doors {
+		door := p.controller.FindDoor(name)
+		if door == nil {
+			results = append(results, unifi.DoorResult{Door: name, Error: "unknown door"})
+			continue
+		}
+		if strings.EqualFold(cmd.Action, "unlock") {
+			if reason := p.rejectBulkUnlock(door); reason != "" {
+				results = append(results, unifi.DoorResult{Door: name, Error: reason})
+				continue
+			}
+		}
+		doors = append(doors, door)
+	}
+
+	switch strings.ToLower(cmd.Action) {
+	case "unlock":
+		if len(doors) == 0 && len(results) == 0 {
+			logger.Warn("Bulk unlock without doors ignored")
+			return
+		}
+		results = append(results, p.controller.UnlockDoors(doors)...)
+	case "dismiss", "cancel", "end_call":
+		if len(doors) > 0 || len(results) == 0 {
+			results = append(results, p.controller.DismissDoorbellCalls(doors)...)
+		}
+	default:
+		logger.Warn("Unknown bulk action", "action", cmd.Action)
+		return
+	}
+
+	if results == nil {
+		results = []unifi.DoorResult{}
+	}
+	p.publishEvent(bulkResultTopic, BulkResult{Action: cmd.Action, Results: results})
+}
+
+// rejectBulkUnlock returns why a door of a bulk or group unlock is skipped,
+// or "" when it may be unlocked
+func (p *Publisher) rejectBulkUnlock(door *unifi.Door) string {
+	if p.isReadOnly(door) {
+		logger.Warn("Rejected bulk unlock for read-only door", "door", door.Name)
+		return "door is read-only"
+	}
+	return ""
+}
+
+// handleGroupCommand unlocks the doors of a configured group:
+// baseTopic/group/{name}/set. Every door is tried; the result of each is
+// published to group/{name}/set/result.
+func (p *Publisher) handleGroupCommand(topic string, payload []byte) {
+	parts := strings.Split(topic, "/")
+	if len(parts) < 3 {
+		logger.Warn("Invalid command topic", "topic", topic)
+		return
+	}
+	group := parts[len(parts)-2]
+
+	var cmd Command
+	if len(bytes.TrimSpace(payload)) == 0 && p.defaultAction != "" {
+		cmd.Action = p.defaultAction
+	} else if err := json.Unmarshal(payload, &cmd); err != nil {
+		logger.Warn("Invalid group command payload", "payload", string(payload))
+		return
+	}
+	if !strings.EqualFold(cmd.Action, "unlock") {
+		logger.Warn("Unknown group action", "group", group, "action", cmd.Action)
+		return
+	}
+
+	doors, results, err := p.controller.GroupDoors(group)
+	if err != nil {
+		logger.Warn("Unknown door group in command", "group", group)
+		return
+	}
+	logger.Info("Received group command", "group", group, "action", cmd.Action, "doors", len(doors), "request_id", cmd.RequestID)
+
+	var unlock []*unifi.Door
+	for _, door := range doors {
+		if reason := p.rejectBulkUnlock(door); reason != "" {
+			results = append(results, unifi.DoorResult{Door: p.getDoorTopic(door), Error: reason})
+			continue
+		}
+		unlock = append(unlock, door)
+	}
+	results = append(results, p.controller.UnlockDoors(unlock)...)
+
+	if results == nil {
+		results = []unifi.DoorResult{}
+	}
+	p.publishEvent(groupCommandPrefix+group+"/set/result", BulkResult{
+		Action:    strings.ToLower(cmd.Action),
+		Group:     group,
+		RequestID: cmd.RequestID,
+		Results:   results,
+	})
 }
 
 // handleCommand processes incoming MQTT commands
@@ -131,7 +908,7 @@ func (p *Publisher) handleCommand(topic string, payload []byte) {
 	// Find door by sanitized name
 	var matchedDoor *unifi.Door
 	for _, door := range p.controller.GetDoors() {
-		if unifi.SanitizeName(door.Name) == doorName {
+		if unifi.SanitizeName(door.TopicName()) == doorName {
 			matchedDoor = door
 			break
 		}
@@ -142,44 +919,231 @@ func (p *Publisher) handleCommand(topic string, payload []byte) {
 		return
 	}
 
+	p.executeCommand(topic, matchedDoor, payload)
+}
+
+// handleIDCommand processes commands addressed by door ID: baseTopic/id/{doorID}/set
+func (p *Publisher) handleIDCommand(topic string, payload []byte) {
+	parts := strings.Split(topic, "/")
+	if len(parts) < 3 {
+		logger.Warn("Invalid command topic", "topic", topic)
+		return
+	}
+
+	doorID := parts[len(parts)-2]
+	door := p.controller.GetDoor(doorID)
+	if door == nil {
+		logger.Warn("Unknown door ID in command", "id", doorID)
+		return
+	}
+
+	p.executeCommand(topic, door, payload)
+}
+
+// executeCommand parses and executes a command for a door. The outcome is
+// published to {door}/set/result, with the request_id of the command.
+func (p *Publisher) executeCommand(topic string, matchedDoor *unifi.Door, payload []byte) {
 	var cmd Command
-	if err := json.Unmarshal(payload, &cmd); err != nil {
+	if len(bytes.TrimSpace(payload)) == 0 && p.defaultAction != "" {
+		// Buttons that publish an empty payload trigger the default action
+		cmd.Action = p.defaultAction
+	} else if err := json.Unmarshal(payload, &cmd); err != nil {
 		logger.Warn("Invalid command payload", "payload", string(payload))
 		return
 	}
 
-	logger.Info("Received command", "door", matchedDoor.Name, "action", cmd.Action)
+	logger.Info("Received command", "door", matchedDoor.Name, "action", cmd.Action, "request_id", cmd.RequestID)
 
-	switch strings.ToLower(cmd.Action) {
+	action := strings.ToLower(cmd.Action)
+	if (action == "unlock" || action == "lock" || action == "reboot") && p.isReadOnly(matchedDoor) {
+		logger.Warn("Rejected command for read-only door", "door", matchedDoor.Name, "action", cmd.Action)
+		p.rejectCommand(matchedDoor, cmd, "door is read-only")
+		return
+	}
+
+	switch action {
 	case "unlock":
-		if err := p.controller.UnlockDoor(matchedDoor); err != nil {
+		var err error
+		if cmd.Token != "" {
+			err = p.controller.UnlockWithToken(matchedDoor, cmd.Token, cmd.DurationSeconds)
+			if errors.Is(err, unifi.ErrInvalidUnlockToken) {
+				p.rejectCommand(matchedDoor, cmd, err.Error())
+				return
+			}
+		} else {
+			err = p.controller.UnlockForDuration(matchedDoor, cmd.DurationSeconds)
+		}
+		if err != nil && !errors.Is(err, unifi.ErrUnlockRateLimited) {
 			logger.Error("Failed to unlock door", "door", matchedDoor.Name, "err", err)
 		}
+		p.publishCommandResult(matchedDoor, commandResult(cmd, err))
 	case "lock":
-		// Note: UniFi Access doesn't support explicit lock commands via API
-		// The door locks automatically after a configured timeout
-		logger.Warn("Lock command not supported - doors lock automatically after unlock timeout")
+		err := p.controller.LockDoor(matchedDoor)
+		if errors.Is(err, unifi.ErrLockUnsupported) {
+			// Older firmware has no lock endpoint; the door locks
+			// automatically after the configured timeout
+			logger.Warn("Lock command not supported - doors lock automatically after unlock timeout")
+		} else if err != nil {
+			logger.Error("Failed to lock door", "door", matchedDoor.Name, "err", err)
+		}
+		p.publishCommandResult(matchedDoor, commandResult(cmd, err))
 	case "dismiss", "cancel", "end_call":
-		if err := p.controller.DismissDoorbellCall(matchedDoor); err != nil {
+		err := p.controller.DismissDoorbellCall(matchedDoor)
+		if err != nil {
 			logger.Error("Failed to dismiss doorbell call", "door", matchedDoor.Name, "err", err)
 		}
+		p.publishCommandResult(matchedDoor, commandResult(cmd, err))
+	case "answer", "accept":
+		err := p.controller.AnswerDoorbellCall(matchedDoor)
+		if err != nil {
+			logger.Error("Failed to answer doorbell call", "door", matchedDoor.Name, "err", err)
+		}
+		p.publishCommandResult(matchedDoor, commandResult(cmd, err))
 	case "ring":
 		// Trigger a doorbell ring via the remote_call API
 		logger.Debug("Triggering doorbell ring", "door", matchedDoor.Name)
-		if err := p.controller.TriggerDoorbellRing(matchedDoor); err != nil {
+		err := p.controller.TriggerDoorbellRing(matchedDoor)
+		result := commandResult(cmd, err)
+		if errors.Is(err, unifi.ErrCallInProgress) {
+			logger.Info("Doorbell already ringing", "door", matchedDoor.Name)
+			result.Result = "already_ringing"
+			result.Error = ""
+		} else if err != nil {
 			logger.Error("Failed to trigger doorbell ring", "door", matchedDoor.Name, "err", err)
 		}
+		p.publishCommandResult(matchedDoor, result)
+	case "call":
+		// Outbound intercom call from the reader to the viewers
+		err := p.controller.InitiateCall(matchedDoor, cmd.Viewers)
+		result := commandResult(cmd, err)
+		if errors.Is(err, unifi.ErrCallInProgress) {
+			logger.Info("Reader already in a call", "door", matchedDoor.Name)
+			result.Result = "already_ringing"
+			result.Error = ""
+		} else if err != nil {
+			logger.Error("Failed to initiate call", "door", matchedDoor.Name, "err", err)
+		}
+		p.publishCommandResult(matchedDoor, result)
+	case "reboot":
+		p.rebootDevice(topic, matchedDoor, cmd)
 	default:
 		logger.Warn("Unknown action", "action", cmd.Action)
+		p.publishCommandResult(matchedDoor, commandResult(cmd, fmt.Errorf("unknown action %q", cmd.Action)))
 	}
 }
 
+// rebootDevice reboots the hub or the reader of a door, when allowed
+func (p *Publisher) rebootDevice(topic string, door *unifi.Door, cmd Command) {
+	if !p.allowReboot {
+		logger.Warn("Rejected reboot, set allowReboot to enable it", "door", door.Name, "topic", topic)
+		p.rejectCommand(door, cmd, "reboot is disabled")
+		return
+	}
+
+	deviceID := door.ID
+	switch strings.ToLower(cmd.Target) {
+	case "", "hub":
+	case "reader":
+		deviceID = door.ReaderDeviceID
+	default:
+		logger.Warn("Unknown reboot target", "door", door.Name, "target", cmd.Target)
+		p.rejectCommand(door, cmd, "unknown reboot target "+cmd.Target)
+		return
+	}
+
+	logger.Warn("REBOOTING DEVICE", "door", door.Name, "target", cmd.Target, "device", deviceID, "topic", topic)
+	err := p.controller.RebootDevice(deviceID)
+	if err != nil {
+		logger.Error("Failed to reboot device", "door", door.Name, "device", deviceID, "err", err)
+	}
+	p.publishCommandResult(door, commandResult(cmd, err))
+}
+
+// commandResult returns the result of a command: "ok", or "error" with the
+// message of err
+func commandResult(cmd Command, err error) CommandResult {
+	result := CommandResult{Action: strings.ToLower(cmd.Action), Result: "ok", RequestID: cmd.RequestID}
+	if err != nil {
+		result.Result = "error"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// publishCommandResult publishes the outcome of a command for a door
+func (p *Publisher) publishCommandResult(door *unifi.Door, result CommandResult) {
+	p.publishEvent(fmt.Sprintf("%s/set/result", p.getDoorTopic(door)), result)
+}
+
+// rejectCommand publishes a command that was not executed to {door}/error,
+// and its error result to {door}/set/result
+func (p *Publisher) rejectCommand(door *unifi.Door, cmd Command, message string) {
+	p.publishError(door, cmd.Action, message)
+	p.publishCommandResult(door, commandResult(cmd, errors.New(message)))
+}
+
+// PublishUnlockLimited publishes an unlock dropped by the controller's unlock
+// rate limit to {door}/error
+func (p *Publisher) PublishUnlockLimited(door *unifi.Door) {
+	p.publishError(door, "unlock", unifi.ErrUnlockRateLimited.Error())
+}
+
+// publishError publishes a rejected command for a door
+func (p *Publisher) publishError(door *unifi.Door, action, message string) {
+	p.publishEvent(fmt.Sprintf("%s/error", p.getDoorTopic(door)), ErrorState{
+		DoorID: door.ID,
+		Name:   door.Name,
+		Action: action,
+		Error:  message,
+	})
+}
+
 // getDoorTopic returns the MQTT topic suffix for a door (base topic is added by mqtt library)
 func (p *Publisher) getDoorTopic(door *unifi.Door) string {
-	return unifi.SanitizeName(door.Name)
+	return unifi.SanitizeName(door.TopicName())
+}
+
+// topic returns a topic relative to the base topic, including the prefix
+func (p *Publisher) topic(suffix string) string {
+	if p.prefix == "" {
+		return suffix
+	}
+	return p.prefix + "/" + suffix
 }
 
 // publish publishes a message to MQTT
 func (p *Publisher) publish(topic string, payload any) {
-	mqtt.PublishJSON(topic, payload)
+	p.sendState(topic, payload, retainFlag(p.retain.State, config.Get().MQTT.Retain))
+}
+
+// retainFlag returns the configured retain flag of a category, or fallback
+// when it isn't configured
+func retainFlag(flag *bool, fallback bool) bool {
+	if flag != nil {
+		return *flag
+	}
+	return fallback
+}
+
+// publishRetained publishes a state as JSON with retain, regardless of the
+// configured retain flag.
+func (p *Publisher) publishRetained(topic string, payload any) {
+	p.sendState(topic, payload, true)
+}
+
+// publishEvent publishes a momentary event as JSON without retain, so
+// subscribers don't receive stale events when they connect.
+func (p *Publisher) publishEvent(topic string, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		logger.Error("Error marshaling to JSON", "error", err)
+		return
+	}
+	if brokerDown() {
+		// Events are momentary; replaying them later would be misleading
+		publishFailures.Add(1)
+		logger.Warn("MQTT broker unreachable, event dropped", "topic", p.topic(topic))
+		return
+	}
+	publishAbsolute(config.Get().MQTT.Topic+"/"+p.topic(topic), data, false)
 }
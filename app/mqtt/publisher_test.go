@@ -0,0 +1,225 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mqtt-home/unifi-access-mqtt/unifi"
+)
+
+// fakeBroker records the messages the publisher sends
+type fakeBroker struct {
+	mu       sync.Mutex
+	messages []brokerMessage
+}
+
+// brokerMessage is one recorded publish
+type brokerMessage struct {
+	topic    string
+	payload  string
+	retained bool
+}
+
+// captureBroker replaces publishAbsolute with a fakeBroker for the test
+func captureBroker(t *testing.T) *fakeBroker {
+	t.Helper()
+	broker := &fakeBroker{}
+	original := publishAbsolute
+	publishAbsolute = func(topic string, message any, retained bool) {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+		var payload string
+		switch m := message.(type) {
+		case []byte:
+			payload = string(m)
+		default:
+			payload = fmt.Sprint(m)
+		}
+		broker.messages = append(broker.messages, brokerMessage{topic: topic, payload: payload, retained: retained})
+	}
+	t.Cleanup(func() { publishAbsolute = original })
+	return broker
+}
+
+// last returns the last message published to a topic ending in suffix
+func (b *fakeBroker) last(suffix string) (brokerMessage, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := len(b.messages) - 1; i >= 0; i-- {
+		if strings.HasSuffix(b.messages[i].topic, suffix) {
+			return b.messages[i], true
+		}
+	}
+	return brokerMessage{}, false
+}
+
+// count returns the number of messages published to topics ending in suffix
+func (b *fakeBroker) count(suffix string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, m := range b.messages {
+		if strings.HasSuffix(m.topic, suffix) {
+			n++
+		}
+	}
+	return n
+}
+
+// newTestPublisher returns a publisher for a controller with the doors of
+// bootstrap, so no controller is needed
+func newTestPublisher(t *testing.T, bootstrap *unifi.BootstrapResponse) *Publisher {
+	t.Helper()
+	controller, err := unifi.NewControllerFromBootstrap(bootstrap)
+	if err != nil {
+		t.Fatalf("NewControllerFromBootstrap: %v", err)
+	}
+	t.Cleanup(controller.Disconnect)
+
+	p := NewPublisher(controller)
+	// The debounced door array must not outlive the test's fake broker
+	t.Cleanup(func() {
+		p.snapshotMu.Lock()
+		defer p.snapshotMu.Unlock()
+		if p.snapshotTimer != nil {
+			p.snapshotTimer.Stop()
+		}
+	})
+	return p
+}
+
+// frontDoorBootstrap has the hub of a door without a position sensor
+func frontDoorBootstrap() *unifi.BootstrapResponse {
+	return &unifi.BootstrapResponse{
+		Version: "2.2.0",
+		Devices: []unifi.DeviceConfig{
+			{UniqueID: "hub-front", Name: "Front Door", DeviceType: unifi.DeviceTypeUAH, IsOnline: true,
+				Capabilities: []string{unifi.CapabilityIsHub},
+				Door:         &unifi.DoorReference{UniqueID: "location-front", Name: "Front Door"}},
+		},
+		Doors: []unifi.DoorConfig{{UniqueID: "location-front", Name: "Front Door"}},
+	}
+}
+
+func TestPositionSensorRepublishesDiscovery(t *testing.T) {
+	broker := captureBroker(t)
+	p := newTestPublisher(t, frontDoorBootstrap())
+	door := p.controller.GetDoorByName("Front Door")
+	if door == nil || door.HasPositionSensor {
+		t.Fatalf("door from the bootstrap = %+v, want one without a position sensor", door)
+	}
+
+	p.PublishDiscovery("")
+	p.PublishDoorState(door)
+	if _, ok := broker.last("/front-door/position"); ok {
+		t.Error("position published for a door without a position sensor")
+	}
+	if n := broker.count("_door/config"); n != 1 {
+		t.Errorf("door sensor discovery published %d times, want 1", n)
+	}
+
+	// The first position event reveals the sensor
+	door.HasPositionSensor = true
+	door.DoorStatus = "open"
+	p.PublishDoorState(door)
+
+	position, ok := broker.last("/front-door/position")
+	if !ok || position.payload != "open" || position.retained {
+		t.Errorf("position = %+v, want \"open\" with the default (unset) retain flag", position)
+	}
+	discovery, _ := broker.last("_door/config")
+	var cfg discoveryConfig
+	if err := json.Unmarshal([]byte(discovery.payload), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(cfg.StateTopic, "/front-door/position") || cfg.ValueTemplate != "" {
+		t.Errorf("republished door sensor reads %q with template %q, want the position topic", cfg.StateTopic, cfg.ValueTemplate)
+	}
+
+	// Unchanged, the discovery isn't republished again
+	door.DoorStatus = "closed"
+	p.PublishDoorState(door)
+	if n := broker.count("_door/config"); n != 2 {
+		t.Errorf("door sensor discovery published %d times, want 2", n)
+	}
+}
+
+func TestPlainStatesQueuedWhileBrokerDown(t *testing.T) {
+	broker := captureBroker(t)
+	bootstrap := frontDoorBootstrap()
+	bootstrap.Doors[0].DoorPositionStatus = "open"
+	p := newTestPublisher(t, bootstrap)
+	door := p.controller.GetDoorByName("Front Door")
+
+	// No probe echo yet: the broker counts as unreachable
+	healthMu.Lock()
+	healthInterval, lastProbeEcho = time.Second, time.Time{}
+	healthMu.Unlock()
+	t.Cleanup(func() {
+		healthMu.Lock()
+		healthInterval, lastProbeEcho = 0, time.Time{}
+		healthMu.Unlock()
+	})
+
+	p.PublishDoorState(door)
+	p.PublishDoorAvailability(door)
+	if len(broker.messages) != 0 {
+		t.Fatalf("published %v while the broker was unreachable", broker.messages)
+	}
+
+	healthMu.Lock()
+	lastProbeEcho = time.Now()
+	healthMu.Unlock()
+	p.flushQueued()
+
+	if position, ok := broker.last("/front-door/position"); !ok || position.payload != "open" {
+		t.Errorf("position after the broker came back = %+v, want \"open\"", position)
+	}
+	if availability, ok := broker.last("/front-door/availability"); !ok || availability.payload != "online" || !availability.retained {
+		t.Errorf("availability after the broker came back = %+v, want retained \"online\"", availability)
+	}
+}
+
+func TestReconnectedRestoresAvailability(t *testing.T) {
+	broker := captureBroker(t)
+	p := newTestPublisher(t, frontDoorBootstrap())
+
+	// The broker published the retained last will after an unclean drop
+	PublishAvailability(false)
+	p.Reconnected()
+
+	availability, ok := broker.last("/" + availabilityTopic)
+	if !ok || availability.payload != "online" || !availability.retained {
+		t.Errorf("availability after reconnect = %+v, want retained \"online\"", availability)
+	}
+	if _, ok := broker.last("/front-door"); !ok {
+		t.Error("door state not republished after reconnect")
+	}
+	if n := broker.count("/config"); n != 0 {
+		t.Errorf("%d discovery configs published after reconnect without discovery", n)
+	}
+
+	p.PublishDiscovery("")
+	published := broker.count("/config")
+	p.Reconnected()
+	if n := broker.count("/config"); n != 2*published {
+		t.Errorf("discovery configs after reconnect = %d, want %d", n, 2*published)
+	}
+}
+
+func TestSnapshotsRetained(t *testing.T) {
+	broker := captureBroker(t)
+	p := newTestPublisher(t, frontDoorBootstrap())
+	p.EnableKeyedSnapshot()
+
+	p.PublishSnapshot()
+	for _, suffix := range []string{"/" + DefaultDoorsTopic, "/_bridge/snapshot"} {
+		if msg, ok := broker.last(suffix); !ok || !msg.retained || !strings.Contains(msg.payload, "Front Door") {
+			t.Errorf("%s = %+v, want the retained door states", suffix, msg)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package mqtt
+
+import (
+	"expvar"
+	"time"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// reconnectPollInterval is how often the reconnect counter is checked
+const reconnectPollInterval = 5 * time.Second
+
+// mqttReconnects reads the reconnect counter of the mqtt-gateway library from
+// its "mqtt" expvar
+func mqttReconnects() int {
+	v := expvar.Get("mqtt")
+	if v == nil {
+		return 0
+	}
+	f, ok := v.(expvar.Func)
+	if !ok {
+		return 0
+	}
+	info, ok := f.Value().(map[string]any)
+	if !ok {
+		return 0
+	}
+	n, _ := info["reconnects"].(int)
+	return n
+}
+
+// OnReconnect calls fn after every reconnect to the broker and returns a
+// function that stops watching. The mqtt-gateway library re-subscribes the
+// command topics itself on reconnect but doesn't expose its connect handler,
+// so reconnects are detected by polling its reconnect counter.
+func OnReconnect(fn func()) func() {
+	ticker := time.NewTicker(reconnectPollInterval)
+	done := make(chan struct{})
+	go func() {
+		last := mqttReconnects()
+		for {
+			select {
+			case <-ticker.C:
+				if n := mqttReconnects(); n != last {
+					last = n
+					logger.Info("MQTT client reconnected, republishing retained states", "reconnects", n)
+					fn()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// Republish publishes the states of all doors again, including unchanged
+// ones, e.g. after a broker restart lost the retained messages
+func (p *Publisher) Republish() {
+	p.forgetDoorStates()
+	p.PublishAllDoors()
+}
+
+// Reconnected publishes the retained messages again after a reconnect: the
+// gateway availability, which the broker has replaced with the retained last
+// will after an unclean drop, the door states, the discovery configs when
+// they were published and the bridge reports. A broker restarted without
+// persistence has lost all of them.
+func (p *Publisher) Reconnected() {
+	PublishAvailability(true)
+	p.Republish()
+
+	p.discoveryMu.Lock()
+	discovered, prefix := p.discovered, p.discoveryPrefix
+	p.discoveryMu.Unlock()
+	if discovered {
+		p.PublishDiscovery(prefix)
+	}
+	p.PublishCapabilities()
+	p.PublishGatewayInfo()
+}
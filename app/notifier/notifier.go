@@ -0,0 +1,34 @@
+package notifier
+
+import (
+	"github.com/mqtt-home/unifi-access-mqtt/unifi"
+)
+
+// Notifier receives door and doorbell state changes. It is implemented by the
+// MQTT publisher and by the native Home Assistant integration.
+type Notifier interface {
+	PublishDoorState(door *unifi.Door)
+	PublishDoorbellState(door *unifi.Door)
+	PublishAllDoors()
+}
+
+// Multi fans out every notification to all contained notifiers.
+type Multi []Notifier
+
+func (m Multi) PublishDoorState(door *unifi.Door) {
+	for _, n := range m {
+		n.PublishDoorState(door)
+	}
+}
+
+func (m Multi) PublishDoorbellState(door *unifi.Door) {
+	for _, n := range m {
+		n.PublishDoorbellState(door)
+	}
+}
+
+func (m Multi) PublishAllDoors() {
+	for _, n := range m {
+		n.PublishAllDoors()
+	}
+}
@@ -0,0 +1,284 @@
+package unifi
+
+import (
+	"strings"
+	"time"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// Access results
+const (
+	AccessGranted = "granted"
+	AccessDenied  = "denied"
+)
+
+// Normalized access methods, see AccessEvent.Method
+const (
+	AccessMethodNFC       = "nfc"
+	AccessMethodPin       = "pin"
+	AccessMethodMobile    = "mobile"
+	AccessMethodFace      = "face"
+	AccessMethodWave      = "wave"
+	AccessMethodQR        = "qr"
+	AccessMethodRemote    = "remote"
+	AccessMethodTouchPass = "touch_pass"
+	AccessMethodButton    = "button"
+)
+
+// AccessEvent describes who opened a door, or tried to, and how
+type AccessEvent struct {
+	Actor      string    // Display name of the user, "" when unknown
+	Method     string    // Normalized credential type (AccessMethodNFC, ...), other types in lower case
+	Capability string    // Reader capability of the method (CapabilityNFC, ...), "" when there is none
+	Result     string    // AccessGranted or AccessDenied
+	Reason     string    // Denial reason as reported by the controller, e.g. "Access Denied (Unknown Card)"
+	At         time.Time // Event time
+}
+
+// accessMethods maps credential providers of access logs, and the display
+// names of insights, to normalized method names
+var accessMethods = map[string]string{
+	"NFC":                  AccessMethodNFC,
+	"PIN_CODE":             AccessMethodPin,
+	"PIN":                  AccessMethodPin,
+	"MOBILE_TAP":           AccessMethodMobile,
+	"MOBILE_BUTTON":        AccessMethodMobile,
+	"MOBILE_SHAKE":         AccessMethodMobile,
+	"MOBILE_UNLOCK":        AccessMethodMobile,
+	"REMOTE_THROUGH_UAH":   AccessMethodRemote,
+	"REMOTE":               AccessMethodRemote,
+	"FACE":                 AccessMethodFace,
+	"FACE_UNLOCK":          AccessMethodFace,
+	"IDENTITY_FACE_UNLOCK": AccessMethodFace,
+	"QR_CODE":              AccessMethodQR,
+	"QR":                   AccessMethodQR,
+	"TOUCH_PASS":           AccessMethodTouchPass,
+	"HAND_WAVE":            AccessMethodWave,
+	"WAVE":                 AccessMethodWave,
+	"BUTTON":               AccessMethodButton,
+}
+
+// accessMethodCapabilities maps access methods to the reader capability
+// they require
+var accessMethodCapabilities = map[string]string{
+	AccessMethodNFC:    CapabilityNFC,
+	AccessMethodPin:    CapabilityPinCode,
+	AccessMethodMobile: CapabilityMobileUnlock,
+	AccessMethodFace:   CapabilityFaceUnlock,
+	AccessMethodWave:   CapabilityHandWave,
+	AccessMethodQR:     CapabilityQRCode,
+}
+
+// accessMethod normalizes a credential provider, e.g. "HAND_WAVE" or
+// "Hand Wave", to a method name
+func accessMethod(provider string) string {
+	key := strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToUpper(strings.TrimSpace(provider)))
+	if method, ok := accessMethods[key]; ok {
+		return method
+	}
+	return strings.ToLower(key)
+}
+
+// AccessMethodCapability returns the reader capability an access method
+// requires, e.g. CapabilityHandWave for AccessMethodWave, or ""
+func AccessMethodCapability(method string) string {
+	return accessMethodCapabilities[method]
+}
+
+// accessLog is the relevant part of an access.logs.add event
+type accessLog struct {
+	EventType string
+	Result    string
+	Reason    string
+	Actor     string
+	Method    string
+	Targets   []accessTarget
+}
+
+// accessTarget is a door or device an access log refers to
+type accessTarget struct {
+	Type string
+	ID   string
+}
+
+// parseAccessLog extracts actor, credential and targets from an access log
+// event. The log is either the event data itself or wrapped in "_source".
+func parseAccessLog(event EventPacket) *accessLog {
+	data := event.Data
+	if data == nil {
+		return nil
+	}
+	if source, ok := data["_source"].(map[string]interface{}); ok {
+		data = source
+	}
+
+	log := &accessLog{}
+	if ev, ok := data["event"].(map[string]interface{}); ok {
+		log.EventType, _ = ev["type"].(string)
+		log.Result, _ = ev["result"].(string)
+		log.Reason, _ = ev["display_message"].(string)
+	}
+	if actor, ok := data["actor"].(map[string]interface{}); ok {
+		log.Actor, _ = actor["display_name"].(string)
+		if log.Actor == "" {
+			log.Actor, _ = actor["name"].(string)
+		}
+	}
+	if auth, ok := data["authentication"].(map[string]interface{}); ok {
+		if provider, ok := auth["credential_provider"].(string); ok {
+			log.Method = accessMethod(provider)
+		}
+	}
+	if targets, ok := data["target"].([]interface{}); ok {
+		for _, t := range targets {
+			if target, ok := t.(map[string]interface{}); ok {
+				targetType, _ := target["type"].(string)
+				id, _ := target["id"].(string)
+				if id != "" {
+					log.Targets = append(log.Targets, accessTarget{Type: targetType, ID: id})
+				}
+			}
+		}
+	}
+	return log
+}
+
+// parseAccessInsight extracts an access attempt from an insight event. Unlike
+// access logs, insights carry actor, credential, door and device in "metadata".
+func parseAccessInsight(event EventPacket) *accessLog {
+	data := event.Data
+	if data == nil {
+		return nil
+	}
+
+	log := &accessLog{}
+	log.EventType, _ = data["event_type"].(string)
+	log.Result, _ = data["result"].(string)
+	log.Reason, _ = data["message"].(string)
+	if reason, ok := data["reason"].(string); ok && reason != "" {
+		log.Reason = reason
+	}
+
+	metadata, _ := data["metadata"].(map[string]interface{})
+	displayName := func(key string) (string, string) {
+		m, _ := metadata[key].(map[string]interface{})
+		name, _ := m["display_name"].(string)
+		id, _ := m["id"].(string)
+		return name, id
+	}
+	log.Actor, _ = displayName("actor")
+	if method, _ := displayName("authentication"); method != "" {
+		log.Method = accessMethod(method)
+	}
+	if _, id := displayName("door"); id != "" {
+		log.Targets = append(log.Targets, accessTarget{Type: "door", ID: id})
+	}
+	if _, id := displayName("device"); id != "" {
+		log.Targets = append(log.Targets, accessTarget{Type: "device", ID: id})
+	}
+	return log
+}
+
+// isDeniedResult reports whether an access result is a denial
+func isDeniedResult(result string) bool {
+	switch strings.ToUpper(result) {
+	case "BLOCKED", "DENIED", "FAILED", "REJECTED":
+		return true
+	}
+	return false
+}
+
+// doorForTargets returns the door an access log refers to, either by its
+// door (location) ID or by the ID of its hub. Must be called with c.mu held
+// (read or write).
+func (c *Controller) doorForTargets(targets []accessTarget) *Door {
+	for _, target := range targets {
+		for _, door := range c.doors {
+			if target.Type == "door" && door.Device.Door != nil && door.Device.Door.UniqueID == target.ID {
+				return door
+			}
+		}
+	}
+	for _, target := range targets {
+		for _, door := range c.doors {
+			if door.ID == target.ID {
+				return door
+			}
+		}
+	}
+	return nil
+}
+
+// handleAccessLog records who unlocked a door
+func (c *Controller) handleAccessLog(event EventPacket) {
+	log := parseAccessLog(event)
+	if log == nil || !strings.HasSuffix(log.EventType, ".unlock") {
+		return
+	}
+	if isDeniedResult(log.Result) {
+		c.accessDenied(log, event)
+		return
+	}
+	if log.Result != "" && !strings.EqualFold(log.Result, "ACCESS") {
+		return
+	}
+
+	c.mu.Lock()
+	door := c.doorForTargets(log.Targets)
+	if door != nil {
+		door.LastActor = log.Actor
+		door.LastAccessMethod = log.Method
+	}
+	c.mu.Unlock()
+
+	if door == nil {
+		logger.Debug("Access log for unknown door", "event", log.EventType)
+		return
+	}
+
+	logger.Info("Door accessed", "door", door.Name, "actor", log.Actor, "method", log.Method)
+	if c.OnDoorAccess != nil {
+		c.OnDoorAccess(door, AccessEvent{
+			Actor:      log.Actor,
+			Method:     log.Method,
+			Capability: AccessMethodCapability(log.Method),
+			Result:     AccessGranted,
+			At:         event.Timestamp,
+		})
+	}
+}
+
+// handleAccessDenied handles insight events, which report failed access
+// attempts such as a wrong PIN or an unauthorized card
+func (c *Controller) handleAccessDenied(event EventPacket) {
+	log := parseAccessInsight(event)
+	if log == nil || !isDeniedResult(log.Result) {
+		return
+	}
+	c.accessDenied(log, event)
+}
+
+// accessDenied fires OnAccessDenied for a failed access attempt at a door
+func (c *Controller) accessDenied(log *accessLog, event EventPacket) {
+	c.mu.RLock()
+	door := c.doorForTargets(log.Targets)
+	c.mu.RUnlock()
+
+	if door == nil {
+		logger.Debug("Access denied at unknown door", "event", log.EventType, "reason", log.Reason)
+		return
+	}
+
+	logger.Warn("Access denied", "door", door.Name, "actor", log.Actor, "method", log.Method, "reason", log.Reason)
+	if c.OnAccessDenied != nil {
+		c.OnAccessDenied(door, AccessEvent{
+			Actor:      log.Actor,
+			Method:     log.Method,
+			Capability: AccessMethodCapability(log.Method),
+			Result:     AccessDenied,
+			Reason:     log.Reason,
+			At:         event.Timestamp,
+		})
+	}
+}
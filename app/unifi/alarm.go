@@ -0,0 +1,135 @@
+package unifi
+
+import (
+	"time"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// Alarm types
+const (
+	AlarmForcedOpen = "forced_open" // door opened while locked, without a preceding unlock
+	AlarmTamper     = "tamper"      // hub or reader reported tampering
+)
+
+// forcedOpenGrace is how long a door opened while locked waits for an unlock
+// event before a forced-open alarm is raised. Unlock and position changes may
+// arrive in separate events, in either order.
+const forcedOpenGrace = 2 * time.Second
+
+// AlarmEvent describes an alarm raised (Active) or cleared at a door
+type AlarmEvent struct {
+	Type   string
+	Active bool
+	At     time.Time
+}
+
+// Forced-open detection is a small state machine per door:
+//
+//	closed --open while unlocked or within the entry window--> authorized
+//	closed --open while locked--> pending (alarmTimers)
+//	pending --unlock within forcedOpenGrace--> authorized
+//	pending --forcedOpenGrace passed--> forced open (Door.Alarm)
+//	pending/forced open --close--> closed (alarm cleared)
+
+// checkForcedOpen records a door position change for forced-open detection.
+// recentUnlock tells whether the door was unlocked within the entry window
+// before opening. Must be called with c.mu held.
+func (c *Controller) checkForcedOpen(door *Door, recentUnlock bool, at time.Time) {
+	if door.DoorStatus != "open" {
+		c.stopForcedOpenTimer(door)
+		if door.Alarm == AlarmForcedOpen {
+			door.Alarm = ""
+			logger.Info("Forced-open door closed", "door", door.Name)
+			// Fired outside of the caller's lock
+			go c.fireDoorAlarm(door, AlarmEvent{Type: AlarmForcedOpen, At: at})
+		}
+		return
+	}
+
+	// Doors whose lock state isn't known can't be judged
+	if door.LockStatus != "locked" || recentUnlock {
+		return
+	}
+
+	c.stopForcedOpenTimer(door)
+	key := door.Key
+	c.alarmTimers[key] = time.AfterFunc(forcedOpenGrace, func() {
+		c.forcedOpenExpired(key, at)
+	})
+}
+
+// cancelForcedOpen treats a pending opening as authorized because the unlock
+// event arrived after the position change. Must be called with c.mu held.
+func (c *Controller) cancelForcedOpen(door *Door) {
+	if c.stopForcedOpenTimer(door) {
+		logger.Debug("Unlock arrived after opening, not a forced open", "door", door.Name)
+	}
+}
+
+// stopForcedOpenTimer stops a pending forced-open check and reports whether
+// one was pending. Must be called with c.mu held.
+func (c *Controller) stopForcedOpenTimer(door *Door) bool {
+	timer := c.alarmTimers[door.Key]
+	if timer == nil {
+		return false
+	}
+	timer.Stop()
+	delete(c.alarmTimers, door.Key)
+	return true
+}
+
+// forcedOpenExpired raises the forced-open alarm when the door is still open
+// and still locked once the grace period has passed
+func (c *Controller) forcedOpenExpired(key string, openedAt time.Time) {
+	c.mu.Lock()
+	door := c.doors[key]
+	if door == nil || c.alarmTimers[key] == nil || door.DoorStatus != "open" || door.LockStatus != "locked" {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.alarmTimers, key)
+	door.Alarm = AlarmForcedOpen
+	c.mu.Unlock()
+
+	logger.Warn("Door forced open", "door", door.Name, "at", openedAt.Format(time.RFC3339))
+	c.fireDoorAlarm(door, AlarmEvent{Type: AlarmForcedOpen, Active: true, At: openedAt})
+}
+
+// handleTamper handles tamper events of a hub or reader
+func (c *Controller) handleTamper(event EventPacket) {
+	deviceID := event.EventObjectID
+	if id, ok := event.Data["device_id"].(string); ok && id != "" {
+		deviceID = id
+	}
+	if deviceID == "" {
+		return
+	}
+
+	c.mu.RLock()
+	door := c.doorByDevice(deviceID)
+	if door == nil {
+		for _, d := range c.doors {
+			if d.ReaderDeviceID == deviceID {
+				door = d
+				break
+			}
+		}
+	}
+	c.mu.RUnlock()
+
+	if door == nil {
+		logger.Debug("Tamper event for unknown device", "device", deviceID)
+		return
+	}
+
+	logger.Warn("Device tampered", "door", door.Name, "device", deviceID)
+	c.fireDoorAlarm(door, AlarmEvent{Type: AlarmTamper, Active: true, At: event.Timestamp})
+}
+
+// fireDoorAlarm invokes the OnDoorAlarm callback
+func (c *Controller) fireDoorAlarm(door *Door, alarm AlarmEvent) {
+	if c.OnDoorAlarm != nil {
+		c.OnDoorAlarm(door, alarm)
+	}
+}
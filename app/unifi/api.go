@@ -0,0 +1,32 @@
+package unifi
+
+import (
+	"context"
+	"time"
+)
+
+// accessAPI is the part of the UniFi Access API the controller sends its
+// requests through. It is implemented by the Client and by the in-memory fake
+// of the package tests, so the controller can be tested without a console.
+type accessAPI interface {
+	Login() error
+	Bootstrap() (*BootstrapResponse, error)
+	Ping() error
+
+	unlock(ctx context.Context, deviceID string) error
+	unlockLocation(ctx context.Context, locationID string) error
+	unlockForDuration(ctx context.Context, deviceID string, seconds int) error
+	unlockLocationForDuration(ctx context.Context, locationID string, seconds int) error
+	lock(ctx context.Context, deviceID string) error
+	lockLocation(ctx context.Context, locationID string) error
+	Reboot(deviceID string) error
+
+	triggerDoorbellRing(ctx context.Context, req DoorbellRingRequest) error
+	DismissDoorbellCall(deviceID, requestID, userID, userName string) error
+	AnswerDoorbellCall(deviceID, requestID, userID, userName string) error
+
+	CreatePinCredential(userID, pin string, validFrom, validTo time.Time) (string, error)
+	DeleteCredential(id string) error
+	GetDoorLockRule(locationID string) (*LockRule, error)
+	GetDoorSchedules() ([]DoorSchedule, error)
+}
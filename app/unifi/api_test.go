@@ -0,0 +1,493 @@
+package unifi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAccessAPI is an in-memory accessAPI. It answers the bootstrap with
+// fixed data and records every other request.
+type fakeAccessAPI struct {
+	bootstrap *BootstrapResponse
+
+	mu       sync.Mutex
+	calls    []string              // Requests as "method id"
+	rings    []DoorbellRingRequest // Triggered doorbell rings
+	failures map[string]error      // Errors returned for requests, keyed like calls
+}
+
+func (f *fakeAccessAPI) record(format string, args ...interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	call := fmt.Sprintf(format, args...)
+	f.calls = append(f.calls, call)
+	return f.failures[call]
+}
+
+func (f *fakeAccessAPI) recorded() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+func (f *fakeAccessAPI) Login() error { return nil }
+func (f *fakeAccessAPI) Ping() error  { return nil }
+
+func (f *fakeAccessAPI) Bootstrap() (*BootstrapResponse, error) {
+	return f.bootstrap, nil
+}
+
+func (f *fakeAccessAPI) unlock(ctx context.Context, deviceID string) error {
+	return f.record("unlock %s", deviceID)
+}
+
+func (f *fakeAccessAPI) unlockLocation(ctx context.Context, locationID string) error {
+	return f.record("unlockLocation %s", locationID)
+}
+
+func (f *fakeAccessAPI) unlockForDuration(ctx context.Context, deviceID string, seconds int) error {
+	return f.record("unlockForDuration %s %d", deviceID, seconds)
+}
+
+func (f *fakeAccessAPI) unlockLocationForDuration(ctx context.Context, locationID string, seconds int) error {
+	return f.record("unlockLocationForDuration %s %d", locationID, seconds)
+}
+
+func (f *fakeAccessAPI) lock(ctx context.Context, deviceID string) error {
+	return f.record("lock %s", deviceID)
+}
+
+func (f *fakeAccessAPI) lockLocation(ctx context.Context, locationID string) error {
+	return f.record("lockLocation %s", locationID)
+}
+
+func (f *fakeAccessAPI) Reboot(deviceID string) error {
+	return f.record("reboot %s", deviceID)
+}
+
+func (f *fakeAccessAPI) triggerDoorbellRing(ctx context.Context, req DoorbellRingRequest) error {
+	f.mu.Lock()
+	f.rings = append(f.rings, req)
+	f.mu.Unlock()
+	return f.record("triggerDoorbellRing %s", req.DeviceID)
+}
+
+func (f *fakeAccessAPI) DismissDoorbellCall(deviceID, requestID, userID, userName string) error {
+	return f.record("dismiss %s %s", deviceID, requestID)
+}
+
+func (f *fakeAccessAPI) AnswerDoorbellCall(deviceID, requestID, userID, userName string) error {
+	return f.record("answer %s %s", deviceID, requestID)
+}
+
+func (f *fakeAccessAPI) CreatePinCredential(userID, pin string, validFrom, validTo time.Time) (string, error) {
+	return "credential-1", f.record("createPin %s", userID)
+}
+
+func (f *fakeAccessAPI) DeleteCredential(id string) error {
+	return f.record("deleteCredential %s", id)
+}
+
+func (f *fakeAccessAPI) GetDoorLockRule(locationID string) (*LockRule, error) {
+	return &LockRule{}, nil
+}
+
+func (f *fakeAccessAPI) GetDoorSchedules() ([]DoorSchedule, error) {
+	return nil, nil
+}
+
+// fakeBootstrap has a UAH door with a G3 reader and a building-level viewer,
+// and a UGT gate
+func fakeBootstrap() *BootstrapResponse {
+	front := &DoorReference{UniqueID: "location-front", Name: "Front Door"}
+	gate := &DoorReference{UniqueID: "location-gate", Name: "Gate"}
+	return &BootstrapResponse{
+		Version: "2.2.0",
+		Host:    ControllerHost{MAC: "aa:bb:cc:dd:ee:ff", Name: "Console"},
+		Devices: []DeviceConfig{
+			{UniqueID: "hub-front", Name: "Front Door", DeviceType: DeviceTypeUAH, IsOnline: true,
+				Capabilities: []string{CapabilityIsHub}, Door: front},
+			{UniqueID: "reader-front", Name: "Front Reader", DeviceType: DeviceTypeG3Reader, IsOnline: true,
+				Capabilities: []string{CapabilityIsReader, CapabilityDoorbell}, Door: front},
+			{UniqueID: "hub-gate", Name: "Gate", DeviceType: DeviceTypeUGT, IsOnline: true,
+				Capabilities: []string{CapabilityIsHub}, Door: gate},
+		},
+		Doors: []DoorConfig{
+			{UniqueID: "location-front", Name: "Front Door"},
+			{UniqueID: "location-gate", Name: "Gate"},
+		},
+		Viewers: []DeviceConfig{
+			{UniqueID: "viewer-hall", Name: "Hall", DeviceType: DeviceTypeViewer, IsOnline: true},
+		},
+	}
+}
+
+// newFakeController returns a controller connected to a fakeAccessAPI. The
+// unlock rate limit is lifted, so tests can unlock a door repeatedly.
+// configure runs before Connect, e.g. to set callbacks.
+func newFakeController(t *testing.T, configure func(c *Controller)) (*Controller, *fakeAccessAPI) {
+	t.Helper()
+	api := &fakeAccessAPI{bootstrap: fakeBootstrap()}
+	// Nothing listens on the port, so the event WebSocket fails fast; events
+	// are injected instead
+	c := NewControllerWithCredentials("https://127.0.0.1:1", nil, false)
+	c.api = api
+	c.SetUnlockRateLimit(1000, time.Second)
+	if configure != nil {
+		configure(c)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(c.Disconnect)
+	return c, api
+}
+
+// receive waits for a door from a callback
+func receive(t *testing.T, ch <-chan *Door, what string) *Door {
+	t.Helper()
+	select {
+	case door := <-ch:
+		return door
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no %s", what)
+		return nil
+	}
+}
+
+func TestDoorbellRingAndCancelEvents(t *testing.T) {
+	rings := make(chan *Door, 4)
+	cancels := make(chan *Door, 4)
+	c, _ := newFakeController(t, func(c *Controller) {
+		c.OnDoorbellRing = func(door *Door) { rings <- door }
+		c.OnDoorbellCancel = func(door *Door) { cancels <- door }
+	})
+
+	c.eventListener.Inject(EventPacket{
+		Event:         EventDoorbellRing,
+		EventObjectID: "hub-front",
+		Data: map[string]interface{}{
+			"request_id":       "call-1",
+			"connected_uah_id": "hub-front",
+			"device_id":        "reader-front",
+			"agora_channel":    "channel-1",
+		},
+	})
+	door := receive(t, rings, "doorbell ring")
+	if door.Name != "Front Door" || !door.DoorbellRinging || door.DoorbellRequestID != "call-1" {
+		t.Fatalf("after ring: door %q ringing=%v request=%q", door.Name, door.DoorbellRinging, door.DoorbellRequestID)
+	}
+	if door.SelfTriggeredRing {
+		t.Error("ring from the reader counted as self-triggered")
+	}
+
+	// A cancel of another call leaves the ring alone
+	for _, requestID := range []string{"call-other", "call-1"} {
+		c.eventListener.Inject(EventPacket{
+			Event:         EventDoorbellCancel,
+			EventObjectID: "hub-front",
+			Data:          map[string]interface{}{"remote_call_request_id": requestID},
+		})
+	}
+	door = receive(t, cancels, "doorbell cancel")
+	if door.DoorbellRinging || door.DoorbellRequestID != "" {
+		t.Errorf("after cancel: ringing=%v request=%q, want idle", door.DoorbellRinging, door.DoorbellRequestID)
+	}
+	if len(cancels) != 0 {
+		t.Errorf("cancel of an unknown call fired OnDoorbellCancel")
+	}
+}
+
+func TestSelfTriggeredRingIsRecognized(t *testing.T) {
+	rings := make(chan *Door, 1)
+	c, api := newFakeController(t, func(c *Controller) {
+		c.OnDoorbellRing = func(door *Door) { rings <- door }
+	})
+
+	door := c.GetDoorByName("Front Door")
+	if err := c.TriggerDoorbellRing(door); err != nil {
+		t.Fatalf("TriggerDoorbellRing: %v", err)
+	}
+	if len(api.rings) != 1 {
+		t.Fatalf("rings sent = %d, want 1", len(api.rings))
+	}
+	req := api.rings[0]
+	if req.DeviceID != "reader-front" || !slices.Equal(req.ViewerIDs, []string{"viewer-hall"}) {
+		t.Errorf("ring sent to %q with viewers %v, want the reader and the hall viewer", req.DeviceID, req.ViewerIDs)
+	}
+
+	// The controller echoes the ring with the request ID of the gateway
+	c.eventListener.Inject(EventPacket{
+		Event:         EventDoorbellRing,
+		EventObjectID: "hub-front",
+		Data: map[string]interface{}{
+			"request_id":       req.RequestID,
+			"connected_uah_id": "hub-front",
+			"device_id":        "reader-front",
+		},
+	})
+	if door := receive(t, rings, "doorbell ring"); !door.SelfTriggeredRing {
+		t.Error("echo of the gateway's ring not recognized as self-triggered")
+	}
+}
+
+func TestInitiateCallIsOutbound(t *testing.T) {
+	c, api := newFakeController(t, nil)
+	door := c.GetDoorByName("Front Door")
+
+	if err := c.InitiateCall(door, nil); err != nil {
+		t.Fatalf("InitiateCall: %v", err)
+	}
+	if err := c.InitiateCall(door, []string{"viewer-lobby"}); err != nil {
+		t.Fatalf("InitiateCall with viewers: %v", err)
+	}
+	if len(api.rings) != 2 {
+		t.Fatalf("calls sent = %d, want 2", len(api.rings))
+	}
+	for i, want := range [][]string{{"viewer-hall"}, {"viewer-lobby"}} {
+		req := api.rings[i]
+		if req.DeviceID != "reader-front" || req.InOrOut != "out" || !slices.Equal(req.ViewerIDs, want) {
+			t.Errorf("call %d: from %q, in_or_out %q, viewers %v; want out from the reader to %v", i, req.DeviceID, req.InOrOut, req.ViewerIDs, want)
+		}
+	}
+}
+
+func TestDoorCapabilitiesFromHubAndReader(t *testing.T) {
+	c, _ := newFakeController(t, func(c *Controller) {
+		reader := &c.api.(*fakeAccessAPI).bootstrap.Devices[1]
+		reader.Capabilities = append(reader.Capabilities, CapabilityHandWave, CapabilityNFC, "unknown_feature")
+	})
+
+	tests := []struct {
+		door string
+		want []string
+	}{
+		{"Front Door", []string{"doorbell", "nfc", "wave"}},
+		{"Gate", []string{}},
+	}
+	for _, tt := range tests {
+		if got := c.GetDoorByName(tt.door).Capabilities; !slices.Equal(got, tt.want) || got == nil {
+			t.Errorf("%s: capabilities = %#v, want %#v", tt.door, got, tt.want)
+		}
+	}
+}
+
+func TestDeviceStatsOnlyFromTheReader(t *testing.T) {
+	updates := make(chan *Door, 4)
+	c, _ := newFakeController(t, func(c *Controller) {
+		c.OnDoorUpdate = func(door *Door) { updates <- door }
+	})
+
+	// The hub reports a signal of its own
+	c.eventListener.Inject(EventPacket{
+		Event:         EventDeviceUpdate,
+		EventObjectID: "hub-front",
+		Data:          map[string]interface{}{"rssi": -40.0},
+	})
+	if door := receive(t, updates, "hub update"); door.HasSignal {
+		t.Errorf("hub signal %d applied to the door's reader", door.SignalStrength)
+	}
+
+	c.eventListener.Inject(EventPacket{
+		Event:         EventDeviceUpdate,
+		EventObjectID: "reader-front",
+		Data:          map[string]interface{}{"rssi": -67.0, "battery": "87%"},
+	})
+	door := receive(t, updates, "reader update")
+	if !door.HasSignal || door.SignalStrength != -67 || !door.HasBattery || door.BatteryLevel != 87 {
+		t.Errorf("after the reader update: signal %d (%v), battery %d (%v); want -67 and 87",
+			door.SignalStrength, door.HasSignal, door.BatteryLevel, door.HasBattery)
+	}
+}
+
+func TestUnlockCommandRouting(t *testing.T) {
+	c, api := newFakeController(t, nil)
+	front := c.GetDoorByName("Front Door")
+	gate := c.GetDoorByName("Gate")
+	if front == nil || gate == nil {
+		t.Fatalf("doors from the fake bootstrap: front=%v gate=%v", front, gate)
+	}
+
+	for _, step := range []func() error{
+		func() error { return c.UnlockDoor(front) },
+		func() error { return c.UnlockDoor(gate) },
+		func() error { return c.UnlockForDuration(front, 30) },
+		func() error { return c.UnlockForDuration(gate, 45) },
+		func() error { return c.LockDoor(front) },
+		func() error { return c.LockDoor(gate) },
+	} {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{
+		"unlock hub-front",
+		"unlockLocation location-gate",
+		"unlockForDuration hub-front 30",
+		"unlockLocationForDuration location-gate 45",
+		"lock hub-front",
+		"lockLocation location-gate",
+	}
+	if got := api.recorded(); !slices.Equal(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+
+	// A dry run sends nothing
+	c.SetDryRun(true)
+	if err := c.UnlockDoor(front); err != nil {
+		t.Fatal(err)
+	}
+	if got := api.recorded(); len(got) != len(want) {
+		t.Errorf("dry run sent %v", got[len(want):])
+	}
+}
+
+func TestUnlockTokenSingleUse(t *testing.T) {
+	c, api := newFakeController(t, nil)
+	front := c.GetDoorByName("Front Door")
+	gate := c.GetDoorByName("Gate")
+
+	token, _ := c.IssueUnlockToken(front, time.Minute)
+	if err := c.UnlockWithToken(front, token, 0); err != nil {
+		t.Fatalf("first unlock: %v", err)
+	}
+	if err := c.UnlockWithToken(front, token, 0); !errors.Is(err, ErrInvalidUnlockToken) {
+		t.Errorf("second unlock: err = %v, want ErrInvalidUnlockToken", err)
+	}
+
+	token, _ = c.IssueUnlockToken(front, time.Minute)
+	if err := c.UnlockWithToken(gate, token, 0); !errors.Is(err, ErrInvalidUnlockToken) {
+		t.Errorf("unlock of another door: err = %v, want ErrInvalidUnlockToken", err)
+	}
+
+	// A failed unlock leaves the token valid for a retry
+	token, _ = c.IssueUnlockToken(front, time.Minute)
+	api.failures = map[string]error{"unlock hub-front": errors.New("hub offline")}
+	if err := c.UnlockWithToken(front, token, 0); err == nil || errors.Is(err, ErrInvalidUnlockToken) {
+		t.Errorf("unlock with the hub offline: err = %v, want the unlock error", err)
+	}
+	api.failures = nil
+	if err := c.UnlockWithToken(front, token, 0); err != nil {
+		t.Errorf("retry after the failed unlock: %v", err)
+	}
+
+	token, expiresAt := c.IssueUnlockToken(front, time.Minute)
+	c.dropExpiredUnlockTokens(expiresAt.Add(time.Second))
+	if err := c.UnlockWithToken(front, token, 0); !errors.Is(err, ErrInvalidUnlockToken) {
+		t.Errorf("unlock after the sweep: err = %v, want ErrInvalidUnlockToken", err)
+	}
+
+	want := []string{"unlock hub-front", "unlock hub-front", "unlock hub-front"}
+	if got := api.recorded(); !slices.Equal(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+}
+
+func TestUnlockRateLimit(t *testing.T) {
+	var limited []string
+	c, api := newFakeController(t, func(c *Controller) {
+		c.SetUnlockRateLimit(1, time.Minute)
+		c.OnUnlockLimited = func(door *Door) { limited = append(limited, door.Name) }
+	})
+	front := c.GetDoorByName("Front Door")
+	gate := c.GetDoorByName("Gate")
+
+	if err := c.UnlockDoor(front); err != nil {
+		t.Fatalf("first unlock: %v", err)
+	}
+	if err := c.UnlockForDuration(front, 30); !errors.Is(err, ErrUnlockRateLimited) {
+		t.Errorf("timed unlock right after: err = %v, want ErrUnlockRateLimited", err)
+	}
+	results := c.UnlockDoors([]*Door{front, gate})
+	want := []DoorResult{{Door: "front-door", Error: ErrUnlockRateLimited.Error()}, {Door: "gate", OK: true}}
+	if !slices.Equal(results, want) {
+		t.Errorf("bulk unlock results = %+v, want %+v", results, want)
+	}
+
+	if got := api.recorded(); !slices.Equal(got, []string{"unlock hub-front", "unlockLocation location-gate"}) {
+		t.Errorf("requests = %v, want only the unlocks within the limit", got)
+	}
+	if !slices.Equal(limited, []string{"Front Door", "Front Door"}) {
+		t.Errorf("OnUnlockLimited fired for %v, want twice for the front door", limited)
+	}
+}
+
+func TestUnlockLimiterRefills(t *testing.T) {
+	l := newUnlockLimiter(2, 2*time.Second)
+	now := time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC)
+
+	if !l.allow("hub-1", now) || !l.allow("hub-1", now) {
+		t.Fatal("burst up to the limit rejected")
+	}
+	if l.allow("hub-1", now) {
+		t.Error("unlock beyond the limit allowed")
+	}
+	if !l.allow("hub-2", now) {
+		t.Error("other door limited by the first one")
+	}
+	if l.allow("hub-1", now.Add(500*time.Millisecond)) {
+		t.Error("unlock allowed before a token refilled")
+	}
+	if !l.allow("hub-1", now.Add(time.Second)) {
+		t.Error("unlock rejected after a token refilled")
+	}
+	// The bucket never holds more than the limit
+	later := now.Add(time.Hour)
+	if !l.allow("hub-1", later) || !l.allow("hub-1", later) || l.allow("hub-1", later) {
+		t.Error("bucket refilled beyond the limit")
+	}
+}
+
+func TestGroupUnlockContinuesPastFailures(t *testing.T) {
+	c, api := newFakeController(t, func(c *Controller) {
+		c.SetDoorGroups(map[string][]string{"Fire-Drill": {"Front Door", "Garage", "location-gate", "hub-gate", "hub-front"}})
+	})
+	// "hub-front" is the front door again, by ID; it is unlocked once
+	api.failures = map[string]error{"unlock hub-front": errors.New("hub offline")}
+
+	if _, _, err := c.GroupDoors("lobby"); !errors.Is(err, ErrUnknownGroup) {
+		t.Errorf("unconfigured group: err = %v, want ErrUnknownGroup", err)
+	}
+
+	doors, results, err := c.GroupDoors("fire-drill")
+	if err != nil {
+		t.Fatalf("GroupDoors: %v", err)
+	}
+	results = append(results, c.UnlockDoors(doors)...)
+
+	want := []DoorResult{
+		{Door: "Garage", Error: "unknown door"},
+		{Door: "location-gate", Error: "unknown door"},
+		{Door: "front-door", Error: "hub offline"},
+		{Door: "gate", OK: true},
+	}
+	if !slices.Equal(results, want) {
+		t.Errorf("results = %+v, want %+v", results, want)
+	}
+	if got := api.recorded(); !slices.Equal(got, []string{"unlock hub-front", "unlockLocation location-gate"}) {
+		t.Errorf("requests = %v, want both doors tried", got)
+	}
+}
+
+func TestReadOnlyDoors(t *testing.T) {
+	c, _ := newFakeController(t, func(c *Controller) {
+		c.SetReadOnlyDoors([]string{" front door "})
+	})
+	if !c.IsReadOnly(c.GetDoorByName("Front Door")) {
+		t.Error("door listed by name in another case is not read-only")
+	}
+	if c.IsReadOnly(c.GetDoorByName("Gate")) {
+		t.Error("unlisted door is read-only")
+	}
+
+	c.SetReadOnlyDoors([]string{"hub-gate"})
+	if !c.IsReadOnly(c.GetDoorByName("Gate")) {
+		t.Error("door listed by ID is not read-only")
+	}
+}
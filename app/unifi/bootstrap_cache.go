@@ -0,0 +1,122 @@
+package unifi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// Delays between two connection attempts after a warm start
+const (
+	warmStartRetryDelay    = 5 * time.Second
+	warmStartMaxRetryDelay = 5 * time.Minute
+)
+
+// bootstrapCache is the content of the bootstrap cache file
+type bootstrapCache struct {
+	Host      string             `json:"host"` // Controller the data was fetched from
+	SavedAt   time.Time          `json:"saved_at"`
+	Bootstrap *BootstrapResponse `json:"bootstrap"`
+}
+
+// SetBootstrapCache sets the file the last successful bootstrap is written to,
+// so the next start can load it with WarmStart while the controller is
+// unreachable. Empty disables the cache.
+func (c *Controller) SetBootstrapCache(path string) {
+	c.bootstrapCachePath = path
+}
+
+// saveBootstrapCache writes bootstrap data to the cache file, if one is set.
+// The file is replaced atomically, so a crash never leaves a partial cache.
+func (c *Controller) saveBootstrapCache(bootstrap *BootstrapResponse) {
+	if c.bootstrapCachePath == "" {
+		return
+	}
+
+	data, err := json.Marshal(bootstrapCache{Host: c.client.host, SavedAt: time.Now(), Bootstrap: bootstrap})
+	if err != nil {
+		logger.Warn("Failed to encode bootstrap cache", "err", err)
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.bootstrapCachePath), filepath.Base(c.bootstrapCachePath)+".*")
+	if err != nil {
+		logger.Warn("Failed to write bootstrap cache", "path", c.bootstrapCachePath, "err", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.bootstrapCachePath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		logger.Warn("Failed to write bootstrap cache", "path", c.bootstrapCachePath, "err", err)
+		return
+	}
+	logger.Debug("Saved bootstrap cache", "path", c.bootstrapCachePath)
+}
+
+// WarmStart loads the doors from the bootstrap cache, so their last known
+// state can be published and commands subscribed while the controller is
+// unreachable. Call RetryConnect afterwards to connect once it is back.
+func (c *Controller) WarmStart() error {
+	if c.bootstrapCachePath == "" {
+		return errors.New("no bootstrap cache configured")
+	}
+
+	data, err := os.ReadFile(c.bootstrapCachePath)
+	if err != nil {
+		return fmt.Errorf("failed to read bootstrap cache: %w", err)
+	}
+	var cache bootstrapCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return fmt.Errorf("failed to parse bootstrap cache: %w", err)
+	}
+	if cache.Bootstrap == nil {
+		return errors.New("bootstrap cache is empty")
+	}
+	if cache.Host != c.client.host {
+		return fmt.Errorf("bootstrap cache is for controller %s", cache.Host)
+	}
+
+	logger.Warn("Starting from the bootstrap cache", "path", c.bootstrapCachePath, "saved_at", cache.SavedAt.Format(time.RFC3339))
+	return c.applyBootstrap(cache.Bootstrap)
+}
+
+// RetryConnect connects with growing delays until it succeeds or the
+// controller is disconnected. OnRefresh fires once it is connected, so the
+// states loaded by WarmStart are replaced by the current ones.
+func (c *Controller) RetryConnect() {
+	ctx := c.client.context()
+	delay := warmStartRetryDelay
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(withJitter(delay)):
+		}
+
+		err := c.Connect()
+		if err == nil || errors.Is(err, ErrNoDoors) {
+			logger.Info("Connected to UniFi Access after warm start", "host", c.client.host)
+			if c.OnRefresh != nil {
+				c.OnRefresh()
+			}
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		delay = min(delay*2, warmStartMaxRetryDelay)
+		logger.Warn("UniFi Access still unreachable, retrying", "host", c.client.host, "in", delay, "err", err)
+	}
+}
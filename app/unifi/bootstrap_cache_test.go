@@ -0,0 +1,42 @@
+package unifi
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBootstrapCacheWarmStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bootstrap.json")
+	bootstrap := &BootstrapResponse{
+		Devices: []DeviceConfig{{
+			UniqueID:     "hub-1",
+			Name:         "Front Door Hub",
+			Capabilities: []string{CapabilityIsHub},
+			Door:         &DoorReference{UniqueID: "door-1", Name: "Front Door", FloorName: "Ground Floor"},
+		}},
+		Doors: []DoorConfig{{UniqueID: "door-1", Name: "Front Door", DoorPositionStatus: "open"}},
+	}
+
+	c := NewControllerWithCredentials("https://127.0.0.1", nil, false)
+	c.SetBootstrapCache(path)
+	c.saveBootstrapCache(bootstrap)
+
+	warm := NewControllerWithCredentials("https://127.0.0.1", nil, false)
+	warm.SetBootstrapCache(path)
+	if err := warm.WarmStart(); err != nil {
+		t.Fatalf("WarmStart: %v", err)
+	}
+	door := warm.GetDoorByName("Front Door")
+	if door == nil {
+		t.Fatal("cached door not loaded")
+	}
+	if door.DoorStatus != "open" || door.FloorName != "Ground Floor" {
+		t.Errorf("door = %s/%s, want open/Ground Floor", door.DoorStatus, door.FloorName)
+	}
+
+	other := NewControllerWithCredentials("https://127.0.0.2", nil, false)
+	other.SetBootstrapCache(path)
+	if err := other.WarmStart(); err == nil {
+		t.Error("WarmStart loaded the cache of another controller")
+	}
+}
@@ -0,0 +1,59 @@
+package unifi
+
+import (
+	"errors"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// DoorResult is the outcome of a bulk operation for a single door
+type DoorResult struct {
+	Door  string `json:"door"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// newDoorResult builds the result for a door from the error of its operation
+func newDoorResult(door *Door, err error) DoorResult {
+	result := DoorResult{Door: SanitizeName(door.TopicName()), OK: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// UnlockDoors unlocks each door in turn. A failing door does not stop the
+// remaining ones; the outcome of each is reported individually.
+func (c *Controller) UnlockDoors(doors []*Door) []DoorResult {
+	results := make([]DoorResult, 0, len(doors))
+	for _, door := range doors {
+		err := c.UnlockDoor(door)
+		if err != nil && !errors.Is(err, ErrUnlockRateLimited) {
+			logger.Error("Failed to unlock door", "door", door.Name, "err", err)
+		}
+		results = append(results, newDoorResult(door, err))
+	}
+	return results
+}
+
+// DismissDoorbellCalls dismisses the active call of each door. When doors is
+// empty, all currently ringing doors are dismissed.
+func (c *Controller) DismissDoorbellCalls(doors []*Door) []DoorResult {
+	if len(doors) == 0 {
+		for _, door := range c.GetDoors() {
+			if door.DoorbellRinging {
+				doors = append(doors, door)
+			}
+		}
+	}
+
+	results := make([]DoorResult, 0, len(doors))
+	for _, door := range doors {
+		err := c.DismissDoorbellCall(door)
+		if err != nil {
+			logger.Error("Failed to dismiss doorbell call", "door", door.Name, "err", err)
+		}
+		results = append(results, newDoorResult(door, err))
+	}
+	return results
+}
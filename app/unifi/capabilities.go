@@ -0,0 +1,144 @@
+package unifi
+
+import (
+	"strings"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// readerCapabilities lists the reader features worth reporting, in display order.
+var readerCapabilities = []string{
+	CapabilityDoorbell,
+	CapabilityNFC,
+	CapabilityPinCode,
+	CapabilityQRCode,
+	CapabilityMobileUnlock,
+	CapabilityFaceUnlock,
+	CapabilityHandWave,
+}
+
+// capabilityNames are the names of reader capabilities in the door state,
+// matching the access methods where there is one
+var capabilityNames = map[string]string{
+	CapabilityDoorbell:     "doorbell",
+	CapabilityNFC:          AccessMethodNFC,
+	CapabilityPinCode:      AccessMethodPin,
+	CapabilityQRCode:       AccessMethodQR,
+	CapabilityMobileUnlock: AccessMethodMobile,
+	CapabilityFaceUnlock:   AccessMethodFace,
+	CapabilityHandWave:     AccessMethodWave,
+}
+
+// doorCapabilities returns the names of the capabilities the devices of a
+// door have, e.g. "doorbell" and "nfc", in display order. Nil devices are
+// skipped.
+func doorCapabilities(devices ...*DeviceConfig) []string {
+	names := []string{}
+	for _, capability := range readerCapabilities {
+		for _, device := range devices {
+			if device != nil && device.HasCapability(capability) {
+				names = append(names, capabilityNames[capability])
+				break
+			}
+		}
+	}
+	return names
+}
+
+// CapabilityStatus describes a single capability of a reader.
+type CapabilityStatus struct {
+	Supported bool  `json:"supported"`
+	Enabled   *bool `json:"enabled,omitempty"` // nil when no config entry indicates the state
+}
+
+// CapabilityReport summarizes the capabilities of one reader and whether each
+// appears enabled based on its config values.
+type CapabilityReport struct {
+	DeviceID     string                      `json:"device_id"`
+	Name         string                      `json:"name"`
+	DeviceType   string                      `json:"device_type"`
+	Door         string                      `json:"door,omitempty"`
+	Capabilities map[string]CapabilityStatus `json:"capabilities"`
+}
+
+// NewCapabilityReport builds the capability report for a device
+func NewCapabilityReport(device *DeviceConfig) CapabilityReport {
+	report := CapabilityReport{
+		DeviceID:     device.GetID(),
+		Name:         device.Name,
+		DeviceType:   device.DeviceType,
+		Capabilities: make(map[string]CapabilityStatus, len(readerCapabilities)),
+	}
+	if device.Door != nil {
+		report.Door = device.Door.Name
+	}
+
+	for _, capability := range readerCapabilities {
+		status := CapabilityStatus{Supported: device.HasCapability(capability)}
+		if status.Supported {
+			status.Enabled = capabilityEnabled(device, capability)
+		}
+		report.Capabilities[capability] = status
+	}
+	return report
+}
+
+// capabilityEnabled looks for a boolean-like config entry whose key mentions
+// the capability (e.g. "nfc_enable" = "on"). Returns nil when nothing matches,
+// since config key names vary between firmware versions.
+func capabilityEnabled(device *DeviceConfig, capability string) *bool {
+	for _, cfg := range device.Configs {
+		if !strings.Contains(strings.ToLower(cfg.Key), capability) {
+			continue
+		}
+		switch strings.ToLower(cfg.Value) {
+		case "on", "true", "1", "enable", "enabled", "yes":
+			enabled := true
+			return &enabled
+		case "off", "false", "0", "disable", "disabled", "no":
+			enabled := false
+			return &enabled
+		}
+	}
+	return nil
+}
+
+// GetCapabilityReports returns the capability report for every reader found
+// at bootstrap
+func (c *Controller) GetCapabilityReports() []CapabilityReport {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	reports := make([]CapabilityReport, 0, len(c.readerDevices))
+	for i := range c.readerDevices {
+		reports = append(reports, NewCapabilityReport(&c.readerDevices[i]))
+	}
+	return reports
+}
+
+// logCapabilities logs the capabilities of each reader at startup
+func logCapabilities(device *DeviceConfig) {
+	report := NewCapabilityReport(device)
+	var supported, enabled, disabled []string
+	for _, capability := range readerCapabilities {
+		status := report.Capabilities[capability]
+		if !status.Supported {
+			continue
+		}
+		supported = append(supported, capability)
+		if status.Enabled != nil {
+			if *status.Enabled {
+				enabled = append(enabled, capability)
+			} else {
+				disabled = append(disabled, capability)
+			}
+		}
+	}
+	logger.Info("Reader capabilities",
+		"name", report.Name,
+		"type", report.DeviceType,
+		"door", report.Door,
+		"supported", supported,
+		"enabled", enabled,
+		"disabled", disabled)
+}
@@ -2,61 +2,182 @@ package unifi
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
+	"os"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/mqtt-home/unifi-access-mqtt/buildinfo"
 	"github.com/philipparndt/go-logger"
 )
 
+// Credential is a username/password pair for logging in to the controller
+type Credential struct {
+	Username string
+	Password string
+}
+
 // Client represents the UniFi Access API client
 type Client struct {
-	host       string
-	username   string
-	password   string
-	verifySSL  bool
-	httpClient *http.Client
-	csrfToken  string
-	userID     string
-	userName   string
-	mu         sync.RWMutex
+	host        string
+	site        string        // UniFi OS site of the Access app ("" = default site)
+	credentials []Credential  // tried in order on login
+	apiToken    string        // when set, sent as bearer token and the login flow is skipped
+	clockOffset time.Duration // controller clock minus local clock, from the last response's Date header
+	verifySSL   bool
+	tlsConfig   *tls.Config // shared by HTTP requests and the WebSocket
+	httpClient  *http.Client
+	csrfToken   string
+	userID      string
+	userName    string
+	ctx         context.Context    // parent of all requests; assigned once by the constructor
+	cancel      context.CancelFunc // cancels ctx, see CancelRequests
+	lastLogin   time.Time          // time of the last successful login
+	refreshStop chan struct{}      // closes the session refresh goroutine, nil when not running
+	userAgent   string             // User-Agent of every request and the WebSocket
+	headers     http.Header        // Extra headers of every request and the WebSocket, e.g. for a WAF
+	mu          sync.RWMutex
+	loginMu     sync.Mutex // serializes re-logins triggered by expired sessions
 }
 
 // NewClient creates a new UniFi Access API client
 func NewClient(host, username, password string, verifySSL bool) *Client {
+	return NewClientWithCredentials(host, []Credential{{Username: username, Password: password}}, verifySSL)
+}
+
+// NewClientWithCredentials creates a client that fails over to the next
+// credential when logging in with one is rejected, e.g. because the primary
+// service account is locked.
+func NewClientWithCredentials(host string, credentials []Credential, verifySSL bool) *Client {
 	jar, _ := cookiejar.New(nil)
 
+	// Shared by the HTTP transport and the WebSocket dialer
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: !verifySSL,
+	}
 	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: !verifySSL,
-		},
+		TLSClientConfig: tlsConfig,
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return &Client{
-		host:      strings.TrimSuffix(host, "/"),
-		username:  username,
-		password:  password,
-		verifySSL: verifySSL,
+		host:        strings.TrimSuffix(host, "/"),
+		credentials: credentials,
+		verifySSL:   verifySSL,
+		tlsConfig:   tlsConfig,
+		ctx:         ctx,
+		cancel:      cancel,
+		userAgent:   DefaultUserAgent(),
 		httpClient: &http.Client{
 			Jar:       jar,
 			Transport: transport,
-			Timeout:   30 * time.Second,
 		},
 	}
 }
 
-// Login authenticates with the UniFi Access controller
+// CloseIdleConnections closes the keep-alive connections to the controller,
+// so none are left open after shutdown
+func (c *Client) CloseIdleConnections() {
+	c.httpClient.CloseIdleConnections()
+}
+
+// SetCAFile verifies the controller certificate against the CA certificates
+// in a PEM file instead of the system roots, e.g. for the self-signed
+// certificate of a UniFi OS console. It enables verification. Must be called
+// before the first request.
+func (c *Client) SetCAFile(path string) error {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("read CA file %s: no PEM certificates found", path)
+	}
+
+	c.tlsConfig.RootCAs = pool
+	c.tlsConfig.InsecureSkipVerify = false
+	c.verifySSL = true
+	return nil
+}
+
+// TLSConfig returns a copy of the TLS config used for the controller
+func (c *Client) TLSConfig() *tls.Config {
+	return c.tlsConfig.Clone()
+}
+
+// Timeout of a single request, applied as deadline on the request context
+const requestTimeout = 30 * time.Second
+
+// CancelRequests aborts requests in flight, e.g. a hanging bootstrap on
+// shutdown. Requests sent afterwards fail right away.
+func (c *Client) CancelRequests() {
+	c.cancel()
+}
+
+// context returns the parent context of requests. It is never reassigned, so
+// it is read without c.mu.
+func (c *Client) context() context.Context {
+	return c.ctx
+}
+
+// Login authenticates with the UniFi Access controller. Credentials are tried
+// in order; the next one is only tried when the controller rejects the
+// previous one as unauthorized, not on network or server errors.
 func (c *Client) Login() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if c.apiToken != "" {
+		logger.Debug("Using API token, skipping login")
+		return nil
+	}
+
+	var err error
+	for i, cred := range c.credentials {
+		err = c.login(cred)
+		if err == nil {
+			c.lastLogin = time.Now()
+			if i > 0 {
+				logger.Warn("Logged in with fallback credential", "username", cred.Username, "index", i)
+			}
+			return nil
+		}
+
+		// Rate limits and server errors would fail the fallbacks the same way
+		// and could lock them out too
+		if !IsAuthError(err) {
+			return err
+		}
+		if i < len(c.credentials)-1 {
+			logger.Warn("Login rejected, trying next credential", "username", cred.Username, "err", err)
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("no credentials configured")
+	}
+	return err
+}
+
+// login authenticates with a single credential. Must be called with c.mu held.
+func (c *Client) login(cred Credential) error {
+	c.userID = ""
+	c.userName = ""
+
 	// Step 1: Get initial CSRF token by making a request to the base URL
 	if err := c.acquireCSRFToken(); err != nil {
 		logger.Warn("Failed to acquire initial CSRF token", "err", err)
@@ -67,8 +188,8 @@ func (c *Client) Login() error {
 	url := fmt.Sprintf("%s/api/auth/login", c.host)
 
 	payload := map[string]interface{}{
-		"username":   c.username,
-		"password":   c.password,
+		"username":   cred.Username,
+		"password":   cred.Password,
 		"token":      "",
 		"rememberMe": true,
 	}
@@ -78,11 +199,15 @@ func (c *Client) Login() error {
 		return fmt.Errorf("failed to marshal login payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	ctx, cancel := context.WithTimeout(c.ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
 	if err != nil {
 		return fmt.Errorf("failed to create login request: %w", err)
 	}
 
+	c.applyHeaders(req.Header)
 	req.Header.Set("Content-Type", "application/json")
 	if c.csrfToken != "" {
 		req.Header.Set("X-Csrf-Token", c.csrfToken)
@@ -106,7 +231,7 @@ func (c *Client) Login() error {
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("login failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		return fmt.Errorf("login failed: %w", &APIError{StatusCode: resp.StatusCode, Body: string(bodyBytes)})
 	}
 
 	// Extract CSRF token from response header
@@ -130,19 +255,80 @@ func (c *Client) Login() error {
 
 	// Use username as display name if not extracted from JWT
 	if c.userName == "" {
-		c.userName = c.username
+		c.userName = cred.Username
 	}
 
-	logger.Info("Successfully logged in to UniFi Access controller")
+	logger.Info("Successfully logged in to UniFi Access controller", "username", cred.Username)
 	return nil
 }
 
-// acquireCSRFToken gets the initial CSRF token from the controller
+// SetSite selects a UniFi OS site for multi-site consoles. The default
+// site is used when empty. Must be called before the first request.
+func (c *Client) SetSite(site string) {
+	c.site = site
+}
+
+// DefaultUserAgent returns the User-Agent identifying this gateway and its version
+func DefaultUserAgent() string {
+	return "unifi-access-mqtt/" + buildinfo.Get().Version
+}
+
+// SetUserAgent replaces the User-Agent of the requests; empty keeps
+// DefaultUserAgent. Must be called before the first request.
+func (c *Client) SetUserAgent(userAgent string) {
+	if userAgent != "" {
+		c.userAgent = userAgent
+	}
+}
+
+// SetHeaders adds headers to every request and the WebSocket handshake, e.g.
+// one a reverse proxy requires. They don't replace the headers of the session
+// (Authorization, Cookie, X-Csrf-Token). Must be called before the first request.
+func (c *Client) SetHeaders(headers map[string]string) {
+	c.headers = make(http.Header, len(headers))
+	for name, value := range headers {
+		c.headers.Set(name, value)
+	}
+}
+
+// applyHeaders sets the configured User-Agent and extra headers on h
+func (c *Client) applyHeaders(h http.Header) {
+	for name, values := range c.headers {
+		h[name] = values
+	}
+	h.Set("User-Agent", c.userAgent)
+}
+
+// SetAPIToken configures an API token. Requests then carry it as bearer
+// token instead of relying on a username/password session.
+func (c *Client) SetAPIToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.apiToken = token
+}
+
+// authorizationHeader returns the Authorization header value, or "" when no
+// API token is configured
+func (c *Client) authorizationHeader() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.apiToken == "" {
+		return ""
+	}
+	return "Bearer " + c.apiToken
+}
+
+// acquireCSRFToken gets the initial CSRF token from the controller. Must be
+// called with c.mu held.
 func (c *Client) acquireCSRFToken() error {
-	req, err := http.NewRequest("GET", c.host, nil)
+	ctx, cancel := context.WithTimeout(c.ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.host, nil)
 	if err != nil {
 		return err
 	}
+	c.applyHeaders(req.Header)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -230,7 +416,7 @@ func (c *Client) Bootstrap() (*BootstrapResponse, error) {
 	url := c.getAccessAPIURL("/devices/topology4")
 	logger.Debug("Bootstrap URL", "url", url)
 
-	data, err := c.get(url)
+	data, err := c.get(c.context(), url)
 	if err != nil {
 		return nil, fmt.Errorf("bootstrap request failed: %w", err)
 	}
@@ -294,8 +480,12 @@ func (c *Client) Bootstrap() (*BootstrapResponse, error) {
 						device := group[i]
 						// Associate device with door
 						device.Door = &DoorReference{
-							UniqueID: door.UniqueID,
-							Name:     door.Name,
+							UniqueID:     door.UniqueID,
+							Name:         door.Name,
+							BuildingID:   building.UniqueID,
+							BuildingName: building.Name,
+							FloorID:      floor.UniqueID,
+							FloorName:    floor.Name,
 						}
 						response.Devices = append(response.Devices, device)
 
@@ -315,57 +505,161 @@ func (c *Client) Bootstrap() (*BootstrapResponse, error) {
 
 // Unlock unlocks a device/door
 func (c *Client) Unlock(deviceID string) error {
+	return c.unlock(c.context(), deviceID)
+}
+
+// unlock unlocks a device/door with the request ID of ctx
+func (c *Client) unlock(ctx context.Context, deviceID string) error {
 	url := c.getAccessAPIURL(fmt.Sprintf("/device/%s/unlock", deviceID))
 
-	_, err := c.put(url, map[string]interface{}{})
+	_, err := c.put(ctx, url, map[string]interface{}{})
 	if err != nil {
 		return fmt.Errorf("unlock request failed: %w", err)
 	}
 
-	logger.Info("Successfully unlocked device", "device", deviceID)
+	logger.Info("Successfully unlocked device", "device", deviceID, "req_id", requestIDFromContext(ctx))
+	return nil
+}
+
+// UnlockForDuration unlocks a device/door for the given number of seconds
+// using the timed-unlock endpoint. Older firmware doesn't know the endpoint
+// (see APIError.IsUnsupported).
+func (c *Client) UnlockForDuration(deviceID string, seconds int) error {
+	return c.unlockForDuration(c.context(), deviceID, seconds)
+}
+
+// unlockForDuration performs a timed unlock with the request ID of ctx
+func (c *Client) unlockForDuration(ctx context.Context, deviceID string, seconds int) error {
+	url := c.getAccessAPIURL(fmt.Sprintf("/device/%s/timed_unlock", deviceID))
+
+	_, err := c.put(ctx, url, map[string]interface{}{"duration": seconds})
+	if err != nil {
+		return fmt.Errorf("timed unlock request failed: %w", err)
+	}
+
+	logger.Info("Successfully unlocked device", "device", deviceID, "seconds", seconds, "req_id", requestIDFromContext(ctx))
+	return nil
+}
+
+// unlockLocationForDuration unlocks a door location (used by UGT gates) for
+// seconds instead of its configured unlock duration
+func (c *Client) unlockLocationForDuration(ctx context.Context, locationID string, seconds int) error {
+	url := c.getAccessAPIURL(fmt.Sprintf("/location/%s/timed_unlock", locationID))
+
+	_, err := c.put(ctx, url, map[string]interface{}{"duration": seconds})
+	if err != nil {
+		return fmt.Errorf("timed unlock location request failed: %w", err)
+	}
+
+	logger.Info("Successfully unlocked location", "location", locationID, "seconds", seconds, "req_id", requestIDFromContext(ctx))
+	return nil
+}
+
+// Lock locks a device/door. Only supported by newer controller firmware.
+func (c *Client) Lock(deviceID string) error {
+	return c.lock(c.context(), deviceID)
+}
+
+// lock locks a device/door with the request ID of ctx
+func (c *Client) lock(ctx context.Context, deviceID string) error {
+	url := c.getAccessAPIURL(fmt.Sprintf("/device/%s/lock", deviceID))
+
+	_, err := c.put(ctx, url, map[string]interface{}{})
+	if err != nil {
+		return fmt.Errorf("lock request failed: %w", err)
+	}
+
+	logger.Info("Successfully locked device", "device", deviceID, "req_id", requestIDFromContext(ctx))
+	return nil
+}
+
+// lockLocation locks a door location (used by UGT gates) with the request ID
+// of ctx
+func (c *Client) lockLocation(ctx context.Context, locationID string) error {
+	url := c.getAccessAPIURL(fmt.Sprintf("/location/%s/lock", locationID))
+
+	_, err := c.put(ctx, url, map[string]interface{}{})
+	if err != nil {
+		return fmt.Errorf("lock location request failed: %w", err)
+	}
+
+	logger.Info("Successfully locked location", "location", locationID, "req_id", requestIDFromContext(ctx))
+	return nil
+}
+
+// Reboot restarts a device (hub or reader)
+func (c *Client) Reboot(deviceID string) error {
+	url := c.getAccessAPIURL(fmt.Sprintf("/device/%s/reboot", deviceID))
+
+	_, err := c.put(c.context(), url, map[string]interface{}{})
+	if err != nil {
+		return fmt.Errorf("reboot request failed: %w", err)
+	}
+
+	logger.Info("Successfully requested device reboot", "device", deviceID)
 	return nil
 }
 
 // UnlockLocation unlocks a door by location ID (for UGT devices)
 func (c *Client) UnlockLocation(locationID string) error {
+	return c.unlockLocation(c.context(), locationID)
+}
+
+// unlockLocation unlocks a location with the request ID of ctx
+func (c *Client) unlockLocation(ctx context.Context, locationID string) error {
 	url := c.getAccessAPIURL(fmt.Sprintf("/location/%s/unlock", locationID))
 
-	_, err := c.put(url, map[string]interface{}{})
+	_, err := c.put(ctx, url, map[string]interface{}{})
 	if err != nil {
 		return fmt.Errorf("unlock location request failed: %w", err)
 	}
 
-	logger.Info("Successfully unlocked location", "location", locationID)
+	logger.Info("Successfully unlocked location", "location", locationID, "req_id", requestIDFromContext(ctx))
 	return nil
 }
 
 // DismissDoorbellCall dismisses/declines an active doorbell call
 func (c *Client) DismissDoorbellCall(deviceID, requestID, userID, userName string) error {
+	if err := c.replyRemote(deviceID, requestID, userID, userName, "denied"); err != nil {
+		return fmt.Errorf("dismiss doorbell call failed: %w", err)
+	}
+
+	logger.Info("Successfully dismissed doorbell call", "request_id", requestID)
+	return nil
+}
+
+// AnswerDoorbellCall accepts an active doorbell call
+func (c *Client) AnswerDoorbellCall(deviceID, requestID, userID, userName string) error {
+	if err := c.replyRemote(deviceID, requestID, userID, userName, "accepted"); err != nil {
+		return fmt.Errorf("answer doorbell call failed: %w", err)
+	}
+
+	logger.Info("Successfully answered doorbell call", "request_id", requestID)
+	return nil
+}
+
+// replyRemote replies to a doorbell call with response "accepted" or "denied"
+func (c *Client) replyRemote(deviceID, requestID, userID, userName, response string) error {
 	url := c.getAccessAPIURL(fmt.Sprintf("/device/%s/reply_remote", deviceID))
-	logger.Debug("Dismissing doorbell call", "url", url)
+	logger.Debug("Replying to doorbell call", "url", url, "response", response)
 
 	payload := map[string]interface{}{
 		"device_id":  deviceID,
-		"response":   "denied",
+		"response":   response,
 		"request_id": requestID,
 		"user_id":    userID,
 		"user_name":  userName,
 	}
 
-	_, err := c.post(url, payload)
-	if err != nil {
-		return fmt.Errorf("dismiss doorbell call failed: %w", err)
-	}
-
-	logger.Info("Successfully dismissed doorbell call", "request_id", requestID)
-	return nil
+	_, err := c.post(c.context(), url, payload)
+	return err
 }
 
 // GetWebSocketURL returns the WebSocket URL for real-time events
 func (c *Client) GetWebSocketURL() string {
 	host := strings.TrimPrefix(c.host, "https://")
 	host = strings.TrimPrefix(host, "http://")
-	return fmt.Sprintf("wss://%s/proxy/access/api/v2/ws/notification", host)
+	return fmt.Sprintf("wss://%s%s/ws/notification", host, c.accessAPIPath())
 }
 
 // DoorbellRingRequest contains the information needed to trigger a doorbell ring
@@ -377,17 +671,27 @@ type DoorbellRingRequest struct {
 	ControllerID string   // Controller ID (optional, will use device ID if empty)
 	InOrOut      string   // "in" or "out" (default: "in")
 	ViewerIDs    []string // Viewer device IDs to notify (notify_door_guards)
+	RequestID    string   // Request ID of the call (optional, generated if empty)
+	FanOut       bool     // Send one remote_call per viewer, so an offline viewer doesn't fail the ring
 }
 
 // TriggerDoorbellRing triggers a doorbell ring via the remote_call API
 // This uses the DoorbellRequestBody format that the reader uses when someone presses the button
 func (c *Client) TriggerDoorbellRing(req DoorbellRingRequest) error {
+	return c.triggerDoorbellRing(c.context(), req)
+}
+
+// triggerDoorbellRing triggers a doorbell ring with the request ID of ctx
+func (c *Client) triggerDoorbellRing(ctx context.Context, req DoorbellRingRequest) error {
 	url := c.getAccessAPIURL(fmt.Sprintf("/device/%s/remote_call", req.DeviceID))
-	logger.Debug("Triggering doorbell ring", "url", url)
+	logger.Debug("Triggering doorbell ring", "url", url, "req_id", requestIDFromContext(ctx))
 
 	// Generate unique IDs similar to what the reader does
 	roomID := fmt.Sprintf("PR-%s", generateUUID())
-	requestID := generateRandomString(32)
+	requestID := req.RequestID
+	if requestID == "" {
+		requestID = generateRandomString(32)
+	}
 	now := time.Now().Unix()
 
 	// Use device ID as controller ID if not provided
@@ -425,34 +729,86 @@ func (c *Client) TriggerDoorbellRing(req DoorbellRingRequest) error {
 		"notify_door_guards": viewerIDs,
 	}
 
+	if req.FanOut && len(viewerIDs) > 1 {
+		return c.fanOutDoorbellRing(ctx, url, payload, viewerIDs)
+	}
+	return c.remoteCall(ctx, url, payload)
+}
+
+// fanOutDoorbellRing sends the ring payload once per viewer. All calls share
+// the request ID, so the ring is still a single call for dismiss and answer.
+// It succeeds when at least one viewer was notified.
+func (c *Client) fanOutDoorbellRing(ctx context.Context, url string, payload map[string]interface{}, viewerIDs []string) error {
+	result := &ViewerRingError{Failed: make(map[string]error)}
+	for _, viewer := range viewerIDs {
+		single := maps.Clone(payload)
+		single["notify_door_guards"] = []string{viewer}
+		if err := c.remoteCall(ctx, url, single); err != nil {
+			logger.Debug("Doorbell ring failed for viewer", "viewer", viewer, "req_id", requestIDFromContext(ctx), "err", err)
+			result.Failed[viewer] = err
+			continue
+		}
+		logger.Debug("Doorbell ring sent to viewer", "viewer", viewer, "req_id", requestIDFromContext(ctx))
+		result.Notified = append(result.Notified, viewer)
+	}
+
+	if len(result.Failed) == 0 {
+		return nil
+	}
+	if len(result.Notified) > 0 {
+		logger.Warn("Doorbell ring reached only some viewers", "notified", result.Notified, "err", result)
+		return nil
+	}
+	return result
+}
+
+// remoteCall posts a DoorbellRequestBody to the remote_call endpoint url
+func (c *Client) remoteCall(ctx context.Context, url string, payload map[string]interface{}) error {
 	logger.Trace("DoorbellRequestBody payload", "payload", payload)
 
-	respBody, err := c.post(url, payload)
+	respBody, err := c.post(ctx, url, payload)
 	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && isCallInProgress(parseEnvelope([]byte(apiErr.Body))) {
+			return fmt.Errorf("remote_call request failed: %w", ErrCallInProgress)
+		}
 		return fmt.Errorf("remote_call request failed: %w", err)
 	}
 
 	logger.Trace("Remote call response", "body", string(respBody))
+
+	// Some firmware answers 200 with the error code in the envelope
+	if isCallInProgress(parseEnvelope(respBody)) {
+		return fmt.Errorf("remote_call request failed: %w", ErrCallInProgress)
+	}
 	return nil
 }
 
-// generateUUID generates a simple UUID v4
+// generateUUID generates a random RFC 4122 version 4 UUID
 func generateUUID() string {
 	b := make([]byte, 16)
-	for i := range b {
-		b[i] = byte(time.Now().UnixNano() % 256)
-		time.Sleep(time.Nanosecond)
-	}
+	_, _ = rand.Read(b)         // never returns an error
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10 (RFC 4122)
 	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
 }
 
 // generateRandomString generates a random alphanumeric string
 func generateRandomString(length int) string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	result := make([]byte, length)
-	for i := range result {
-		result[i] = charset[time.Now().UnixNano()%int64(len(charset))]
-		time.Sleep(time.Nanosecond)
+	// Largest multiple of len(charset) that fits in a byte; bytes above it are
+	// rejected so every character is equally likely
+	const limit = 256 - 256%len(charset)
+
+	result := make([]byte, 0, length)
+	buf := make([]byte, length)
+	for len(result) < length {
+		_, _ = rand.Read(buf)
+		for _, b := range buf {
+			if int(b) < limit && len(result) < length {
+				result = append(result, charset[int(b)%len(charset)])
+			}
+		}
 	}
 	return string(result)
 }
@@ -471,14 +827,31 @@ func (c *Client) GetCookies() []*http.Cookie {
 	return c.httpClient.Jar.Cookies(req.URL)
 }
 
+// ControllerTime returns the current time on the controller's clock, estimated
+// from the Date header of the last response (second resolution)
+func (c *Client) ControllerTime() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return time.Now().Add(c.clockOffset)
+}
+
 // getAccessAPIURL constructs the full Access API URL (v2)
 func (c *Client) getAccessAPIURL(path string) string {
-	return fmt.Sprintf("%s/proxy/access/api/v2%s", c.host, path)
+	return fmt.Sprintf("%s%s%s", c.host, c.accessAPIPath(), path)
+}
+
+// accessAPIPath returns the path of the Access API (v2), selecting the site
+// when one is configured
+func (c *Client) accessAPIPath() string {
+	if c.site == "" {
+		return "/proxy/access/api/v2"
+	}
+	return "/proxy/access/api/v2/s/" + url.PathEscape(c.site)
 }
 
 // get performs a GET request
-func (c *Client) get(url string) ([]byte, error) {
-	req, err := http.NewRequest("GET", url, nil)
+func (c *Client) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -487,7 +860,7 @@ func (c *Client) get(url string) ([]byte, error) {
 }
 
 // put performs a PUT request
-func (c *Client) put(url string, payload interface{}) ([]byte, error) {
+func (c *Client) put(ctx context.Context, url string, payload interface{}) ([]byte, error) {
 	var body io.Reader
 	if payload != nil {
 		data, err := json.Marshal(payload)
@@ -499,7 +872,7 @@ func (c *Client) put(url string, payload interface{}) ([]byte, error) {
 		body = bytes.NewBuffer([]byte("{}"))
 	}
 
-	req, err := http.NewRequest("PUT", url, body)
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, body)
 	if err != nil {
 		return nil, err
 	}
@@ -510,7 +883,7 @@ func (c *Client) put(url string, payload interface{}) ([]byte, error) {
 }
 
 // post performs a POST request
-func (c *Client) post(url string, payload interface{}) ([]byte, error) {
+func (c *Client) post(ctx context.Context, url string, payload interface{}) ([]byte, error) {
 	var body io.Reader
 	if payload != nil {
 		data, err := json.Marshal(payload)
@@ -520,7 +893,7 @@ func (c *Client) post(url string, payload interface{}) ([]byte, error) {
 		body = bytes.NewBuffer(data)
 	}
 
-	req, err := http.NewRequest("POST", url, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
 		return nil, err
 	}
@@ -530,21 +903,76 @@ func (c *Client) post(url string, payload interface{}) ([]byte, error) {
 	return c.doRequest(req)
 }
 
-// doRequest performs an HTTP request with proper headers
+// delete performs a DELETE request
+func (c *Client) delete(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.doRequest(req)
+}
+
+// doRequest performs an HTTP request with proper headers. The request fails
+// when its context is cancelled or requestTimeout has passed.
 func (c *Client) doRequest(req *http.Request) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), requestTimeout)
+	defer cancel()
+	// Correlate the log lines of this call, and of its retry
+	if requestIDFromContext(ctx) == "" {
+		ctx = withRequestID(ctx, newRequestID())
+	}
+	req = req.WithContext(ctx)
+
+	sent := time.Now()
+	body, err := c.send(req)
+	if !c.retryUnauthorized(req, err) {
+		return body, err
+	}
+
+	// The session expired or the CSRF token was rotated: log in again, which
+	// also acquires a new CSRF token, and retry once. The retry's result is
+	// returned as is, so a request is never sent more than twice.
+	logger.Debug("Request unauthorized, logging in again", "path", req.URL.Path, "req_id", requestIDFromContext(ctx), "err", err)
+	if loginErr := c.refreshSession(sent); loginErr != nil {
+		return nil, fmt.Errorf("%w (re-login failed: %v)", err, loginErr)
+	}
+
+	retry := req.Clone(req.Context())
+	retry.Header.Del("X-Csrf-Token") // set again by send, if the login returned one
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return c.send(retry)
+}
+
+// send performs a single HTTP request with the session's CSRF token
+func (c *Client) send(req *http.Request) ([]byte, error) {
 	c.mu.RLock()
 	csrfToken := c.csrfToken
 	c.mu.RUnlock()
 
+	c.applyHeaders(req.Header)
 	if csrfToken != "" {
 		req.Header.Set("X-Csrf-Token", csrfToken)
 	}
+	if authorization := c.authorizationHeader(); authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
 
+	id := requestIDFromContext(req.Context())
+	logger.Debug("API request", "method", req.Method, "url", req.URL.Redacted(), "req_id", id)
+	started := time.Now()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
+		logger.Debug("API request failed", "method", req.Method, "path", req.URL.Path, "req_id", id, "err", err)
 		return nil, err
 	}
 	defer resp.Body.Close()
+	logger.Debug("API response", "method", req.Method, "path", req.URL.Path, "status", resp.StatusCode,
+		"duration", time.Since(started).Round(time.Millisecond), "req_id", id)
 
 	// Update CSRF token if present in response
 	if newToken := resp.Header.Get("X-Updated-Csrf-Token"); newToken != "" {
@@ -557,13 +985,22 @@ func (c *Client) doRequest(req *http.Request) ([]byte, error) {
 		c.mu.Unlock()
 	}
 
+	// Track the controller clock so time windows can be evaluated in its time
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		c.mu.Lock()
+		c.clockOffset = time.Until(date)
+		c.mu.Unlock()
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+		err := &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+		logger.Debug("API request failed", "method", req.Method, "path", req.URL.Path, "req_id", id, "err", err)
+		return nil, err
 	}
 
 	return body, nil
@@ -0,0 +1,259 @@
+package unifi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestGenerateUUIDUnique(t *testing.T) {
+	seen := make(map[string]bool, 10000)
+	for range 10000 {
+		id := generateUUID()
+		if !uuidV4.MatchString(id) {
+			t.Fatalf("generateUUID() = %q, not a v4 UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate UUID %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestGenerateRandomStringUnique(t *testing.T) {
+	alnum := regexp.MustCompile(`^[a-zA-Z0-9]{32}$`)
+	seen := make(map[string]bool, 10000)
+	for range 10000 {
+		s := generateRandomString(32)
+		if !alnum.MatchString(s) {
+			t.Fatalf("generateRandomString(32) = %q", s)
+		}
+		if seen[s] {
+			t.Fatalf("duplicate random string %q", s)
+		}
+		seen[s] = true
+	}
+}
+
+func TestSiteInURLs(t *testing.T) {
+	tests := []struct {
+		site    string
+		wantAPI string
+		wantWS  string
+		wantDev string
+	}{
+		{"", "https://192.168.1.1/proxy/access/api/v2/devices", "wss://192.168.1.1/proxy/access/api/v2/ws/notification",
+			"https://192.168.1.1/proxy/access/api/v1/developer/door_schedules"},
+		{"branch", "https://192.168.1.1/proxy/access/api/v2/s/branch/devices", "wss://192.168.1.1/proxy/access/api/v2/s/branch/ws/notification",
+			"https://192.168.1.1/proxy/access/api/v1/developer/s/branch/door_schedules"},
+	}
+	for _, tt := range tests {
+		c := NewClientWithCredentials("https://192.168.1.1/", nil, false)
+		c.SetSite(tt.site)
+		if got := c.getAccessAPIURL("/devices"); got != tt.wantAPI {
+			t.Errorf("site %q: getAccessAPIURL = %q, want %q", tt.site, got, tt.wantAPI)
+		}
+		if got := c.GetWebSocketURL(); got != tt.wantWS {
+			t.Errorf("site %q: GetWebSocketURL = %q, want %q", tt.site, got, tt.wantWS)
+		}
+		if got := c.getDeveloperAPIURL("/door_schedules"); got != tt.wantDev {
+			t.Errorf("site %q: getDeveloperAPIURL = %q, want %q", tt.site, got, tt.wantDev)
+		}
+	}
+}
+
+func TestCustomHeadersAndUserAgent(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Write([]byte(`{"code":"SUCCESS"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	c := NewClientWithCredentials(server.URL, nil, false)
+	if _, err := c.get(c.context(), server.URL+"/devices"); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if ua := got.Get("User-Agent"); ua != DefaultUserAgent() {
+		t.Errorf("default User-Agent = %q, want %q", ua, DefaultUserAgent())
+	}
+
+	c.SetUserAgent("site-gateway/1.0")
+	c.SetHeaders(map[string]string{"X-Waf-Key": "secret", "Authorization": "ignored"})
+	c.SetAPIToken("token")
+	if _, err := c.get(c.context(), server.URL+"/devices"); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if ua := got.Get("User-Agent"); ua != "site-gateway/1.0" {
+		t.Errorf("User-Agent = %q, want site-gateway/1.0", ua)
+	}
+	if key := got.Get("X-Waf-Key"); key != "secret" {
+		t.Errorf("X-Waf-Key = %q, want secret", key)
+	}
+	// Session headers take precedence over configured ones
+	if auth := got.Get("Authorization"); auth != "Bearer token" {
+		t.Errorf("Authorization = %q, want the API token", auth)
+	}
+}
+
+func TestStaleCSRFTokenRetriedAfterLogin(t *testing.T) {
+	var devices atomic.Int32
+	var alwaysReject atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("X-Csrf-Token", "fresh")
+		case "/api/auth/login":
+			w.Header().Set("X-Updated-Csrf-Token", "fresh")
+		default:
+			devices.Add(1)
+			if alwaysReject.Load() || r.Header.Get("X-Csrf-Token") != "fresh" {
+				http.Error(w, `{"error":"Invalid CSRF Token"}`, http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"code":"SUCCESS"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	c := NewClientWithCredentials(server.URL, []Credential{{Username: "user", Password: "pass"}}, false)
+	c.csrfToken = "stale"
+	if _, err := c.get(c.context(), server.URL+"/devices"); err != nil {
+		t.Fatalf("get with a stale CSRF token: %v", err)
+	}
+	if n := devices.Load(); n != 2 {
+		t.Errorf("requests = %d, want the original and one retry", n)
+	}
+
+	// A token that keeps being rejected is retried only once
+	alwaysReject.Store(true)
+	devices.Store(0)
+	if _, err := c.get(c.context(), server.URL+"/devices"); err == nil {
+		t.Fatal("get succeeded although every request is rejected")
+	}
+	if n := devices.Load(); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+}
+
+func TestLoginFallsBackOnlyOnRejectedCredentials(t *testing.T) {
+	tests := []struct {
+		status int
+		want   []string
+	}{
+		{http.StatusUnauthorized, []string{"primary", "fallback"}},
+		{http.StatusTooManyRequests, []string{"primary"}},
+		{http.StatusInternalServerError, []string{"primary"}},
+	}
+
+	for _, tt := range tests {
+		var mu sync.Mutex
+		var tried []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/auth/login" {
+				return
+			}
+			var cred Credential
+			json.NewDecoder(r.Body).Decode(&cred)
+			mu.Lock()
+			tried = append(tried, cred.Username)
+			mu.Unlock()
+			if cred.Username == "primary" {
+				w.WriteHeader(tt.status)
+			}
+		}))
+
+		c := NewClientWithCredentials(server.URL, []Credential{{Username: "primary"}, {Username: "fallback"}}, false)
+		c.Login()
+		server.Close()
+
+		if !slices.Equal(tried, tt.want) {
+			t.Errorf("status %d: tried %v, want %v", tt.status, tried, tt.want)
+		}
+	}
+}
+
+func TestDeveloperAPIRequiresToken(t *testing.T) {
+	server := newFakeAccessServer(t)
+	c := NewClientWithCredentials(server.URL, []Credential{{Username: "user", Password: "pass"}}, false)
+
+	if _, err := c.GetDoorLockRule("location-1"); !errors.Is(err, ErrDeveloperAPIToken) {
+		t.Errorf("without API token: err = %v, want ErrDeveloperAPIToken", err)
+	}
+	if got := server.lastRequest(); got != "" {
+		t.Errorf("request %q sent with the session login", got)
+	}
+
+	c.SetAPIToken("token")
+	if _, err := c.GetDoorLockRule("location-1"); err != nil {
+		t.Fatalf("with API token: %v", err)
+	}
+	if got := server.lastRequest(); got != "GET /proxy/access/api/v1/developer/doors/location-1/lock_rule" {
+		t.Errorf("request = %q", got)
+	}
+}
+
+func TestCredentialIDsEscapedInPath(t *testing.T) {
+	server := newFakeAccessServer(t)
+	c := NewClientWithCredentials(server.URL, nil, false)
+	c.SetAPIToken("token")
+
+	// The response has no credential ID; only the request matters here
+	_, _ = c.CreatePinCredential("../../device/hub-1/unlock", "1234", time.Time{}, time.Time{})
+	if got := server.lastRequest(); got != "POST /proxy/access/api/v1/developer/users/..%2F..%2Fdevice%2Fhub-1%2Funlock/pin_codes" {
+		t.Errorf("create request = %q", got)
+	}
+	if err := c.DeleteCredential("credential-1/../../x"); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.lastRequest(); got != "DELETE /proxy/access/api/v1/developer/credentials/credential-1%2F..%2F..%2Fx" {
+		t.Errorf("delete request = %q", got)
+	}
+}
+
+func TestPingMatchesTheAuthMode(t *testing.T) {
+	server := newFakeAccessServer(t)
+	c := NewClientWithCredentials(server.URL, []Credential{{Username: "user", Password: "pass"}}, false)
+
+	if err := c.Ping(); err != nil {
+		t.Fatalf("Ping with the session: %v", err)
+	}
+	if got := server.lastRequest(); got != "GET /api/users/self" {
+		t.Errorf("session probe = %q, want GET /api/users/self", got)
+	}
+
+	c.SetAPIToken("token")
+	if err := c.Ping(); err != nil {
+		t.Fatalf("Ping with the API token: %v", err)
+	}
+	if got := server.lastRequest(); got != "GET /proxy/access/api/v1/developer/doors" {
+		t.Errorf("token probe = %q, want the developer API", got)
+	}
+}
+
+func TestIsCallInProgress(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{`{"code":"CODE_DEVICE_IN_CALL","msg":"device is in a call"}`, true},
+		{`{"codeS":"CODE_REMOTE_CALL_IN_PROGRESS","code":1}`, true},
+		{`{"code":"CODE_DEVICE_DEVICE_OFFLINE","msg":"device busy or offline"}`, false},
+		{`{"code":"CODE_PARAMS_INVALID","msg":"request already submitted"}`, false},
+		{`not json`, false},
+	}
+	for _, tt := range tests {
+		if got := isCallInProgress(parseEnvelope([]byte(tt.body))); got != tt.want {
+			t.Errorf("isCallInProgress(%s) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
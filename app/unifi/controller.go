@@ -1,9 +1,15 @@
 package unifi
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/philipparndt/go-logger"
 )
@@ -19,32 +25,104 @@ type DoorbellConfig struct {
 
 // Controller manages the connection to UniFi Access and device state
 type Controller struct {
+	name           string // Controller name from the config ("" with a single unnamed controller)
 	client         *Client
+	api            accessAPI // Requests to the controller, the client unless a test replaced it
+	disconnectOnce sync.Once
 	eventListener  *EventListener
 	doors          map[string]*Door
 	doorsByName    map[string]*Door
 	viewers        map[string]bool // Track known viewer device IDs
 	readers        map[string]bool // Track known reader device IDs (UA-G3, UA-G3-Pro, etc.)
+	readerDevices  []DeviceConfig  // Reader devices from the last bootstrap (for capability reports)
 	doorbellConfig *DoorbellConfig // Configured doorbell devices
+	doorbellFanOut bool            // Ring each viewer with its own remote_call
+	host           ControllerHost  // Controller information from the last bootstrap
+	version        string          // Access application version from the last bootstrap
+	entryWindow    time.Duration   // Window after an unlock in which an opening counts as an entry
+	doorFilter     doorFilter      // Doors to export (all by default)
 	mu             sync.RWMutex
 
+	heldOpenThreshold time.Duration          // Time a door may stay open before it is reported as held open
+	heldOpenTimers    map[string]*time.Timer // Running held-open timers by door key
+	alarmTimers       map[string]*time.Timer // Pending forced-open checks by door key
+	ringTimeout       time.Duration          // Time a call may ring before it is cleared without a cancel
+	ringTimers        map[string]*time.Timer // Running ring timeouts by door key
+	gatewayUnlocks    map[string]time.Time   // Time of the last unlock by the gateway by door key
+
+	selfTriggered         map[string]time.Time // Request IDs of rings triggered by the gateway
+	suppressSelfTriggered bool                 // Don't fire OnDoorbellRing for self-triggered rings
+	selfTriggeredMu       sync.Mutex
+
+	dryRun bool // Log door commands instead of sending them to the controller
+
+	refreshMu sync.Mutex // Serializes Refresh
+
+	bootstrapCachePath string // File the last bootstrap is cached in ("" = no cache)
+
+	doorGroups    map[string][]string // Named groups of door names or IDs, for group commands
+	readOnlyDoors []string            // Names or IDs of doors that reject unlock and lock commands
+
+	lockRuleFailing  atomic.Bool // Lock rule requests are failing; warned on the first failure
+	schedulesFailing atomic.Bool // Schedule requests are failing; warned on the first failure
+
+	timeZone *time.Location // Zone schedule windows are evaluated in, nil for the gateway's
+
+	unlockLimiter *unlockLimiter // Unlocks per door, from MQTT and the HTTP API
+
+	unlockTokens map[string]unlockToken // Issued one-time unlock tokens
+	tokensMu     sync.Mutex
+	sweepOnce    sync.Once // Starts the sweep of expired tokens with the first token
+
 	// Event callbacks
-	OnDoorUpdate      func(door *Door)
-	OnDoorbellRing    func(door *Door)
-	OnDoorbellCancel  func(door *Door)
-	OnDoorbellDismiss func(door *Door) // fires when DismissDoorbellCall is invoked
+	OnDoorUpdate       func(door *Door)
+	OnDoorbellRing     func(door *Door)
+	OnDoorbellCancel   func(door *Door)
+	OnDoorbellDismiss  func(door *Door)                     // fires when DismissDoorbellCall is invoked
+	OnAnyEvent         func(event EventPacket)              // fires for every WebSocket event, including unmodelled types
+	OnDoorEntry        func(door *Door, entry EntryEvent)   // fires when a door opens shortly after an unlock
+	OnCycleCount       func(door *Door)                     // fires when the relay cycle count of a door changes
+	OnScheduleChange   func(door *Door)                     // fires when a door enters or leaves a scheduled-unlock window
+	OnDoorAccess       func(door *Door, access AccessEvent) // fires when an access log reports who unlocked a door
+	OnAccessDenied     func(door *Door, access AccessEvent) // fires when an access attempt at a door is denied
+	OnDoorHeldOpen     func(door *Door)                     // fires when a door has been open longer than the held-open threshold, and again when it closes
+	OnRefresh          func()                               // fires after Refresh bootstrapped again
+	OnDoorAlarm        func(door *Door, alarm AlarmEvent)   // fires when a door is forced open (and closed again) or a device is tampered with
+	OnDoorOnlineChange func(door *Door)                     // fires when a door's hub goes offline or comes back online
+	OnDoorRemoved      func(door *Door)                     // fires when a door's hub is deleted from the controller
+	OnDoorUnlockPulse  func(door *Door, pulse UnlockPulse)  // fires once per unlock by the gateway or a remote unlock
+	OnUnlockLimited    func(door *Door)                     // fires when an unlock is dropped by the unlock rate limit
 }
 
 // NewController creates a new UniFi Access controller
 func NewController(host, username, password string, verifySSL bool) *Controller {
-	client := NewClient(host, username, password, verifySSL)
+	return NewControllerWithCredentials(host, []Credential{{Username: username, Password: password}}, verifySSL)
+}
+
+// NewControllerWithCredentials creates a controller that logs in with the
+// first accepted credential
+func NewControllerWithCredentials(host string, credentials []Credential, verifySSL bool) *Controller {
+	client := NewClientWithCredentials(host, credentials, verifySSL)
 
 	c := &Controller{
 		client:      client,
+		api:         client,
 		doors:       make(map[string]*Door),
 		doorsByName: make(map[string]*Door),
 		viewers:     make(map[string]bool),
 		readers:     make(map[string]bool),
+		entryWindow: defaultEntryWindow,
+
+		selfTriggered: make(map[string]time.Time),
+		unlockLimiter: newUnlockLimiter(defaultUnlockRateLimit, defaultUnlockRateInterval),
+		unlockTokens:  make(map[string]unlockToken),
+
+		heldOpenThreshold: defaultHeldOpenThreshold,
+		heldOpenTimers:    make(map[string]*time.Timer),
+		alarmTimers:       make(map[string]*time.Timer),
+		ringTimeout:       defaultRingTimeout,
+		ringTimers:        make(map[string]*time.Timer),
+		gatewayUnlocks:    make(map[string]time.Time),
 	}
 
 	c.eventListener = NewEventListener(client)
@@ -52,16 +130,30 @@ func NewController(host, username, password string, verifySSL bool) *Controller
 	return c
 }
 
+// NewControllerFromBootstrap creates a controller with the doors of
+// bootstrap, as if it had connected, for tests of the packages built on the
+// controller. Nothing listens on its host, so requests fail; use SetDryRun
+// for commands.
+func NewControllerFromBootstrap(bootstrap *BootstrapResponse) (*Controller, error) {
+	c := NewControllerWithCredentials("https://127.0.0.1:1", nil, false)
+	if err := c.applyBootstrap(bootstrap); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
 // Connect establishes connection to the UniFi Access controller
 func (c *Controller) Connect() error {
 	// Login to the controller
-	if err := c.client.Login(); err != nil {
+	if err := c.api.Login(); err != nil {
 		return err
 	}
 
-	// Bootstrap to get initial device state
-	if err := c.bootstrap(); err != nil {
-		return err
+	// Bootstrap to get initial device state. Without doors the controller
+	// still connects, so it can be surfaced to the caller.
+	bootstrapErr := c.bootstrap()
+	if bootstrapErr != nil && !errors.Is(bootstrapErr, ErrNoDoors) {
+		return bootstrapErr
 	}
 
 	// Set up event handlers
@@ -73,15 +165,60 @@ func (c *Controller) Connect() error {
 		// Don't fail completely, just warn
 	}
 
-	return nil
+	return bootstrapErr
 }
 
-// Disconnect closes the connection
+// Disconnect closes the connection and cancels requests in flight, including
+// a Connect that is still running. The keep-alive connections of the API
+// client are closed too, so shutdown doesn't wait for them. Safe to call more
+// than once.
 func (c *Controller) Disconnect() {
-	c.eventListener.Stop()
+	c.disconnectOnce.Do(func() {
+		c.client.CancelRequests()
+		c.client.StopSessionRefresh()
+		c.eventListener.Stop()
+		c.client.CloseIdleConnections()
+	})
+}
+
+// EventsConnected reports whether the event WebSocket is connected
+func (c *Controller) EventsConnected() bool {
+	return c.eventListener.IsConnected()
+}
+
+// StartSessionRefresh renews the controller session every interval
+// (DefaultSessionRefreshInterval when zero)
+func (c *Controller) StartSessionRefresh(interval time.Duration) {
+	c.client.StartSessionRefresh(interval)
+}
+
+// SetName sets the name of the controller, as given in the config
+func (c *Controller) SetName(name string) {
+	c.name = name
+}
+
+// Name returns the name of the controller, as given in the config
+func (c *Controller) Name() string {
+	return c.name
+}
+
+// Host returns the controller information (MAC, name, firmware) from the
+// last bootstrap
+func (c *Controller) Host() ControllerHost {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.host
 }
 
-// GetDoors returns all doors
+// Version returns the Access application version from the last bootstrap
+func (c *Controller) Version() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.version
+}
+
+// GetDoors returns all doors, sorted by name and then by ID, so the order is
+// the same on every call
 func (c *Controller) GetDoors() []*Door {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -90,14 +227,35 @@ func (c *Controller) GetDoors() []*Door {
 	for _, door := range c.doors {
 		doors = append(doors, door)
 	}
+	sort.Slice(doors, func(i, j int) bool {
+		if doors[i].Name != doors[j].Name {
+			return doors[i].Name < doors[j].Name
+		}
+		return doors[i].Key < doors[j].Key
+	})
 	return doors
 }
 
-// GetDoor returns a door by ID
+// GetDoor returns a door by ID or by its key
 func (c *Controller) GetDoor(id string) *Door {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.doors[id]
+	return c.doorByDevice(id)
+}
+
+// doorByDevice returns the door of a hub device ID. A door that collided
+// with another one is keyed by its qualified key, so it is looked up by its
+// ID as well. Must be called with c.mu held.
+func (c *Controller) doorByDevice(deviceID string) *Door {
+	if door := c.doors[deviceID]; door != nil {
+		return door
+	}
+	for _, door := range c.doors {
+		if door.ID == deviceID {
+			return door
+		}
+	}
+	return nil
 }
 
 // GetViewerIDs returns all known viewer device IDs.
@@ -132,23 +290,159 @@ func (c *Controller) GetDoorByName(name string) *Door {
 	return c.doorsByName[NormalizeDoorName(name)]
 }
 
-// UnlockDoor unlocks a door
+// FindDoor resolves a door by ID, topic name or display name
+func (c *Controller) FindDoor(name string) *Door {
+	if door := c.GetDoor(name); door != nil {
+		return door
+	}
+	for _, door := range c.GetDoors() {
+		if SanitizeName(door.TopicName()) == name {
+			return door
+		}
+	}
+	return c.GetDoorByName(name)
+}
+
+// SetDryRun makes UnlockDoor, LockDoor, TriggerDoorbellRing, InitiateCall,
+// DismissDoorbellCall and RebootDevice log the intended action and succeed
+// without calling the controller. Events and state are handled as usual.
+func (c *Controller) SetDryRun(dryRun bool) {
+	c.dryRun = dryRun
+}
+
+// UnlockDoor unlocks a door. UGT doors are unlocked through their location,
+// all other devices directly. It returns ErrUnlockRateLimited without sending
+// anything when the door's unlock rate limit is exceeded.
 func (c *Controller) UnlockDoor(door *Door) error {
-	logger.Info("Unlocking door", "door", door.Name)
-	return c.client.Unlock(door.ID)
+	if err := c.allowUnlock(door); err != nil {
+		return err
+	}
+	return c.unlockDoor(c.operationContext(), door)
+}
+
+// unlockDoor unlocks a door, logging the request ID of ctx
+func (c *Controller) unlockDoor(ctx context.Context, door *Door) error {
+	id := requestIDFromContext(ctx)
+	logger.Info("Unlocking door", "door", door.Name, "req_id", id)
+	if c.dryRun {
+		logger.Info("Dry run: not sending unlock", "door", door.Name, "device", door.ID, "req_id", id)
+		return nil
+	}
+	var err error
+	if door.Device.DeviceType == DeviceTypeUGT && door.LocationID != "" {
+		err = c.api.unlockLocation(ctx, door.LocationID)
+	} else {
+		err = c.api.unlock(ctx, door.ID)
+	}
+	if err != nil {
+		logger.Debug("Unlock failed", "door", door.Name, "req_id", id, "err", err)
+		return err
+	}
+	c.countUnlock(door)
+	c.fireUnlockPulse(door, UnlockPulse{At: time.Now(), Actor: c.client.GetUserName(), Source: UnlockSourceGateway})
+	return nil
+}
+
+// UnlockForDuration unlocks a door for the given number of seconds instead of
+// the door's configured unlock duration. UGT doors are unlocked through their
+// location, like with UnlockDoor. When the controller firmware doesn't support
+// a custom duration, the door is unlocked with the default duration.
+func (c *Controller) UnlockForDuration(door *Door, seconds int) error {
+	if seconds <= 0 {
+		return c.UnlockDoor(door)
+	}
+	if err := c.allowUnlock(door); err != nil {
+		return err
+	}
+
+	ctx := c.operationContext()
+	id := requestIDFromContext(ctx)
+	logger.Info("Unlocking door", "door", door.Name, "seconds", seconds, "req_id", id)
+	if c.dryRun {
+		logger.Info("Dry run: not sending timed unlock", "door", door.Name, "device", door.ID, "seconds", seconds, "req_id", id)
+		return nil
+	}
+	var err error
+	if door.Device.DeviceType == DeviceTypeUGT && door.LocationID != "" {
+		err = c.api.unlockLocationForDuration(ctx, door.LocationID, seconds)
+	} else {
+		err = c.api.unlockForDuration(ctx, door.ID, seconds)
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.IsUnsupported() {
+		logger.Warn("Timed unlock not supported by controller, unlocking with the default duration", "door", door.Name, "req_id", id, "err", err)
+		return c.unlockDoor(ctx, door)
+	}
+	if err != nil {
+		return err
+	}
+	c.countUnlock(door)
+	c.fireUnlockPulse(door, UnlockPulse{At: time.Now(), Actor: c.client.GetUserName(), Source: UnlockSourceGateway})
+	return nil
+}
+
+// LockDoor locks a door immediately instead of waiting for the unlock timeout.
+// UGT doors are locked through their location, like with UnlockDoor. Returns
+// ErrLockUnsupported when the controller firmware lacks the endpoint.
+func (c *Controller) LockDoor(door *Door) error {
+	ctx := c.operationContext()
+	id := requestIDFromContext(ctx)
+	logger.Info("Locking door", "door", door.Name, "req_id", id)
+	if c.dryRun {
+		logger.Info("Dry run: not sending lock", "door", door.Name, "device", door.ID, "req_id", id)
+		return nil
+	}
+	var err error
+	if door.Device.DeviceType == DeviceTypeUGT && door.LocationID != "" {
+		err = c.api.lockLocation(ctx, door.LocationID)
+	} else {
+		err = c.api.lock(ctx, door.ID)
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.IsUnsupported() {
+		return fmt.Errorf("%w: %v", ErrLockUnsupported, err)
+	}
+	return err
+}
+
+// RebootDevice restarts a device, e.g. a stuck reader. The device is offline
+// until it has booted again.
+func (c *Controller) RebootDevice(deviceID string) error {
+	if deviceID == "" {
+		return fmt.Errorf("no device to reboot")
+	}
+	if c.dryRun {
+		logger.Info("Dry run: not sending reboot", "device", deviceID)
+		return nil
+	}
+	return c.api.Reboot(deviceID)
 }
 
 // TriggerDoorbellRing triggers a doorbell ring via the remote_call API
 // This uses the DoorbellRequestBody format that the reader uses when someone presses the button
 func (c *Controller) TriggerDoorbellRing(door *Door) error {
+	return c.remoteCall(door, "in", nil)
+}
+
+// InitiateCall starts an outbound call from the reader of a door to viewers,
+// e.g. from the intercom of a UA-Ultra. Without viewerIDs the viewers that a
+// doorbell ring of the door would notify are called.
+func (c *Controller) InitiateCall(door *Door, viewerIDs []string) error {
+	return c.remoteCall(door, "out", viewerIDs)
+}
+
+// remoteCall sends a remote_call from the reader of a door, "in" for a
+// doorbell ring and "out" for an outbound call. viewerIDs overrides the
+// viewers of the door when not empty.
+func (c *Controller) remoteCall(door *Door, inOrOut string, viewerIDs []string) error {
 	var deviceID string
-	var viewerIDs []string
+	var doorViewers []string
 
 	c.mu.RLock()
 	// Use configured values if available, otherwise fall back to auto-detected
 	if c.doorbellConfig != nil && c.doorbellConfig.resolvedReader != "" {
 		deviceID = c.doorbellConfig.resolvedReader
-		viewerIDs = c.doorbellConfig.resolvedViewers
+		doorViewers = c.doorbellConfig.resolvedViewers
 	} else {
 		// Fall back to auto-detected values
 		deviceID = door.ReaderDeviceID
@@ -156,22 +450,50 @@ func (c *Controller) TriggerDoorbellRing(door *Door) error {
 			deviceID = door.ID
 			logger.Warn("No reader device configured for door, using hub ID", "door", door.Name, "device", deviceID)
 		}
-		viewerIDs = door.ViewerIDs
+		doorViewers = door.ViewerIDs
 	}
+	fanOut := c.doorbellFanOut
 	c.mu.RUnlock()
+	if len(viewerIDs) == 0 {
+		viewerIDs = doorViewers
+	}
 
-	logger.Debug("Triggering doorbell ring", "door", door.Name, "device", deviceID, "viewers", viewerIDs)
+	ctx := c.operationContext()
+	id := requestIDFromContext(ctx)
+	logger.Debug("Triggering remote call", "door", door.Name, "direction", inOrOut, "device", deviceID, "viewers", viewerIDs, "req_id", id)
 
 	req := DoorbellRingRequest{
 		DeviceID:   deviceID,
 		DeviceName: door.Name,
 		DoorName:   door.Name,
-		FloorName:  "", // Could be extracted from topology if needed
-		InOrOut:    "in",
+		FloorName:  door.FloorName,
+		InOrOut:    inOrOut,
 		ViewerIDs:  viewerIDs,
+		RequestID:  generateRandomString(32),
+		FanOut:     fanOut,
+	}
+
+	if c.dryRun {
+		logger.Info("Dry run: not sending remote call", "door", door.Name, "direction", inOrOut, "device", deviceID, "viewers", viewerIDs, "req_id", id)
+		return nil
 	}
 
-	return c.client.TriggerDoorbellRing(req)
+	// Remember the request before sending it; the echo may arrive before the
+	// HTTP response does
+	c.rememberSelfTriggered(req.RequestID)
+
+	if err := c.api.triggerDoorbellRing(ctx, req); err != nil {
+		logger.Debug("Remote call failed", "door", door.Name, "direction", inOrOut, "req_id", id, "err", err)
+		return err
+	}
+	logger.Debug("Remote call sent", "door", door.Name, "direction", inOrOut, "call", req.RequestID, "req_id", id)
+	return nil
+}
+
+// operationContext returns a request context with a new request ID, so the
+// log lines of one door operation and its API calls can be correlated
+func (c *Controller) operationContext() context.Context {
+	return withRequestID(c.client.context(), newRequestID())
 }
 
 // DismissDoorbellCall dismisses an active doorbell call
@@ -190,18 +512,18 @@ func (c *Controller) DismissDoorbellCall(door *Door) error {
 	if c.OnDoorbellDismiss != nil {
 		c.OnDoorbellDismiss(door)
 	}
-	err := c.client.DismissDoorbellCall(deviceID, door.DoorbellRequestID, c.client.GetUserID(), c.client.GetUserName())
-	if err != nil {
-		return err
+	if c.dryRun {
+		logger.Info("Dry run: not sending doorbell dismiss", "door", door.Name, "device", deviceID)
+	} else {
+		err := c.api.DismissDoorbellCall(deviceID, door.DoorbellRequestID, c.client.GetUserID(), c.client.GetUserName())
+		if err != nil {
+			return err
+		}
 	}
 
 	// Clear doorbell state after successful dismiss
 	c.mu.Lock()
-	door.DoorbellRinging = false
-	door.DoorbellRequestID = ""
-	door.DoorbellDeviceID = ""
-	door.DoorbellRoomID = ""
-	door.DoorbellChannel = ""
+	c.clearDoorbellCall(door, RingEndDismiss)
 	c.mu.Unlock()
 
 	// Trigger callback to publish updated state
@@ -212,14 +534,81 @@ func (c *Controller) DismissDoorbellCall(door *Door) error {
 	return nil
 }
 
+// AnswerDoorbellCall accepts an active doorbell call. The call then is no
+// longer ringing; a client joins it with the Agora channel from the ring.
+func (c *Controller) AnswerDoorbellCall(door *Door) error {
+	if door.DoorbellRequestID == "" {
+		return fmt.Errorf("no active doorbell call for door %s", door.Name)
+	}
+
+	deviceID := door.DoorbellDeviceID
+	if deviceID == "" {
+		deviceID = door.ID
+	}
+
+	logger.Info("Answering doorbell call", "door", door.Name, "request", door.DoorbellRequestID, "device", deviceID)
+	if c.dryRun {
+		logger.Info("Dry run: not sending doorbell answer", "door", door.Name, "device", deviceID)
+	} else {
+		err := c.api.AnswerDoorbellCall(deviceID, door.DoorbellRequestID, c.client.GetUserID(), c.client.GetUserName())
+		if err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.clearDoorbellCall(door, RingEndAnswer)
+	c.mu.Unlock()
+
+	if c.OnDoorbellCancel != nil {
+		c.OnDoorbellCancel(door)
+	}
+
+	return nil
+}
+
+// clearDoorbellCall resets the active call of a door and stops its ring
+// timeout. The call is kept as LastRing, ended by endedBy. Must be called with
+// c.mu held.
+func (c *Controller) clearDoorbellCall(door *Door, endedBy string) {
+	c.recordLastRing(door, endedBy, time.Now())
+	c.stopRingTimer(door)
+	door.DoorbellRinging = false
+	door.DoorbellRequestID = ""
+	door.DoorbellDeviceID = ""
+	door.DoorbellRoomID = ""
+	door.DoorbellChannel = ""
+	door.AgoraChannel = ""
+	door.AgoraToken = ""
+	door.SelfTriggeredRing = false
+	door.RingStartedAt = time.Time{}
+}
+
 // bootstrap retrieves initial device configuration
 func (c *Controller) bootstrap() error {
-	bootstrap, err := c.client.Bootstrap()
+	bootstrap, err := c.api.Bootstrap()
 	if err != nil {
 		return err
 	}
 
+	if err := c.applyBootstrap(bootstrap); err != nil {
+		return err
+	}
+	c.saveBootstrapCache(bootstrap)
+	return nil
+}
+
+// applyBootstrap rebuilds the doors, readers and viewers from bootstrap data,
+// fetched from the controller or loaded from the bootstrap cache
+func (c *Controller) applyBootstrap(bootstrap *BootstrapResponse) error {
 	logger.Info("UniFi Access Controller", "name", bootstrap.Host.Name, "version", bootstrap.Version)
+	c.mu.Lock()
+	c.host = bootstrap.Host
+	c.version = bootstrap.Version
+	if c.host.FirmwareVersion == "" {
+		c.host.FirmwareVersion = bootstrap.Version
+	}
+	c.mu.Unlock()
 	logger.Info("Bootstrap found", "devices", len(bootstrap.Devices), "doors", len(bootstrap.Doors), "viewers", len(bootstrap.Viewers))
 
 	// Debug: log all devices
@@ -228,7 +617,6 @@ func (c *Controller) bootstrap() error {
 	}
 
 	c.mu.Lock()
-	defer c.mu.Unlock()
 
 	// Clear existing doors
 	c.doors = make(map[string]*Door)
@@ -269,8 +657,13 @@ func (c *Controller) bootstrap() error {
 	// Find reader/doorbell devices for each door (UA-G3, UA-G3-Pro, etc.)
 	// These are the devices that have the camera and doorbell button
 	doorReaders := make(map[string]string)
-	for _, device := range bootstrap.Devices {
+	readerDevicesByID := make(map[string]*DeviceConfig)
+	c.readerDevices = nil
+	for i, device := range bootstrap.Devices {
 		if device.IsReader() {
+			c.readerDevices = append(c.readerDevices, device)
+			readerDevicesByID[device.GetID()] = &bootstrap.Devices[i]
+			logCapabilities(&device)
 			readerID := device.GetID()
 			if readerID != "" {
 				// Track this reader ID so we can ignore device update events for it
@@ -284,6 +677,7 @@ func (c *Controller) bootstrap() error {
 	}
 
 	// Process devices
+	filtered := 0
 	for i := range bootstrap.Devices {
 		device := &bootstrap.Devices[i]
 
@@ -311,21 +705,36 @@ func (c *Controller) bootstrap() error {
 
 		// Get initial lock state from device config
 		door.LockStatus = c.getLockStatusFromDevice(device)
+		door.UnlockDurationSeconds = unlockDurationFromDevice(device)
+		c.updateDeviceCycleCount(door)
 
 		// Associate Viewers with this door
 		// Include both door-specific viewers and building-level viewers
 		door.ViewerIDs = append([]string{}, allViewerIDs...) // Copy building-level viewers
 		if device.Door != nil {
+			door.LocationID = device.Door.UniqueID
 			door.ViewerIDs = append(door.ViewerIDs, doorViewers[device.Door.UniqueID]...)
 			// Set the reader/doorbell device ID (UA-G3, UA-G3-Pro, etc.)
 			// This is the device with the camera that should be used for doorbell triggers
 			if readerID, ok := doorReaders[device.Door.UniqueID]; ok {
 				door.ReaderDeviceID = readerID
+				if reader := readerDevicesByID[readerID]; reader != nil {
+					c.applyDeviceStats(door, deviceStatsFromConfig(reader))
+				}
 			}
 		}
 
-		c.doors[door.ID] = door
-		c.doorsByName[NormalizeDoorName(door.Name)] = door
+		// A viewer can be listed at both levels; notify it only once
+		door.ViewerIDs = dedupeStrings(door.ViewerIDs)
+		door.Capabilities = doorCapabilities(device, readerDevicesByID[door.ReaderDeviceID])
+
+		if !c.doorFilter.allows(door) {
+			c.doorFilter.logFiltered(door)
+			filtered++
+			continue
+		}
+
+		c.addDoor(door)
 
 		logger.Info("Door",
 			"name", door.Name,
@@ -341,9 +750,80 @@ func (c *Controller) bootstrap() error {
 		c.resolveDoorbellConfig(bootstrap)
 	}
 
+	// Counted under the lock: event handlers and removeDoor change c.doors
+	doorCount := len(c.doors)
+	c.mu.Unlock()
+
+	if filtered > 0 {
+		logger.Info("Doors filtered out by includeDoors/excludeDoors", "count", filtered)
+	}
+
+	if doorCount == 0 {
+		logger.Warn("No doors found on the controller; check that hubs are adopted and assigned to doors, and that the user may see them",
+			"devices", len(bootstrap.Devices))
+		return ErrNoDoors
+	}
+
 	return nil
 }
 
+// dedupeStrings returns values without duplicates, keeping the first
+// occurrence of each in order
+func dedupeStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	return result
+}
+
+// addDoor adds a door to the maps. When its ID or name is already taken by a
+// door in another building, both key and topic name are qualified with the
+// building so neither door overwrites the other. Must be called with c.mu held.
+func (c *Controller) addDoor(door *Door) {
+	existingByID := c.doors[door.Key]
+	existingByName := c.doorsByName[NormalizeDoorName(door.TopicName())]
+	if existingByID != nil || existingByName != nil {
+		door.Qualified = true
+		if existingByID != nil {
+			door.Key = qualifyDoorKey(door)
+		}
+		existing := existingByID
+		if existing == nil {
+			existing = existingByName
+		}
+		logger.Warn("Door collides with an existing door, qualifying with building",
+			"door", door.Name,
+			"id", door.ID,
+			"building", door.BuildingName,
+			"existing", existing.Name,
+			"key", door.Key,
+			"topic", SanitizeName(door.TopicName()))
+	}
+
+	c.doors[door.Key] = door
+	c.doorsByName[NormalizeDoorName(door.TopicName())] = door
+
+	// Doors that are already open count from discovery
+	if door.DoorStatus == "open" {
+		c.trackHeldOpen(door)
+	}
+}
+
+// qualifyDoorKey returns the building-qualified map key of a door
+func qualifyDoorKey(door *Door) string {
+	building := door.BuildingName
+	if door.Device != nil && door.Device.Door != nil && door.Device.Door.BuildingID != "" {
+		building = door.Device.Door.BuildingID
+	}
+	return building + "/" + door.ID
+}
+
 // resolveDoorbellConfig resolves MAC addresses or device IDs to actual device IDs
 func (c *Controller) resolveDoorbellConfig(bootstrap *BootstrapResponse) {
 	// Build lookup maps: MAC -> device ID, device ID -> device ID
@@ -351,10 +831,10 @@ func (c *Controller) resolveDoorbellConfig(bootstrap *BootstrapResponse) {
 	for _, device := range bootstrap.Devices {
 		id := device.GetID()
 		if id != "" {
-			deviceMap[id] = id                               // device ID -> device ID
-			deviceMap[strings.ToLower(device.MAC)] = id      // MAC (lowercase) -> device ID
-			deviceMap[strings.ToUpper(device.MAC)] = id      // MAC (uppercase) -> device ID
-			deviceMap[NormalizeMAC(device.MAC)] = id         // Normalized MAC -> device ID
+			deviceMap[id] = id                          // device ID -> device ID
+			deviceMap[strings.ToLower(device.MAC)] = id // MAC (lowercase) -> device ID
+			deviceMap[strings.ToUpper(device.MAC)] = id // MAC (uppercase) -> device ID
+			deviceMap[NormalizeMAC(device.MAC)] = id    // Normalized MAC -> device ID
 		}
 	}
 	for _, viewer := range bootstrap.Viewers {
@@ -424,6 +904,33 @@ func (c *Controller) getLockStatusFromDevice(device *DeviceConfig) string {
 	return "unlocked"
 }
 
+// unlockDurationKeys are the config keys holding how long the lock relay
+// stays released after an unlock, in seconds. Names vary by device type and
+// firmware version.
+var unlockDurationKeys = []string{
+	"door_unlock_duration",
+	"lock_relay_hold_time",
+	"unlock_duration",
+	"relay_hold_time",
+	"output_d1_lock_relay_hold_time",
+	"output_oper1_relay_hold_time",
+}
+
+// unlockDurationFromDevice returns the auto-relock duration of a door in
+// seconds, or 0 when the device doesn't report it
+func unlockDurationFromDevice(device *DeviceConfig) int {
+	for _, key := range unlockDurationKeys {
+		value := device.GetConfigValue(key)
+		if value == "" {
+			continue
+		}
+		if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && seconds > 0 {
+			return seconds
+		}
+	}
+	return 0
+}
+
 // setupEventHandlers sets up handlers for real-time events
 func (c *Controller) setupEventHandlers() {
 	// Doorbell ring event
@@ -451,22 +958,45 @@ func (c *Controller) setupEventHandlers() {
 		c.handleRemoteUnlock(event)
 	})
 
+	// Device delete event (a hub removed in the UniFi console)
+	c.eventListener.On(EventDeviceDelete, func(event EventPacket) {
+		c.handleDeviceDelete(event)
+	})
+
 	// Location update v2 event
 	c.eventListener.On(EventLocationUpdateV2, func(event EventPacket) {
 		c.handleLocationUpdate(event)
 	})
 
+	// Access log event (who unlocked a door and how)
+	c.eventListener.On(EventAccessLog, func(event EventPacket) {
+		c.handleAccessLog(event)
+	})
+
+	// Failed access attempts
+	c.eventListener.On(EventAccessDenied, func(event EventPacket) {
+		c.handleAccessDenied(event)
+	})
+
+	// Tamper alarms of hubs and readers
+	c.eventListener.On(EventDeviceTamper, func(event EventPacket) {
+		c.handleTamper(event)
+	})
+
 	// Bootstrap event (full refresh)
 	c.eventListener.On(EventBootstrap, func(event EventPacket) {
 		logger.Info("Received bootstrap event, refreshing device state")
-		if err := c.bootstrap(); err != nil {
+		if err := c.Refresh(); err != nil {
 			logger.Error("Failed to refresh bootstrap", "err", err)
 		}
 	})
 
-	// Log all events in trace mode
+	// Log all events in trace mode and forward them to the OnAnyEvent hook
 	c.eventListener.On("*", func(event EventPacket) {
 		logger.Trace("Event", "event", event.Event, "object", event.EventObjectID)
+		if c.OnAnyEvent != nil {
+			c.OnAnyEvent(event)
+		}
 	})
 }
 
@@ -477,19 +1007,34 @@ func (c *Controller) handleDoorbellRing(event EventPacket) {
 		return
 	}
 
+	selfTriggered := c.isSelfTriggered(data.RequestID)
+
 	c.mu.Lock()
-	door := c.doors[data.ConnectedUAHID]
+	door := c.doorByDevice(data.ConnectedUAHID)
 	if door != nil {
 		door.DoorbellRinging = true
 		door.DoorbellRequestID = data.RequestID
 		door.DoorbellDeviceID = data.DeviceID
 		door.DoorbellRoomID = data.RoomID
 		door.DoorbellChannel = data.DoorbellChannel
+		door.AgoraChannel = data.AgoraChannel
+		door.AgoraToken = data.AgoraToken
+		door.SelfTriggeredRing = selfTriggered
+		door.RingStartedAt = event.Timestamp
+		if door.RingStartedAt.IsZero() {
+			door.RingStartedAt = time.Now()
+		}
+		c.startRingTimer(door)
 	}
+	suppress := selfTriggered && c.suppressSelfTriggered
 	c.mu.Unlock()
 
 	if door != nil {
-		logger.Info("Doorbell ring", "door", door.Name, "request_id", data.RequestID, "device", data.DeviceID)
+		logger.Info("Doorbell ring", "door", door.Name, "request_id", data.RequestID, "device", data.DeviceID, "self_triggered", selfTriggered)
+		if suppress {
+			logger.Debug("Suppressing self-triggered doorbell ring", "door", door.Name)
+			return
+		}
 		if c.OnDoorbellRing != nil {
 			c.OnDoorbellRing(door)
 		}
@@ -507,11 +1052,7 @@ func (c *Controller) handleDoorbellCancel(event EventPacket) {
 	var matchedDoor *Door
 	for _, door := range c.doors {
 		if door.DoorbellRequestID == data.RemoteCallRequestID {
-			door.DoorbellRinging = false
-			door.DoorbellRequestID = ""
-			door.DoorbellDeviceID = ""
-			door.DoorbellRoomID = ""
-			door.DoorbellChannel = ""
+			c.clearDoorbellCall(door, RingEndCancel)
 			matchedDoor = door
 			break
 		}
@@ -533,13 +1074,18 @@ func (c *Controller) handleDeviceUpdate(event EventPacket) {
 	}
 
 	c.mu.Lock()
-	door := c.doors[event.EventObjectID]
+	door := c.doorByDevice(event.EventObjectID)
+	isReader := c.readers[event.EventObjectID]
 	if door == nil {
 		c.mu.Unlock()
+		if isReader {
+			c.handleReaderUpdate(event.EventObjectID, event)
+		}
 		return
 	}
 
 	// Update device config from event data
+	onlineChanged := false
 	if event.Data != nil {
 		if configs, ok := event.Data["configs"].([]interface{}); ok {
 			for _, cfg := range configs {
@@ -564,23 +1110,44 @@ func (c *Controller) handleDeviceUpdate(event EventPacket) {
 			}
 		}
 
+		if duration := unlockDurationFromDevice(door.Device); duration > 0 {
+			door.UnlockDurationSeconds = duration
+		}
+
 		// Update lock status
 		newLockStatus := c.getLockStatusFromDevice(door.Device)
 		if newLockStatus != door.LockStatus {
-			door.LockStatus = newLockStatus
+			c.setLockStatus(door, newLockStatus, event.Timestamp)
 			logger.Info("Door lock status changed", "door", door.Name, "status", door.LockStatus)
 		}
 
 		// Update online status
 		if isOnline, ok := event.Data["is_online"].(bool); ok {
-			door.IsOnline = isOnline
+			onlineChanged = c.setOnline(door, isOnline)
+		}
+
+		// Firmware changes after an upgrade
+		if firmware, ok := event.Data["firmware"].(string); ok && firmware != "" {
+			door.Device.Firmware = firmware
+		}
+		door.Firmware = door.Device.FirmwareVersion()
+
+		// Battery and signal belong to the reader; a hub's own values
+		// would overwrite them
+		if door.ReaderDeviceID == event.EventObjectID {
+			c.applyDeviceStats(door, parseDeviceStats(event.Data))
 		}
 	}
+	cycleCountChanged := c.updateDeviceCycleCount(door)
 	c.mu.Unlock()
 
 	if c.OnDoorUpdate != nil {
 		c.OnDoorUpdate(door)
 	}
+	c.fireOnlineChange(door, onlineChanged)
+	if cycleCountChanged {
+		c.fireCycleCount(door)
+	}
 }
 
 // handleDeviceUpdateV2 handles v2 device update events
@@ -603,19 +1170,25 @@ func (c *Controller) handleDeviceUpdateV2(event EventPacket) {
 	logger.Debug("handleDeviceUpdateV2: location_states count", "count", len(states))
 
 	c.mu.Lock()
-	door := c.doors[deviceID]
+	door := c.doorByDevice(deviceID)
 	c.mu.Unlock()
 
 	if door == nil {
 		// Viewer / reader updates are expected for non-hub devices - skip silently
 		c.mu.RLock()
-		isKnownNonDoor := c.viewers[deviceID] || c.readers[deviceID]
+		isViewer := c.viewers[deviceID]
+		isReader := c.readers[deviceID]
+		knownDoors := len(c.doors)
 		c.mu.RUnlock()
-		if isKnownNonDoor {
+		if isReader {
+			c.handleReaderUpdate(deviceID, event)
+			return
+		}
+		if isViewer {
 			return
 		}
 
-		logger.Debug("handleDeviceUpdateV2: door not found", "device_id", deviceID, "known_doors", len(c.doors))
+		logger.Debug("handleDeviceUpdateV2: door not found", "device_id", deviceID, "known_doors", knownDoors)
 		// Fall back to regular device update handling
 		c.handleDeviceUpdate(event)
 		return
@@ -624,18 +1197,25 @@ func (c *Controller) handleDeviceUpdateV2(event EventPacket) {
 	logger.Debug("handleDeviceUpdateV2: found door", "door", door.Name)
 
 	if len(states) > 0 {
+		var entry *EntryEvent
+		onlineChanged := false
 		c.mu.Lock()
+		if isOnline, ok := event.Data["is_online"].(bool); ok {
+			onlineChanged = c.setOnline(door, isOnline)
+		}
 		for _, state := range states {
 			logger.Debug("handleDeviceUpdateV2: state", "lock", state.Lock, "dps", state.DPS)
 			if state.Lock == "unlocked" {
-				door.LockStatus = "unlocked"
+				c.setLockStatus(door, "unlocked", event.Timestamp)
 			} else if state.Lock == "locked" {
-				door.LockStatus = "locked"
+				c.setLockStatus(door, "locked", event.Timestamp)
 			}
 			if state.DPS == "open" {
-				door.DoorStatus = "open"
+				if e := c.setDoorStatus(door, "open", event.Timestamp); e != nil {
+					entry = e
+				}
 			} else if state.DPS == "close" {
-				door.DoorStatus = "closed"
+				c.setDoorStatus(door, "closed", event.Timestamp)
 			}
 		}
 		c.mu.Unlock()
@@ -644,6 +1224,8 @@ func (c *Controller) handleDeviceUpdateV2(event EventPacket) {
 		if c.OnDoorUpdate != nil {
 			c.OnDoorUpdate(door)
 		}
+		c.fireOnlineChange(door, onlineChanged)
+		c.fireDoorEntry(door, entry)
 		return
 	}
 
@@ -658,9 +1240,9 @@ func (c *Controller) handleRemoteUnlock(event EventPacket) {
 	}
 
 	c.mu.Lock()
-	door := c.doors[event.EventObjectID]
+	door := c.doorByDevice(event.EventObjectID)
 	if door != nil {
-		door.LockStatus = "unlocked"
+		c.setLockStatus(door, "unlocked", event.Timestamp)
 	}
 	c.mu.Unlock()
 
@@ -669,6 +1251,7 @@ func (c *Controller) handleRemoteUnlock(event EventPacket) {
 		if c.OnDoorUpdate != nil {
 			c.OnDoorUpdate(door)
 		}
+		c.fireUnlockPulse(door, UnlockPulse{At: event.Timestamp, Actor: remoteUnlockActor(event), Source: UnlockSourceRemote})
 	}
 }
 
@@ -697,16 +1280,17 @@ func (c *Controller) handleLocationUpdate(event EventPacket) {
 		}
 	}
 
+	var entry *EntryEvent
 	if matchedDoor != nil {
 		if lockStatus == "unlock" {
-			matchedDoor.LockStatus = "unlocked"
+			c.setLockStatus(matchedDoor, "unlocked", event.Timestamp)
 		} else if lockStatus == "lock" {
-			matchedDoor.LockStatus = "locked"
+			c.setLockStatus(matchedDoor, "locked", event.Timestamp)
 		}
 		if doorStatus == "open" {
-			matchedDoor.DoorStatus = "open"
+			entry = c.setDoorStatus(matchedDoor, "open", event.Timestamp)
 		} else if doorStatus == "close" {
-			matchedDoor.DoorStatus = "closed"
+			c.setDoorStatus(matchedDoor, "closed", event.Timestamp)
 		}
 	}
 	c.mu.Unlock()
@@ -714,6 +1298,65 @@ func (c *Controller) handleLocationUpdate(event EventPacket) {
 	if matchedDoor != nil && c.OnDoorUpdate != nil {
 		c.OnDoorUpdate(matchedDoor)
 	}
+	if matchedDoor != nil {
+		c.fireDoorEntry(matchedDoor, entry)
+		// Location updates also announce lock rule changes
+		if c.OnScheduleChange != nil {
+			go c.refreshLockRule(matchedDoor)
+		}
+	}
+}
+
+// SetAPIToken authenticates with an API token instead of username/password
+func (c *Controller) SetAPIToken(token string) {
+	c.client.SetAPIToken(token)
+}
+
+// SetUserAgent replaces the User-Agent of the API requests and the WebSocket;
+// empty keeps DefaultUserAgent
+func (c *Controller) SetUserAgent(userAgent string) {
+	c.client.SetUserAgent(userAgent)
+}
+
+// SetHeaders adds headers to the API requests and the WebSocket handshake
+func (c *Controller) SetHeaders(headers map[string]string) {
+	c.client.SetHeaders(headers)
+}
+
+// SetCAFile verifies the controller certificate against the CA certificates
+// in a PEM file. Must be called before Connect.
+func (c *Controller) SetCAFile(path string) error {
+	return c.client.SetCAFile(path)
+}
+
+// SetSite selects the UniFi OS site of the Access app ("" = default site).
+// Must be called before Connect.
+func (c *Controller) SetSite(site string) {
+	c.client.SetSite(site)
+}
+
+// SetEventTimestampSource selects the source of event timestamps:
+// TimestampSourceEvent (default) or TimestampSourceReceived
+func (c *Controller) SetEventTimestampSource(source string) {
+	c.eventListener.SetTimestampSource(source)
+}
+
+// SetEventReconnect sets whether the event WebSocket reconnects when it drops
+// (the default). Without reconnecting, EventsLost is closed instead.
+func (c *Controller) SetEventReconnect(enabled bool) {
+	c.eventListener.SetReconnect(enabled)
+}
+
+// EventsLost returns a channel that is closed when the event WebSocket
+// dropped and reconnecting is disabled
+func (c *Controller) EventsLost() <-chan struct{} {
+	return c.eventListener.Lost()
+}
+
+// SetEventFilter limits the WebSocket events the controller handles to the
+// given types; empty handles all events
+func (c *Controller) SetEventFilter(types []string) {
+	c.eventListener.SetEventFilter(types)
 }
 
 // SetDoorbellConfig sets the doorbell configuration from config file
@@ -728,6 +1371,15 @@ func (c *Controller) SetDoorbellConfig(sourceReader string, targetViewers []stri
 	logger.Info("Doorbell config set", "sourceReader", sourceReader, "targetViewers", targetViewers)
 }
 
+// SetDoorbellFanOut makes doorbell rings send one remote_call per viewer
+// instead of one for all of them. A ring then succeeds as long as one viewer
+// was notified.
+func (c *Controller) SetDoorbellFanOut(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.doorbellFanOut = enabled
+}
+
 // SanitizeName sanitizes a door name for use in MQTT topics
 func SanitizeName(name string) string {
 	// Replace spaces and special characters
@@ -0,0 +1,569 @@
+package unifi
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAccessServer records the method and path of every request
+type fakeAccessServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+}
+
+func newFakeAccessServer(t *testing.T) *fakeAccessServer {
+	f := &fakeAccessServer{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests = append(f.requests, r.Method+" "+r.URL.EscapedPath())
+		f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"SUCCESS"}`))
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeAccessServer) lastRequest() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.requests) == 0 {
+		return ""
+	}
+	return f.requests[len(f.requests)-1]
+}
+
+func (f *fakeAccessServer) requestCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.requests)
+}
+
+func TestLockRuleMonitorStopsOnDisconnect(t *testing.T) {
+	server := newFakeAccessServer(t)
+	c := NewControllerWithCredentials(server.URL, nil, false)
+	c.client.SetAPIToken("token")
+
+	c.StartLockRuleMonitor(5 * time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	if server.requestCount() == 0 {
+		t.Fatal("monitor sent no requests")
+	}
+	c.Disconnect()
+	time.Sleep(20 * time.Millisecond) // a refresh in flight finishes
+	sent := server.requestCount()
+	time.Sleep(30 * time.Millisecond)
+	if n := server.requestCount(); n != sent {
+		t.Errorf("monitor sent %d requests after Disconnect", n-sent)
+	}
+}
+
+func TestUnlockDoorEndpointByDeviceType(t *testing.T) {
+	tests := []struct {
+		deviceType string
+		locationID string
+		want       string
+	}{
+		{DeviceTypeUAH, "location-1", "PUT /proxy/access/api/v2/device/hub-1/unlock"},
+		{DeviceTypeUAHubMini, "location-1", "PUT /proxy/access/api/v2/device/hub-1/unlock"},
+		{DeviceTypeUGT, "location-1", "PUT /proxy/access/api/v2/location/location-1/unlock"},
+		// Without a location the device endpoint is the only option
+		{DeviceTypeUGT, "", "PUT /proxy/access/api/v2/device/hub-1/unlock"},
+	}
+
+	for _, tt := range tests {
+		server := newFakeAccessServer(t)
+		c := NewControllerWithCredentials(server.URL, nil, false)
+		door := &Door{
+			ID:         "hub-1",
+			Key:        "hub-1",
+			Name:       "Front Door",
+			LocationID: tt.locationID,
+			Device:     &DeviceConfig{UniqueID: "hub-1", DeviceType: tt.deviceType},
+		}
+
+		if err := c.UnlockDoor(door); err != nil {
+			t.Fatalf("%s: UnlockDoor: %v", tt.deviceType, err)
+		}
+		if got := server.lastRequest(); got != tt.want {
+			t.Errorf("%s (location %q): request = %q, want %q", tt.deviceType, tt.locationID, got, tt.want)
+		}
+	}
+}
+
+func TestDisconnectClosesIdleConnections(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":"SUCCESS"}`))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+
+	c := NewControllerWithCredentials(server.URL, nil, false)
+	if err := c.api.Ping(); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	c.Disconnect()
+
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("keep-alive connection still open after Disconnect")
+	}
+	if err := c.api.Ping(); err == nil {
+		t.Error("request after Disconnect succeeded, want it cancelled")
+	}
+}
+
+func TestDedupeStrings(t *testing.T) {
+	building := []string{"viewer-hall", "viewer-office"}
+	door := []string{"viewer-front", "viewer-hall"}
+
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{"empty", nil, []string{}},
+		{"no duplicates", []string{"a", "b"}, []string{"a", "b"}},
+		{"keeps first occurrence", []string{"b", "a", "b", "a"}, []string{"b", "a"}},
+		{"building and door level", append(append([]string{}, building...), door...),
+			[]string{"viewer-hall", "viewer-office", "viewer-front"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dedupeStrings(tt.values); !slices.Equal(got, tt.want) {
+				t.Fatalf("dedupeStrings(%v) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessMethodNormalization(t *testing.T) {
+	tests := []struct {
+		provider   string
+		method     string
+		capability string
+	}{
+		{"HAND_WAVE", AccessMethodWave, CapabilityHandWave},
+		{"Hand Wave", AccessMethodWave, CapabilityHandWave},
+		{"FACE", AccessMethodFace, CapabilityFaceUnlock},
+		{"Face Unlock", AccessMethodFace, CapabilityFaceUnlock},
+		{"NFC", AccessMethodNFC, CapabilityNFC},
+		{"PIN_CODE", AccessMethodPin, CapabilityPinCode},
+		{"MOBILE_TAP", AccessMethodMobile, CapabilityMobileUnlock},
+		{"QR_CODE", AccessMethodQR, CapabilityQRCode},
+		{"REMOTE_THROUGH_UAH", AccessMethodRemote, ""},
+		{"LICENSE_PLATE", "license_plate", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			method := accessMethod(tt.provider)
+			if method != tt.method {
+				t.Fatalf("accessMethod(%q) = %q, want %q", tt.provider, method, tt.method)
+			}
+			if got := AccessMethodCapability(method); got != tt.capability {
+				t.Fatalf("AccessMethodCapability(%q) = %q, want %q", method, got, tt.capability)
+			}
+		})
+	}
+}
+
+func TestForcedOpenDetection(t *testing.T) {
+	tests := []struct {
+		name        string
+		steps       []string // "lock", "unlock", "open", "close"
+		wantPending bool
+	}{
+		{"open while locked", []string{"lock", "open"}, true},
+		{"unlock then open", []string{"lock", "unlock", "open"}, false},
+		{"unlock arriving after open", []string{"lock", "open", "unlock"}, false},
+		{"relocked while open after unlock", []string{"lock", "unlock", "open", "lock"}, false},
+		{"closed before grace", []string{"lock", "open", "close"}, false},
+		{"reopened after entry", []string{"lock", "unlock", "open", "lock", "close", "open"}, true},
+		{"unknown lock state", []string{"open"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewControllerWithCredentials("https://127.0.0.1", nil, false)
+			door := &Door{ID: "hub-1", Key: "hub-1", Name: "Front Door", DoorStatus: "closed", Device: &DeviceConfig{}}
+			c.doors[door.Key] = door
+
+			now := time.Now()
+			c.mu.Lock()
+			for i, step := range tt.steps {
+				at := now.Add(time.Duration(i) * time.Second)
+				switch step {
+				case "lock":
+					c.setLockStatus(door, "locked", at)
+				case "unlock":
+					c.setLockStatus(door, "unlocked", at)
+				case "open":
+					c.setDoorStatus(door, "open", at)
+				case "close":
+					c.setDoorStatus(door, "closed", at)
+				}
+			}
+			pending := c.stopForcedOpenTimer(door)
+			c.mu.Unlock()
+
+			if pending != tt.wantPending {
+				t.Errorf("forced-open check pending = %v, want %v", pending, tt.wantPending)
+			}
+		})
+	}
+}
+
+func TestDeviceDeleteRemovesDoor(t *testing.T) {
+	c := NewControllerWithCredentials("https://127.0.0.1", nil, false)
+	c.mu.Lock()
+	c.addDoor(&Door{ID: "hub-1", Key: "hub-1", Name: "Front Door", DoorStatus: "open", Device: &DeviceConfig{}})
+	c.addDoor(&Door{ID: "hub-2", Key: "hub-2", Name: "Back Door", Device: &DeviceConfig{}})
+	c.mu.Unlock()
+
+	var removed []string
+	c.OnDoorRemoved = func(door *Door) {
+		removed = append(removed, door.Name)
+	}
+	c.handleDeviceDelete(EventPacket{Event: EventDeviceDelete, EventObjectID: "hub-1"})
+
+	if len(removed) != 1 || removed[0] != "Front Door" {
+		t.Fatalf("removed = %v, want [Front Door]", removed)
+	}
+	if c.GetDoor("hub-1") != nil || c.GetDoorByName("Front Door") != nil {
+		t.Error("deleted door is still known")
+	}
+	if c.heldOpenTimers["hub-1"] != nil {
+		t.Error("held-open timer of the deleted door is still running")
+	}
+	if c.GetDoor("hub-2") == nil {
+		t.Error("other door was removed")
+	}
+}
+
+func TestQualifiedDoorFoundByDeviceID(t *testing.T) {
+	c := NewControllerWithCredentials("https://127.0.0.1", nil, false)
+	north := &Door{ID: "hub-1", Key: "hub-1", Name: "North Door", BuildingName: "North", LockStatus: "locked",
+		Device: &DeviceConfig{UniqueID: "hub-1", DeviceType: DeviceTypeUAH}}
+	south := &Door{ID: "hub-1", Key: "hub-1", Name: "South Door", BuildingName: "South", LockStatus: "locked",
+		Device: &DeviceConfig{UniqueID: "hub-1", DeviceType: DeviceTypeUAH}}
+	c.mu.Lock()
+	c.addDoor(north)
+	c.addDoor(south)
+	c.removeDoor(north)
+	c.mu.Unlock()
+	if south.Key != "South/hub-1" {
+		t.Fatalf("key of the colliding door = %q, want South/hub-1", south.Key)
+	}
+
+	if got := c.GetDoor("hub-1"); got != south {
+		t.Fatalf("GetDoor by ID = %v, want the qualified door", got)
+	}
+	c.handleDeviceUpdate(EventPacket{
+		Event:         EventDeviceUpdate,
+		EventObjectID: "hub-1",
+		Data: map[string]interface{}{
+			"configs": []interface{}{map[string]interface{}{"key": "input_state_rly-lock_dry", "value": "on"}},
+		},
+	})
+	if south.LockStatus != "unlocked" {
+		t.Errorf("lock status after device update = %q, want unlocked", south.LockStatus)
+	}
+}
+
+func TestRingTimeoutClearsCall(t *testing.T) {
+	c := NewControllerWithCredentials("https://127.0.0.1", nil, false)
+	c.SetRingTimeout(20 * time.Millisecond)
+	c.mu.Lock()
+	c.addDoor(&Door{ID: "hub-1", Key: "hub-1", Name: "Front Door", Device: &DeviceConfig{}})
+	c.mu.Unlock()
+
+	cancelled := make(chan *Door, 1)
+	c.OnDoorbellCancel = func(door *Door) {
+		cancelled <- door
+	}
+	c.handleDoorbellRing(EventPacket{
+		Event: EventDoorbellRing,
+		Data:  map[string]interface{}{"request_id": "call-1", "connected_uah_id": "hub-1"},
+	})
+
+	select {
+	case door := <-cancelled:
+		c.mu.RLock()
+		ringing := door.DoorbellRinging
+		last := door.LastRing
+		c.mu.RUnlock()
+		if ringing {
+			t.Error("door is still ringing after the timeout")
+		}
+		if last == nil || last.EndedBy != RingEndTimeout {
+			t.Errorf("last ring = %+v, want one ended by the timeout", last)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnDoorbellCancel did not fire after the ring timeout")
+	}
+}
+
+func TestDoorbellCancelStopsRingTimeout(t *testing.T) {
+	c := NewControllerWithCredentials("https://127.0.0.1", nil, false)
+	c.mu.Lock()
+	c.addDoor(&Door{ID: "hub-1", Key: "hub-1", Name: "Front Door", Device: &DeviceConfig{}})
+	c.mu.Unlock()
+
+	c.handleDoorbellRing(EventPacket{
+		Event: EventDoorbellRing,
+		Data:  map[string]interface{}{"request_id": "call-1", "connected_uah_id": "hub-1"},
+	})
+	if c.ringTimers["hub-1"] == nil {
+		t.Fatal("ring timeout not started")
+	}
+	c.handleDoorbellCancel(EventPacket{
+		Event: EventDoorbellCancel,
+		Data:  map[string]interface{}{"remote_call_request_id": "call-1"},
+	})
+	if c.ringTimers["hub-1"] != nil {
+		t.Error("ring timeout still running after the cancel")
+	}
+}
+
+func TestLastRingRecordedWhenCallEnds(t *testing.T) {
+	c := NewControllerWithCredentials("https://127.0.0.1", nil, false)
+	door := &Door{ID: "hub-1", Key: "hub-1", Name: "Front Door", Device: &DeviceConfig{}}
+	c.mu.Lock()
+	c.addDoor(door)
+	c.mu.Unlock()
+
+	started := time.Date(2026, 5, 11, 14, 32, 0, 0, time.UTC)
+	c.handleDoorbellRing(EventPacket{
+		Event:     EventDoorbellRing,
+		Timestamp: started,
+		Data: map[string]interface{}{
+			"request_id":       "call-1",
+			"connected_uah_id": "hub-1",
+			"device_id":        "reader-1",
+			"room_id":          "room-1",
+		},
+	})
+	if door.LastRing != nil {
+		t.Fatalf("last ring recorded while the call is still ringing: %+v", door.LastRing)
+	}
+
+	c.handleDoorbellCancel(EventPacket{
+		Event: EventDoorbellCancel,
+		Data:  map[string]interface{}{"remote_call_request_id": "call-1"},
+	})
+	last := door.LastRing
+	if last == nil {
+		t.Fatal("no last ring after the cancel")
+	}
+	if last.RequestID != "call-1" || last.DeviceID != "reader-1" || last.RoomID != "room-1" || !last.StartedAt.Equal(started) {
+		t.Errorf("last ring = %+v, want the cancelled call", last)
+	}
+	if last.EndedBy != RingEndCancel || last.EndedAt.IsZero() {
+		t.Errorf("last ring ended by %q at %v, want a cancel", last.EndedBy, last.EndedAt)
+	}
+	if door.DoorbellDeviceID != "" || door.DoorbellRoomID != "" {
+		t.Error("call state not cleared")
+	}
+}
+
+func TestGetDoorsSorted(t *testing.T) {
+	c := NewControllerWithCredentials("https://127.0.0.1", nil, false)
+	c.mu.Lock()
+	for _, door := range []*Door{
+		{ID: "hub-3", Key: "hub-3", Name: "Garage"},
+		{ID: "hub-1", Key: "hub-1", Name: "Front Door"},
+		{ID: "hub-4", Key: "hub-4", Name: "Back Door"},
+		{ID: "hub-2", Key: "hub-2", Name: "Front Door"},
+	} {
+		door.Device = &DeviceConfig{}
+		c.doors[door.Key] = door
+	}
+	c.mu.Unlock()
+
+	want := []string{"hub-4", "hub-1", "hub-2", "hub-3"}
+	for i := range 20 {
+		var got []string
+		for _, door := range c.GetDoors() {
+			got = append(got, door.Key)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("call %d: GetDoors() = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestDoorbellFanOutToleratesOfflineViewer(t *testing.T) {
+	var mu sync.Mutex
+	var notified [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Viewers []string `json:"notify_door_guards"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		notified = append(notified, body.Viewers)
+		mu.Unlock()
+		if len(body.Viewers) == 1 && strings.HasPrefix(body.Viewers[0], "viewer-offline") {
+			http.Error(w, `{"code":"DEVICE_OFFLINE"}`, http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"code":"SUCCESS"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	c := NewControllerWithCredentials(server.URL, nil, false)
+	c.SetDoorbellFanOut(true)
+	door := &Door{ID: "hub-1", Key: "hub-1", Name: "Front Door", ReaderDeviceID: "reader-1",
+		ViewerIDs: []string{"viewer-hall", "viewer-offline"}, Device: &DeviceConfig{}}
+
+	if err := c.TriggerDoorbellRing(door); err != nil {
+		t.Fatalf("TriggerDoorbellRing with one viewer online: %v", err)
+	}
+	if len(notified) != 2 || len(notified[0]) != 1 || len(notified[1]) != 1 {
+		t.Fatalf("remote_calls = %v, want one per viewer", notified)
+	}
+
+	door.ViewerIDs = []string{"viewer-offline-1", "viewer-offline-2"}
+	err := c.TriggerDoorbellRing(door)
+	var ringErr *ViewerRingError
+	if !errors.As(err, &ringErr) {
+		t.Fatalf("TriggerDoorbellRing with all viewers offline = %v, want a ViewerRingError", err)
+	}
+	if len(ringErr.Notified) != 0 || len(ringErr.Failed) != 2 {
+		t.Errorf("ViewerRingError = %+v, want both viewers failed", ringErr)
+	}
+}
+
+func TestApplySchedulesActiveWindow(t *testing.T) {
+	c := NewControllerWithCredentials("https://127.0.0.1", nil, false)
+	door := &Door{ID: "hub-1", Key: "hub-1", Name: "Front Door",
+		Device: &DeviceConfig{Door: &DoorReference{UniqueID: "location-1"}}}
+	schedules := []DoorSchedule{
+		{Name: "Other door", Weekly: map[string][]ScheduleWindow{"monday": {{"00:00:00", "23:59:59"}}},
+			Resources: []ScheduleResource{{ID: "location-2", Type: "door"}}},
+		{Name: "Business hours", Weekly: map[string][]ScheduleWindow{"monday": {{"08:00:00", "17:00:00"}}},
+			Resources: []ScheduleResource{{ID: "location-1", Type: "door"}}},
+	}
+	monday := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+
+	c.applySchedules(door, schedules, monday.Add(9*time.Hour))
+	if door.ScheduleName != "Business hours" || !door.ScheduledUnlocked {
+		t.Errorf("inside the window: schedule = %q, scheduled_unlocked = %v", door.ScheduleName, door.ScheduledUnlocked)
+	}
+	if want := monday.Add(17 * time.Hour); !door.ScheduleEndsAt.Equal(want) {
+		t.Errorf("ScheduleEndsAt = %v, want %v", door.ScheduleEndsAt, want)
+	}
+
+	c.applySchedules(door, schedules, monday.Add(18*time.Hour))
+	if door.ScheduleName != "" || door.ScheduledUnlocked {
+		t.Errorf("after the window: schedule = %q, scheduled_unlocked = %v", door.ScheduleName, door.ScheduledUnlocked)
+	}
+
+	// A reported lock rule stays authoritative for scheduled_unlocked
+	door.LockRule = LockRuleKeepLock
+	c.applySchedules(door, schedules, monday.Add(9*time.Hour))
+	if door.ScheduleName != "Business hours" || door.ScheduledUnlocked {
+		t.Errorf("with a lock rule: schedule = %q, scheduled_unlocked = %v", door.ScheduleName, door.ScheduledUnlocked)
+	}
+}
+
+func TestScheduleWindowAcrossMidnight(t *testing.T) {
+	schedule := DoorSchedule{Name: "Night shift",
+		Weekly: map[string][]ScheduleWindow{"monday": {{"22:00:00", "06:00:00"}}}}
+	monday := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+	tuesday := monday.AddDate(0, 0, 1)
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		active bool
+		until  time.Time
+	}{
+		{"monday before the window", monday.Add(21 * time.Hour), false, time.Time{}},
+		{"monday late evening", monday.Add(23 * time.Hour), true, tuesday.Add(6 * time.Hour)},
+		{"tuesday early morning", tuesday.Add(2 * time.Hour), true, tuesday.Add(6 * time.Hour)},
+		{"tuesday after the window", tuesday.Add(7 * time.Hour), false, time.Time{}},
+		{"monday early morning", monday.Add(2 * time.Hour), false, time.Time{}},
+	}
+	for _, tt := range tests {
+		until, active := schedule.activeUntil(tt.now)
+		if active != tt.active || !until.Equal(tt.until) {
+			t.Errorf("%s: activeUntil = %v, %v, want %v, %v", tt.name, until, active, tt.until, tt.active)
+		}
+	}
+}
+
+func TestScheduleWindowInControllerTimeZone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	schedules := []DoorSchedule{{Name: "Business hours",
+		Weekly:    map[string][]ScheduleWindow{"monday": {{"09:00:00", "17:00:00"}}},
+		Resources: []ScheduleResource{{ID: "location-1", Type: "door"}}}}
+	door := &Door{ID: "hub-1", Key: "hub-1", Name: "Front Door",
+		Device: &DeviceConfig{UniqueID: "hub-1", Door: &DoorReference{UniqueID: "location-1"}}}
+	// 07:30 UTC is 09:30 in Berlin (CEST, UTC+2)
+	now := time.Date(2024, 5, 6, 7, 30, 0, 0, time.UTC)
+
+	c := NewControllerWithCredentials("https://127.0.0.1:1", nil, false)
+	c.applySchedules(door, schedules, c.scheduleTime(now))
+	if door.ScheduleName != "" {
+		t.Errorf("in UTC: schedule = %q, want none before 09:00", door.ScheduleName)
+	}
+
+	c.SetTimeZone(berlin)
+	c.applySchedules(door, schedules, c.scheduleTime(now))
+	if door.ScheduleName != "Business hours" || !door.ScheduledUnlocked {
+		t.Errorf("in Berlin: schedule = %q, unlocked %v; want Business hours", door.ScheduleName, door.ScheduledUnlocked)
+	}
+	if want := time.Date(2024, 5, 6, 15, 0, 0, 0, time.UTC); !door.ScheduleEndsAt.Equal(want) {
+		t.Errorf("in Berlin: schedule ends at %v, want %v", door.ScheduleEndsAt, want)
+	}
+}
+
+func TestUnlockPulseSkipsEchoOfGatewayUnlock(t *testing.T) {
+	server := newFakeAccessServer(t)
+	c := NewControllerWithCredentials(server.URL, nil, false)
+	door := &Door{ID: "hub-1", Key: "hub-1", Name: "Front Door", Device: &DeviceConfig{UniqueID: "hub-1"}}
+	c.addDoor(door)
+
+	var pulses []UnlockPulse
+	c.OnDoorUnlockPulse = func(_ *Door, pulse UnlockPulse) { pulses = append(pulses, pulse) }
+
+	if err := c.UnlockDoor(door); err != nil {
+		t.Fatalf("UnlockDoor: %v", err)
+	}
+	// The controller echoes the gateway's unlock as a remote unlock event
+	c.handleRemoteUnlock(EventPacket{Event: EventDeviceRemoteUnlock, EventObjectID: "hub-1", Timestamp: time.Now()})
+	if len(pulses) != 1 || pulses[0].Source != UnlockSourceGateway {
+		t.Fatalf("pulses after gateway unlock = %+v, want one from the gateway", pulses)
+	}
+
+	// A remote unlock outside the echo window is a pulse of its own
+	c.mu.Lock()
+	c.gatewayUnlocks[door.Key] = time.Now().Add(-unlockEchoWindow)
+	c.mu.Unlock()
+	c.handleRemoteUnlock(EventPacket{Event: EventDeviceRemoteUnlock, EventObjectID: "hub-1", Timestamp: time.Now(),
+		Data: map[string]interface{}{"actor": map[string]interface{}{"display_name": "Alice"}}})
+	if len(pulses) != 2 || pulses[1].Source != UnlockSourceRemote || pulses[1].Actor != "Alice" {
+		t.Fatalf("pulses after remote unlock = %+v, want a remote one by Alice", pulses)
+	}
+}
@@ -0,0 +1,66 @@
+package unifi
+
+import (
+	"strconv"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// Cycle count sources
+const (
+	CycleCountSourceDevice   = "device"   // reported by the hub
+	CycleCountSourceInternal = "internal" // unlocks issued by this gateway since it started
+)
+
+// Config keys under which hubs may report a relay actuation counter. Not all
+// firmware versions expose one.
+var relayCycleCountKeys = []string{"relay_cycle_count", "lock_relay_count", "relay_count", "unlock_count"}
+
+// relayCycleCount reads the relay actuation counter from the device config
+func relayCycleCount(device *DeviceConfig) (int64, bool) {
+	for _, key := range relayCycleCountKeys {
+		value := device.GetConfigValue(key)
+		if value == "" {
+			continue
+		}
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil && n >= 0 {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// updateDeviceCycleCount refreshes the cycle count from the device config.
+// Returns true when the count changed. Must be called with c.mu held.
+func (c *Controller) updateDeviceCycleCount(door *Door) bool {
+	n, ok := relayCycleCount(door.Device)
+	if !ok || (door.CycleCountSource == CycleCountSourceDevice && n == door.CycleCount) {
+		return false
+	}
+	door.CycleCount = n
+	door.CycleCountSource = CycleCountSourceDevice
+	return true
+}
+
+// countUnlock increments the internal cycle count after an unlock issued by
+// the gateway, unless the hub reports its own counter
+func (c *Controller) countUnlock(door *Door) {
+	c.mu.Lock()
+	if door.CycleCountSource == CycleCountSourceDevice {
+		c.mu.Unlock()
+		return
+	}
+	door.CycleCount++
+	door.CycleCountSource = CycleCountSourceInternal
+	c.mu.Unlock()
+
+	logger.Debug("Door cycle count", "door", door.Name, "count", door.CycleCount)
+	c.fireCycleCount(door)
+}
+
+// fireCycleCount invokes the OnCycleCount callback
+func (c *Controller) fireCycleCount(door *Door) {
+	if c.OnCycleCount != nil {
+		c.OnCycleCount(door)
+	}
+}
@@ -0,0 +1,117 @@
+package unifi
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Keys under which devices report battery level and signal strength, either
+// directly in the update or as config entries
+var (
+	batteryKeys = []string{"battery", "battery_level", "battery_percentage"}
+	signalKeys  = []string{"rssi", "signal", "signal_strength", "wifi_rssi"}
+)
+
+// deviceStats holds the optional stats of a device. Nil means not reported.
+type deviceStats struct {
+	Battery *int
+	Signal  *int
+}
+
+// parseDeviceStats reads battery and signal from the data of a device update
+func parseDeviceStats(data map[string]interface{}) deviceStats {
+	var stats deviceStats
+	if data == nil {
+		return stats
+	}
+
+	values := make(map[string]interface{})
+	if configs, ok := data["configs"].([]interface{}); ok {
+		for _, cfg := range configs {
+			if cfgMap, ok := cfg.(map[string]interface{}); ok {
+				if key, ok := cfgMap["key"].(string); ok {
+					values[strings.ToLower(key)] = cfgMap["value"]
+				}
+			}
+		}
+	}
+	// Top-level values take precedence over config entries
+	for key, value := range data {
+		values[strings.ToLower(key)] = value
+	}
+
+	stats.Battery = firstInt(values, batteryKeys)
+	stats.Signal = firstInt(values, signalKeys)
+	return stats
+}
+
+// deviceStatsFromConfig reads battery and signal from a device's config entries
+func deviceStatsFromConfig(device *DeviceConfig) deviceStats {
+	values := make(map[string]interface{}, len(device.Configs))
+	for _, cfg := range device.Configs {
+		values[strings.ToLower(cfg.Key)] = cfg.Value
+	}
+	return deviceStats{
+		Battery: firstInt(values, batteryKeys),
+		Signal:  firstInt(values, signalKeys),
+	}
+}
+
+// firstInt returns the first value among keys that is a number or numeric string
+func firstInt(values map[string]interface{}, keys []string) *int {
+	for _, key := range keys {
+		switch v := values[key].(type) {
+		case float64:
+			n := int(math.Round(v))
+			return &n
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(v, "%")), 64); err == nil {
+				n := int(math.Round(f))
+				return &n
+			}
+		}
+	}
+	return nil
+}
+
+// applyDeviceStats stores reported stats on a door. Returns true when a value
+// changed. Must be called with c.mu held.
+func (c *Controller) applyDeviceStats(door *Door, stats deviceStats) bool {
+	changed := false
+	if stats.Battery != nil && (!door.HasBattery || door.BatteryLevel != *stats.Battery) {
+		door.BatteryLevel = *stats.Battery
+		door.HasBattery = true
+		changed = true
+	}
+	if stats.Signal != nil && (!door.HasSignal || door.SignalStrength != *stats.Signal) {
+		door.SignalStrength = *stats.Signal
+		door.HasSignal = true
+		changed = true
+	}
+	return changed
+}
+
+// handleReaderUpdate applies battery/signal stats of a reader update to the
+// door the reader belongs to
+func (c *Controller) handleReaderUpdate(readerID string, event EventPacket) {
+	stats := parseDeviceStats(event.Data)
+	if stats.Battery == nil && stats.Signal == nil {
+		return
+	}
+
+	c.mu.Lock()
+	var door *Door
+	for _, d := range c.doors {
+		if d.ReaderDeviceID == readerID {
+			door = d
+			break
+		}
+	}
+	changed := door != nil && c.applyDeviceStats(door, stats)
+	c.mu.Unlock()
+
+	if changed && c.OnDoorUpdate != nil {
+		c.OnDoorUpdate(door)
+	}
+}
@@ -0,0 +1,64 @@
+package unifi
+
+import (
+	"github.com/philipparndt/go-logger"
+)
+
+// doorFilter selects the doors a controller exports. Entries are door names
+// (compared with NormalizeDoorName) or door IDs.
+type doorFilter struct {
+	include map[string]bool // empty = all doors
+	exclude map[string]bool
+}
+
+// SetDoorFilter limits the doors added at bootstrap. With include set, only
+// the listed doors are added; doors in exclude are never added. Filtered doors
+// are neither published nor accept commands. Must be called before Connect.
+func (c *Controller) SetDoorFilter(include, exclude []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.doorFilter = doorFilter{
+		include: normalizedSet(include),
+		exclude: normalizedSet(exclude),
+	}
+}
+
+// allows reports whether a door passes the filter
+func (f doorFilter) allows(door *Door) bool {
+	if len(f.include) > 0 && !f.matches(f.include, door) {
+		return false
+	}
+	return !f.matches(f.exclude, door)
+}
+
+// matches reports whether a door is in set by ID, location ID, name or
+// building-qualified name
+func (f doorFilter) matches(set map[string]bool, door *Door) bool {
+	keys := []string{door.ID, door.LocationID, door.Name}
+	if door.BuildingName != "" {
+		keys = append(keys, door.BuildingName+" "+door.Name)
+	}
+	for _, key := range keys {
+		if key != "" && set[NormalizeDoorName(key)] {
+			return true
+		}
+	}
+	return false
+}
+
+// logFiltered logs a door that was left out, so the filter is transparent
+func (f doorFilter) logFiltered(door *Door) {
+	reason := "excludeDoors"
+	if len(f.include) > 0 && !f.matches(f.include, door) {
+		reason = "not in includeDoors"
+	}
+	logger.Info("Door filtered out", "name", door.Name, "id", door.ID, "reason", reason)
+}
+
+func normalizedSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[NormalizeDoorName(v)] = true
+	}
+	return set
+}
@@ -0,0 +1,54 @@
+package unifi
+
+import "github.com/philipparndt/go-logger"
+
+// handleDeviceDelete handles device delete events. The doors of a deleted hub
+// are dropped and OnDoorRemoved fires for each of them; deleted readers and
+// viewers are forgotten.
+func (c *Controller) handleDeviceDelete(event EventPacket) {
+	deviceID := event.EventObjectID
+	if event.Meta != nil && event.Meta.ID != "" {
+		deviceID = event.Meta.ID
+	}
+	if deviceID == "" {
+		return
+	}
+
+	c.mu.Lock()
+	delete(c.viewers, deviceID)
+	delete(c.readers, deviceID)
+	var removed []*Door
+	for key, door := range c.doors {
+		if key == deviceID || door.ID == deviceID || door.LocationID == deviceID {
+			removed = append(removed, door)
+		}
+	}
+	for _, door := range removed {
+		c.removeDoor(door)
+	}
+	c.mu.Unlock()
+
+	for _, door := range removed {
+		logger.Info("Door removed", "door", door.Name, "device", deviceID)
+		if c.OnDoorRemoved != nil {
+			c.OnDoorRemoved(door)
+		}
+	}
+}
+
+// removeDoor drops a door from the maps and stops its timers. Must be called
+// with c.mu held.
+func (c *Controller) removeDoor(door *Door) {
+	delete(c.doors, door.Key)
+	name := NormalizeDoorName(door.TopicName())
+	if c.doorsByName[name] == door {
+		delete(c.doorsByName, name)
+	}
+	if timer := c.heldOpenTimers[door.Key]; timer != nil {
+		timer.Stop()
+		delete(c.heldOpenTimers, door.Key)
+	}
+	c.stopForcedOpenTimer(door)
+	c.stopRingTimer(door)
+	delete(c.gatewayUnlocks, door.Key)
+}
@@ -0,0 +1,94 @@
+package unifi
+
+import (
+	"time"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// Default window after an unlock in which a door opening counts as an entry
+const defaultEntryWindow = 30 * time.Second
+
+// EntryEvent describes a door that was opened shortly after being unlocked
+type EntryEvent struct {
+	UnlockedAt time.Time
+	OpenedAt   time.Time
+}
+
+// setLockStatus updates the lock status of a door and records the time of
+// unlock transitions. at is the time of the event that caused the change.
+// Must be called with c.mu held.
+func (c *Controller) setLockStatus(door *Door, status string, at time.Time) {
+	if status == door.LockStatus {
+		return
+	}
+	door.LockStatus = status
+	door.LastChangedAt = at
+	door.ExpectedRelockAt = time.Time{}
+	if status == "unlocked" {
+		c.cancelForcedOpen(door)
+		door.LastUnlockAt = at
+		if door.UnlockDurationSeconds > 0 {
+			door.ExpectedRelockAt = at.Add(time.Duration(door.UnlockDurationSeconds) * time.Second)
+		}
+	}
+}
+
+// setOnline updates the online status of a door and reports whether it
+// changed. Must be called with c.mu held.
+func (c *Controller) setOnline(door *Door, online bool) bool {
+	if online == door.IsOnline {
+		return false
+	}
+	door.IsOnline = online
+	logger.Info("Door online status changed", "door", door.Name, "online", online)
+	return true
+}
+
+// fireOnlineChange invokes the OnDoorOnlineChange callback after a transition
+func (c *Controller) fireOnlineChange(door *Door, changed bool) {
+	if changed && c.OnDoorOnlineChange != nil {
+		c.OnDoorOnlineChange(door)
+	}
+}
+
+// setDoorStatus updates the door position of a door. When the door opens
+// within the entry window after an unlock, an EntryEvent is returned so the
+// caller can fire OnDoorEntry after releasing the lock. at is the time of the
+// event that caused the change. Must be called with c.mu held.
+func (c *Controller) setDoorStatus(door *Door, status string, at time.Time) *EntryEvent {
+	door.HasPositionSensor = true
+	if status == door.DoorStatus {
+		return nil
+	}
+	recentUnlock := !door.LastUnlockAt.IsZero() && at.Sub(door.LastUnlockAt) <= c.entryWindow
+	door.DoorStatus = status
+	door.LastChangedAt = at
+	c.trackHeldOpen(door)
+	c.checkForcedOpen(door, recentUnlock, at)
+	if status != "open" || !recentUnlock {
+		return nil
+	}
+
+	entry := &EntryEvent{UnlockedAt: door.LastUnlockAt, OpenedAt: at}
+	// Only the first opening after an unlock counts as an entry
+	door.LastUnlockAt = time.Time{}
+	logger.Info("Door opened after unlock", "door", door.Name, "after", at.Sub(entry.UnlockedAt).Round(time.Millisecond))
+	return entry
+}
+
+// fireDoorEntry invokes the OnDoorEntry callback for a detected entry
+func (c *Controller) fireDoorEntry(door *Door, entry *EntryEvent) {
+	if entry != nil && c.OnDoorEntry != nil {
+		c.OnDoorEntry(door, *entry)
+	}
+}
+
+// SetEntryWindow sets how long after an unlock a door opening counts as an entry
+func (c *Controller) SetEntryWindow(window time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if window > 0 {
+		c.entryWindow = window
+	}
+}
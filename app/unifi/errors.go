@@ -0,0 +1,130 @@
+package unifi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ErrLockUnsupported is returned by LockDoor when the controller firmware has
+// no lock endpoint
+var ErrLockUnsupported = errors.New("lock not supported by controller")
+
+// ErrCallInProgress is returned by TriggerDoorbellRing and InitiateCall when
+// the reader is already in a call
+var ErrCallInProgress = errors.New("doorbell call already in progress")
+
+// ErrNoDoors is returned by Connect when the bootstrap found no doors. The
+// controller is still connected and follows events.
+var ErrNoDoors = errors.New("controller has no doors")
+
+// ErrDeveloperAPIToken is returned by requests to the developer API without
+// an API token. The developer API doesn't accept the session of a
+// username/password login.
+var ErrDeveloperAPIToken = errors.New("developer API requires an API token")
+
+// ErrUnknownGroup is returned by GroupDoors for a group that isn't configured
+var ErrUnknownGroup = errors.New("unknown door group")
+
+// ViewerRingError is returned by a fanned-out doorbell ring when no viewer
+// could be notified
+type ViewerRingError struct {
+	Notified []string         // Viewers the ring was sent to
+	Failed   map[string]error // Viewers the ring failed for, with the error
+}
+
+func (e *ViewerRingError) Error() string {
+	viewers := slices.Sorted(maps.Keys(e.Failed))
+	failed := make([]string, 0, len(viewers))
+	for _, viewer := range viewers {
+		failed = append(failed, fmt.Sprintf("%s (%v)", viewer, e.Failed[viewer]))
+	}
+	msg := "doorbell ring failed for viewers " + strings.Join(failed, ", ")
+	if len(e.Notified) > 0 {
+		msg += "; notified " + strings.Join(e.Notified, ", ")
+	}
+	return msg
+}
+
+// Unwrap returns the per-viewer errors, so errors.Is finds e.g. ErrCallInProgress
+func (e *ViewerRingError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, err := range e.Failed {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// APIError is returned when the controller answers a request with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// IsAuth reports whether the controller rejected the session or credentials
+func (e *APIError) IsAuth() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// IsAuthError reports whether err (or any error it wraps) is an authentication failure
+func IsAuthError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.IsAuth()
+}
+
+// IsUnsupported reports whether the controller doesn't know the endpoint
+func (e *APIError) IsUnsupported() bool {
+	return e.StatusCode == http.StatusNotFound ||
+		e.StatusCode == http.StatusMethodNotAllowed ||
+		e.StatusCode == http.StatusNotImplemented
+}
+
+// responseEnvelope is the common wrapper of Access API responses, e.g.
+// {"code": "SUCCESS", "msg": "success", "data": ...}. Older endpoints use
+// codeS for the string code and a numeric code.
+type responseEnvelope struct {
+	Code  any    `json:"code"`
+	CodeS string `json:"codeS"`
+	Msg   string `json:"msg"`
+}
+
+// parseEnvelope decodes the response envelope; a body that isn't one yields
+// an empty envelope
+func parseEnvelope(body []byte) responseEnvelope {
+	var env responseEnvelope
+	_ = json.Unmarshal(body, &env)
+	return env
+}
+
+// code returns the string code of the envelope
+func (e responseEnvelope) code() string {
+	if e.CodeS != "" {
+		return e.CodeS
+	}
+	if s, ok := e.Code.(string); ok {
+		return s
+	}
+	return ""
+}
+
+// callInProgressCodes are the envelope codes of the "already in a call" error
+// of remote_call. Other errors, e.g. an offline or unknown device, must not be
+// reported as a ring in progress.
+var callInProgressCodes = map[string]bool{
+	"CODE_DEVICE_IN_CALL":          true,
+	"CODE_DEVICE_DEVICE_IN_CALL":   true,
+	"CODE_REMOTE_CALL_IN_PROGRESS": true,
+}
+
+// isCallInProgress detects the "already in a call" error of remote_call
+func isCallInProgress(e responseEnvelope) bool {
+	return callInProgressCodes[strings.ToUpper(e.code())]
+}
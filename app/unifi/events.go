@@ -1,9 +1,10 @@
 package unifi
 
 import (
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
 	"net/http"
 	"strings"
 	"sync"
@@ -24,15 +25,59 @@ type EventListener struct {
 	mu           sync.RWMutex
 	stopChan     chan struct{}
 	reconnecting bool
+
+	connected   bool // WebSocket is connected
+	connectedMu sync.Mutex
+
+	timestampSource string          // TimestampSourceEvent or TimestampSourceReceived
+	eventFilter     map[string]bool // Event types to handle, nil for all
+
+	queues []chan EventPacket // one per dispatch worker, see dispatchEvent
+
+	// Reconnect backoff: the delay starts at ReconnectBaseInterval and doubles
+	// with each failed attempt up to ReconnectMaxInterval
+	ReconnectBaseInterval time.Duration
+	ReconnectMaxInterval  time.Duration
+	reconnectAttempt      int
+	connectedAt           time.Time
+
+	noReconnect bool          // Close lost instead of reconnecting when the connection drops
+	lost        chan struct{} // Closed when the connection dropped for good
+	lostOnce    sync.Once
 }
 
+// Reconnect backoff defaults
+const (
+	defaultReconnectBaseInterval = 5 * time.Second
+	defaultReconnectMaxInterval  = 5 * time.Minute
+	stableConnectionDuration     = 60 * time.Second // connection lifetime after which the backoff resets
+	reconnectJitter              = 0.2              // +/- fraction of the delay
+)
+
+// Event dispatch workers. Events of one object always go to the same worker,
+// so they are handled in the order they were received.
+const (
+	eventWorkers     = 8
+	eventQueueLength = 256 // per worker; the WebSocket reader waits while a queue is full
+)
+
 // NewEventListener creates a new event listener
 func NewEventListener(client *Client) *EventListener {
-	return &EventListener{
+	e := &EventListener{
 		client:   client,
 		handlers: make(map[string][]EventHandler),
 		stopChan: make(chan struct{}),
+		lost:     make(chan struct{}),
+
+		ReconnectBaseInterval: defaultReconnectBaseInterval,
+		ReconnectMaxInterval:  defaultReconnectMaxInterval,
+	}
+	e.queues = make([]chan EventPacket, eventWorkers)
+	for i := range e.queues {
+		e.queues[i] = make(chan EventPacket, eventQueueLength)
+		go e.dispatchWorker(e.queues[i])
 	}
+	return e
 }
 
 // On registers an event handler for a specific event type
@@ -43,6 +88,56 @@ func (e *EventListener) On(eventType string, handler EventHandler) {
 	e.handlers[eventType] = append(e.handlers[eventType], handler)
 }
 
+// SetTimestampSource selects whether events carry their embedded time or the
+// time they were received
+func (e *EventListener) SetTimestampSource(source string) {
+	e.timestampSource = source
+}
+
+// lifecycleEvents pass any event filter: without them the controller would
+// miss topology changes and keep removed devices
+var lifecycleEvents = []string{EventBootstrap, EventDeviceDelete}
+
+// knownEvents are the event types the controller has handlers for
+var knownEvents = map[string]bool{
+	EventDeviceRemoteUnlock: true, EventDeviceUpdate: true, EventDeviceUpdateV2: true,
+	EventLocationUpdateV2: true, EventDoorbellRing: true, EventDoorbellCancel: true,
+	EventDeviceDelete: true, EventAccessLog: true, EventAccessDenied: true,
+	EventDeviceTamper: true, EventBootstrap: true,
+}
+
+// SetEventFilter limits the handled events to the given types and the
+// lifecycle events. Other events are dropped right after parsing. Empty
+// handles all events.
+func (e *EventListener) SetEventFilter(types []string) {
+	if len(types) == 0 {
+		e.eventFilter = nil
+		return
+	}
+	e.eventFilter = make(map[string]bool, len(types)+len(lifecycleEvents))
+	for _, t := range types {
+		if !knownEvents[t] {
+			logger.Warn("Event filter lists an event type without a handler; it is only forwarded by publishEvents", "event", t)
+		}
+		e.eventFilter[t] = true
+	}
+	for _, t := range lifecycleEvents {
+		e.eventFilter[t] = true
+	}
+}
+
+// SetReconnect sets whether a dropped connection is reconnected (the
+// default). Without reconnecting, Lost is closed instead.
+func (e *EventListener) SetReconnect(enabled bool) {
+	e.noReconnect = !enabled
+}
+
+// Lost returns a channel that is closed when the connection dropped and
+// reconnecting is disabled. It is not closed by Stop.
+func (e *EventListener) Lost() <-chan struct{} {
+	return e.lost
+}
+
 // Start begins listening for events
 func (e *EventListener) Start() error {
 	return e.connect()
@@ -51,19 +146,32 @@ func (e *EventListener) Start() error {
 // Stop stops the event listener
 func (e *EventListener) Stop() {
 	close(e.stopChan)
+	e.setConnected(false)
 	if e.conn != nil {
 		e.conn.Close()
 	}
 }
 
+// IsConnected reports whether the WebSocket is currently connected
+func (e *EventListener) IsConnected() bool {
+	e.connectedMu.Lock()
+	defer e.connectedMu.Unlock()
+	return e.connected
+}
+
+// setConnected records the WebSocket connection state
+func (e *EventListener) setConnected(connected bool) {
+	e.connectedMu.Lock()
+	defer e.connectedMu.Unlock()
+	e.connected = connected
+}
+
 // connect establishes the WebSocket connection
 func (e *EventListener) connect() error {
 	wsURL := e.client.GetWebSocketURL()
 
 	dialer := websocket.Dialer{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: !e.client.verifySSL,
-		},
+		TLSClientConfig:  e.client.TLSConfig(),
 		HandshakeTimeout: 30 * time.Second,
 	}
 
@@ -78,25 +186,33 @@ func (e *EventListener) connect() error {
 	}
 
 	headers := http.Header{}
+	e.client.applyHeaders(headers)
 	if cookieHeader != "" {
 		headers.Set("Cookie", cookieHeader)
 	}
+	authorization := e.client.authorizationHeader()
+	if authorization != "" {
+		headers.Set("Authorization", authorization)
+	}
 
 	logger.Debug("Connecting to WebSocket", "url", wsURL)
 	logger.Trace("WebSocket cookies", "header", cookieHeader)
-	if cookieHeader == "" {
+	if cookieHeader == "" && authorization == "" {
 		logger.Warn("No cookies found for WebSocket connection - events may not work")
 	}
 
-	conn, resp, err := dialer.Dial(wsURL, headers)
+	conn, resp, err := dialer.DialContext(e.client.context(), wsURL, headers)
 	if err != nil {
 		if resp != nil {
 			logger.Error("WebSocket connection failed", "status", resp.StatusCode)
+			return fmt.Errorf("websocket handshake failed: %w", &APIError{StatusCode: resp.StatusCode})
 		}
 		return err
 	}
 
 	e.conn = conn
+	e.connectedAt = time.Now()
+	e.setConnected(true)
 	logger.Info("Connected to UniFi Access WebSocket for real-time events")
 
 	go e.readLoop()
@@ -108,9 +224,14 @@ func (e *EventListener) connect() error {
 // readLoop reads messages from the WebSocket
 func (e *EventListener) readLoop() {
 	defer func() {
+		e.setConnected(false)
 		if e.conn != nil {
 			e.conn.Close()
 		}
+		if e.noReconnect {
+			e.connectionTerminated()
+			return
+		}
 		e.scheduleReconnect()
 	}()
 
@@ -190,42 +311,83 @@ func (e *EventListener) handleMessage(message []byte) {
 		return
 	}
 
+	e.Inject(event)
+}
+
+// Inject handles an event as if it had been received on the WebSocket, e.g.
+// a synthetic event of a test. Its handlers run on the dispatch workers.
+func (e *EventListener) Inject(event EventPacket) {
+	if e.eventFilter != nil && !e.eventFilter[event.Event] {
+		logger.Trace("Dropping filtered event", "event", event.Event)
+		return
+	}
+
 	logger.Debug("Received event", "event", event.Event, "object", event.EventObjectID)
-	event.Timestamp = time.Now()
+	event.ReceivedAt = time.Now()
+	if t, ok := eventTimestamp(event); ok && e.timestampSource != TimestampSourceReceived {
+		event.Timestamp = t
+	} else {
+		event.Timestamp = event.ReceivedAt
+	}
 
 	e.dispatchEvent(event)
 }
 
-// dispatchEvent dispatches an event to registered handlers
+// dispatchEvent queues an event for the worker of its object. Events of
+// different objects are handled in parallel, events of the same object in
+// order.
 func (e *EventListener) dispatchEvent(event EventPacket) {
-	e.mu.RLock()
-	defer e.mu.RUnlock()
+	h := fnv.New32a()
+	h.Write([]byte(dispatchKey(event)))
+	queue := e.queues[h.Sum32()%uint32(len(e.queues))]
 
-	// Call handlers for specific event type
-	if handlers, ok := e.handlers[event.Event]; ok {
-		for _, handler := range handlers {
-			go handler(event)
-		}
+	select {
+	case queue <- event:
+	case <-e.stopChan:
 	}
+}
 
-	// Call handlers registered for all events (wildcard)
-	if handlers, ok := e.handlers["*"]; ok {
-		for _, handler := range handlers {
-			go handler(event)
-		}
+// dispatchKey returns the object an event refers to: its object ID, the ID
+// of its meta data, or the event type when it names no object
+func dispatchKey(event EventPacket) string {
+	if event.EventObjectID != "" {
+		return event.EventObjectID
+	}
+	if event.Meta != nil && event.Meta.ID != "" {
+		return event.Meta.ID
 	}
+	return event.Event
+}
 
-	// Also dispatch by event object ID for device-specific handlers
-	if event.EventObjectID != "" {
-		key := event.Event + "." + event.EventObjectID
-		if handlers, ok := e.handlers[key]; ok {
-			for _, handler := range handlers {
-				go handler(event)
+// dispatchWorker handles the events of one queue until the listener is stopped
+func (e *EventListener) dispatchWorker(queue chan EventPacket) {
+	for {
+		select {
+		case <-e.stopChan:
+			return
+		case event := <-queue:
+			for _, handler := range e.handlersFor(event) {
+				handler(event)
 			}
 		}
 	}
 }
 
+// handlersFor returns the handlers of an event: those of its type, the
+// wildcard handlers and the device-specific handlers of its object ID
+func (e *EventListener) handlersFor(event EventPacket) []EventHandler {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var handlers []EventHandler
+	handlers = append(handlers, e.handlers[event.Event]...)
+	handlers = append(handlers, e.handlers["*"]...)
+	if event.EventObjectID != "" {
+		handlers = append(handlers, e.handlers[event.Event+"."+event.EventObjectID]...)
+	}
+	return handlers
+}
+
 // scheduleReconnect schedules a reconnection attempt
 func (e *EventListener) scheduleReconnect() {
 	select {
@@ -238,24 +400,22 @@ func (e *EventListener) scheduleReconnect() {
 		return
 	}
 	e.reconnecting = true
+	e.connectionLost(time.Now())
 
 	go func() {
 		defer func() { e.reconnecting = false }()
 
 		for {
+			delay := withJitter(e.nextReconnectDelay())
+			logger.Debug("Scheduling WebSocket reconnect", "in", delay.Round(time.Millisecond))
+
 			select {
 			case <-e.stopChan:
 				return
-			case <-time.After(5 * time.Second):
+			case <-time.After(delay):
 				logger.Info("Attempting to reconnect WebSocket...")
 
-				// Re-login before reconnecting
-				if err := e.client.Login(); err != nil {
-					logger.Error("Failed to re-login", "err", err)
-					continue
-				}
-
-				if err := e.connect(); err != nil {
+				if err := e.reconnect(); err != nil {
 					logger.Error("Failed to reconnect WebSocket", "err", err)
 					continue
 				}
@@ -266,6 +426,62 @@ func (e *EventListener) scheduleReconnect() {
 	}()
 }
 
+// connectionTerminated closes lost for a dropped connection that isn't
+// reconnected, unless the listener was stopped
+func (e *EventListener) connectionTerminated() {
+	select {
+	case <-e.stopChan:
+		return
+	default:
+	}
+	logger.Error("WebSocket disconnected, not reconnecting (eventReconnect is off)")
+	e.lostOnce.Do(func() { close(e.lost) })
+}
+
+// reconnect connects the WebSocket with the current session and logs in
+// again only when the controller rejects it, so a short network blip doesn't
+// cost a login
+func (e *EventListener) reconnect() error {
+	err := e.connect()
+	if err == nil || !IsAuthError(err) {
+		return err
+	}
+
+	logger.Info("WebSocket session rejected, logging in again", "err", err)
+	if err := e.client.Login(); err != nil {
+		return fmt.Errorf("failed to re-login: %w", err)
+	}
+	return e.connect()
+}
+
+// connectionLost resets the backoff when the lost connection had been stable
+func (e *EventListener) connectionLost(now time.Time) {
+	if !e.connectedAt.IsZero() && now.Sub(e.connectedAt) >= stableConnectionDuration {
+		e.reconnectAttempt = 0
+	}
+	e.connectedAt = time.Time{}
+}
+
+// nextReconnectDelay returns the delay before the next reconnect attempt
+// (without jitter) and advances the backoff
+func (e *EventListener) nextReconnectDelay() time.Duration {
+	delay := e.ReconnectBaseInterval
+	for i := 0; i < e.reconnectAttempt && delay < e.ReconnectMaxInterval; i++ {
+		delay *= 2
+	}
+	if delay > e.ReconnectMaxInterval {
+		delay = e.ReconnectMaxInterval
+	}
+	e.reconnectAttempt++
+	return delay
+}
+
+// withJitter spreads a delay by +/- reconnectJitter so gateways don't
+// reconnect in lockstep after a controller restart
+func withJitter(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * (1 + reconnectJitter*(2*rand.Float64()-1)))
+}
+
 // ParseDoorbellRingData extracts doorbell ring data from an event
 func ParseDoorbellRingData(event EventPacket) *DoorbellRingData {
 	if event.Data == nil {
@@ -277,10 +493,32 @@ func ParseDoorbellRingData(event EventPacket) *DoorbellRingData {
 	deviceID, _ := event.Data["device_id"].(string)
 	roomID, _ := event.Data["room_id"].(string)
 	doorbellChannel, _ := event.Data["doorbell_channel"].(string)
+	agoraChannel, _ := event.Data["agora_channel"].(string)
+	agoraToken, _ := event.Data["agora_token"].(string)
+	if agoraToken == "" {
+		agoraToken, _ = event.Data["token"].(string)
+	}
 
-	if requestID == "" {
+	// Some firmware sends the initial ring with only the call channel and room
+	if requestID == "" && agoraChannel == "" && roomID == "" {
+		logger.Debug("Ignoring doorbell event without request_id, agora_channel and room_id", "object", event.EventObjectID)
 		return nil
 	}
+	var missing []string
+	for _, field := range []struct{ name, value string }{
+		{"request_id", requestID},
+		{"agora_channel", agoraChannel},
+		{"room_id", roomID},
+		{"connected_uah_id", connectedUAHID},
+		{"device_id", deviceID},
+	} {
+		if field.value == "" {
+			missing = append(missing, field.name)
+		}
+	}
+	if len(missing) > 0 {
+		logger.Debug("Doorbell ring with missing fields", "missing", missing, "object", event.EventObjectID)
+	}
 
 	return &DoorbellRingData{
 		RequestID:       requestID,
@@ -288,6 +526,8 @@ func ParseDoorbellRingData(event EventPacket) *DoorbellRingData {
 		DeviceID:        deviceID,
 		RoomID:          roomID,
 		DoorbellChannel: doorbellChannel,
+		AgoraChannel:    agoraChannel,
+		AgoraToken:      agoraToken,
 	}
 }
 
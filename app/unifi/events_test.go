@@ -0,0 +1,307 @@
+package unifi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestReconnectDelayGrows(t *testing.T) {
+	e := NewEventListener(nil)
+	want := []time.Duration{
+		5 * time.Second,
+		10 * time.Second,
+		20 * time.Second,
+		40 * time.Second,
+		80 * time.Second,
+		160 * time.Second,
+		5 * time.Minute,
+		5 * time.Minute,
+	}
+	for i, w := range want {
+		if got := e.nextReconnectDelay(); got != w {
+			t.Fatalf("attempt %d: delay = %v, want %v", i, got, w)
+		}
+	}
+}
+
+func TestReconnectDelayResetsAfterStableConnection(t *testing.T) {
+	e := NewEventListener(nil)
+	for range 4 {
+		e.nextReconnectDelay()
+	}
+
+	// A short-lived connection keeps backing off
+	now := time.Now()
+	e.connectedAt = now.Add(-10 * time.Second)
+	e.connectionLost(now)
+	if got := e.nextReconnectDelay(); got != 80*time.Second {
+		t.Fatalf("after short connection: delay = %v, want 80s", got)
+	}
+
+	// A connection that was stable for 60s starts over
+	e.connectedAt = now.Add(-61 * time.Second)
+	e.connectionLost(now)
+	if got := e.nextReconnectDelay(); got != 5*time.Second {
+		t.Fatalf("after stable connection: delay = %v, want 5s", got)
+	}
+}
+
+func TestReconnectJitterBounds(t *testing.T) {
+	for range 1000 {
+		d := withJitter(10 * time.Second)
+		if d < 8*time.Second || d > 12*time.Second {
+			t.Fatalf("withJitter(10s) = %v, want within 8s..12s", d)
+		}
+	}
+}
+
+func TestDispatchKeepsOrderPerObject(t *testing.T) {
+	e := NewEventListener(nil)
+	defer close(e.stopChan)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	got := make(map[string][]int)
+	e.On(EventDeviceUpdate, func(event EventPacket) {
+		defer wg.Done()
+		var n int
+		fmt.Sscan(event.DataString, &n)
+		mu.Lock()
+		got[event.EventObjectID] = append(got[event.EventObjectID], n)
+		mu.Unlock()
+	})
+
+	objects := []string{"hub-1", "hub-2", "hub-3"}
+	const count = 200
+	wg.Add(count * len(objects))
+	for i := range count {
+		for _, object := range objects {
+			e.dispatchEvent(EventPacket{Event: EventDeviceUpdate, EventObjectID: object, DataString: fmt.Sprint(i)})
+		}
+	}
+	wg.Wait()
+
+	for _, object := range objects {
+		if !slices.IsSorted(got[object]) || len(got[object]) != count {
+			t.Fatalf("%s: events handled out of order or lost: %v", object, got[object])
+		}
+	}
+}
+
+func TestEventFilterDropsUnlistedTypes(t *testing.T) {
+	e := NewEventListener(nil)
+	defer close(e.stopChan)
+	e.SetEventFilter([]string{EventDeviceUpdate})
+
+	handled := make(chan string, 2)
+	e.On(EventDeviceUpdate, func(event EventPacket) { handled <- event.Event })
+	e.On(EventAccessLog, func(event EventPacket) { handled <- event.Event })
+
+	e.handleMessage([]byte(`{"event":"` + EventAccessLog + `","event_object_id":"log-1"}`))
+	e.handleMessage([]byte(`{"event":"` + EventDeviceUpdate + `","event_object_id":"hub-1"}`))
+
+	select {
+	case got := <-handled:
+		if got != EventDeviceUpdate {
+			t.Fatalf("handled %s, want only %s", got, EventDeviceUpdate)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("listed event was not handled")
+	}
+	select {
+	case got := <-handled:
+		t.Fatalf("filtered event %s was handled", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestEventFilterPassesLifecycleEvents(t *testing.T) {
+	e := NewEventListener(nil)
+	defer close(e.stopChan)
+	e.SetEventFilter([]string{EventDeviceUpdate})
+
+	handled := make(chan string, 2)
+	e.On(EventBootstrap, func(event EventPacket) { handled <- event.Event })
+	e.On(EventDeviceDelete, func(event EventPacket) { handled <- event.Event })
+
+	e.handleMessage([]byte(`{"event":"` + EventBootstrap + `"}`))
+	e.handleMessage([]byte(`{"event":"` + EventDeviceDelete + `","event_object_id":"hub-1"}`))
+
+	for range 2 {
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			t.Fatal("lifecycle event dropped by the event filter")
+		}
+	}
+}
+
+func TestParseDoorbellRingData(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want *DoorbellRingData
+	}{
+		{
+			name: "full payload",
+			data: map[string]interface{}{"request_id": "req-1", "connected_uah_id": "hub-1", "agora_channel": "ch-1", "room_id": "PR-1"},
+			want: &DoorbellRingData{RequestID: "req-1", ConnectedUAHID: "hub-1", AgoraChannel: "ch-1", RoomID: "PR-1"},
+		},
+		{
+			name: "channel and room only",
+			data: map[string]interface{}{"connected_uah_id": "hub-1", "agora_channel": "ch-1", "room_id": "PR-1"},
+			want: &DoorbellRingData{ConnectedUAHID: "hub-1", AgoraChannel: "ch-1", RoomID: "PR-1"},
+		},
+		{
+			name: "room only",
+			data: map[string]interface{}{"connected_uah_id": "hub-1", "room_id": "PR-1"},
+			want: &DoorbellRingData{ConnectedUAHID: "hub-1", RoomID: "PR-1"},
+		},
+		{
+			name: "no call identifiers",
+			data: map[string]interface{}{"connected_uah_id": "hub-1", "device_id": "reader-1"},
+			want: nil,
+		},
+		{
+			name: "no data",
+			data: nil,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		got := ParseDoorbellRingData(EventPacket{Event: EventDoorbellRing, Data: tt.data})
+		if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("%s: ParseDoorbellRingData = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReconnectLogsInOnlyWhenSessionRejected(t *testing.T) {
+	var logins atomic.Int32
+	var sessionValid atomic.Bool
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/auth/login":
+			logins.Add(1)
+			sessionValid.Store(true)
+			http.SetCookie(w, &http.Cookie{Name: "TOKEN", Value: "session"})
+		case strings.HasSuffix(r.URL.Path, "/ws/notification"):
+			if !sessionValid.Load() {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewClientWithCredentials(server.URL, []Credential{{Username: "user", Password: "pass"}}, false)
+
+	// The session is still valid: the WebSocket reconnects without a login
+	sessionValid.Store(true)
+	e := NewEventListener(client)
+	if err := e.reconnect(); err != nil {
+		t.Fatalf("reconnect with a valid session: %v", err)
+	}
+	e.Stop()
+	if n := logins.Load(); n != 0 {
+		t.Errorf("logins = %d, want none while the session is valid", n)
+	}
+
+	// The session expired: the handshake is rejected, so it logs in once
+	sessionValid.Store(false)
+	e = NewEventListener(client)
+	if err := e.reconnect(); err != nil {
+		t.Fatalf("reconnect with an expired session: %v", err)
+	}
+	e.Stop()
+	if n := logins.Load(); n != 1 {
+		t.Errorf("logins = %d, want 1 after the handshake was rejected", n)
+	}
+}
+
+func TestNoReconnectClosesLost(t *testing.T) {
+	var upgrades atomic.Int32
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		// The first connection drops right away, later ones stay open
+		if upgrades.Add(1) == 1 {
+			conn.Close()
+			return
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := NewClientWithCredentials(server.URL, nil, false)
+
+	e := NewEventListener(client)
+	e.SetReconnect(false)
+	if err := e.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	select {
+	case <-e.Lost():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Lost not closed after the connection dropped")
+	}
+	e.Stop()
+
+	// Stopping isn't a lost connection
+	e = NewEventListener(client)
+	e.SetReconnect(false)
+	if err := e.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	e.Stop()
+	select {
+	case <-e.Lost():
+		t.Error("Lost closed by Stop")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestParseTimestampKeepsMilliseconds(t *testing.T) {
+	want := time.UnixMilli(1760445296789)
+	for _, value := range []any{1760445296.789, 1760445296789.0, "1760445296.789", "2025-10-14T12:34:56.789Z"} {
+		got, ok := parseTimestamp(value)
+		if !ok || !got.Equal(want) {
+			t.Errorf("parseTimestamp(%v) = %v, %v; want %v", value, got, ok, want)
+		}
+	}
+
+	var event EventPacket
+	if err := json.Unmarshal([]byte(`{"event":"access.logs.add","timestamp":1760445296.789}`), &event); err != nil {
+		t.Fatal(err)
+	}
+	if !event.Timestamp.Equal(want) {
+		t.Errorf("event timestamp = %v, want %v", event.Timestamp, want)
+	}
+}
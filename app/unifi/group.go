@@ -0,0 +1,59 @@
+package unifi
+
+import (
+	"strings"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// SetDoorGroups sets the named groups of doors for group commands. Members
+// are door names or IDs, resolved like FindDoor when the group is used.
+func (c *Controller) SetDoorGroups(groups map[string][]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.doorGroups = groups
+}
+
+// GroupDoors resolves the doors of a group; the name matches
+// case-insensitively. Members that don't resolve to a door are returned as
+// failed results, so the remaining doors can still be operated on. A door
+// listed twice, e.g. by name and by ID, is returned once.
+func (c *Controller) GroupDoors(name string) ([]*Door, []DoorResult, error) {
+	members, ok := c.groupMembers(name)
+	if !ok {
+		return nil, nil, ErrUnknownGroup
+	}
+
+	var doors []*Door
+	var unknown []DoorResult
+	seen := make(map[string]bool)
+	for _, member := range members {
+		door := c.FindDoor(member)
+		if door == nil {
+			logger.Warn("Unknown door in group", "group", name, "door", member)
+			unknown = append(unknown, DoorResult{Door: member, Error: "unknown door"})
+			continue
+		}
+		if seen[door.Key] {
+			continue
+		}
+		seen[door.Key] = true
+		doors = append(doors, door)
+	}
+	return doors, unknown, nil
+}
+
+// groupMembers returns the configured members of a group
+func (c *Controller) groupMembers(name string) ([]string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if members, ok := c.doorGroups[name]; ok {
+		return members, true
+	}
+	for group, members := range c.doorGroups {
+		if strings.EqualFold(group, name) {
+			return members, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,71 @@
+package unifi
+
+import (
+	"time"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// Default time a door may stay open before it is reported as held open
+const defaultHeldOpenThreshold = 5 * time.Minute
+
+// SetHeldOpenThreshold sets how long a door may stay open before it is
+// reported as held open
+func (c *Controller) SetHeldOpenThreshold(threshold time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if threshold > 0 {
+		c.heldOpenThreshold = threshold
+	}
+}
+
+// trackHeldOpen starts the held-open timer when a door opens and cancels it
+// when the door closes. Must be called with c.mu held.
+func (c *Controller) trackHeldOpen(door *Door) {
+	if timer := c.heldOpenTimers[door.Key]; timer != nil {
+		timer.Stop()
+		delete(c.heldOpenTimers, door.Key)
+	}
+
+	if door.DoorStatus != "open" {
+		door.OpenedAt = time.Time{}
+		if door.HeldOpen {
+			door.HeldOpen = false
+			logger.Info("Held-open door closed", "door", door.Name)
+			// Fired outside of the caller's lock
+			go c.fireHeldOpen(door)
+		}
+		return
+	}
+
+	key := door.Key
+	openedAt := time.Now()
+	door.OpenedAt = openedAt
+	c.heldOpenTimers[key] = time.AfterFunc(c.heldOpenThreshold, func() {
+		c.heldOpenExpired(key, openedAt)
+	})
+}
+
+// heldOpenExpired reports a door held open once the threshold has passed
+// and the door hasn't closed in the meantime
+func (c *Controller) heldOpenExpired(key string, openedAt time.Time) {
+	c.mu.Lock()
+	door := c.doors[key]
+	if door == nil || door.DoorStatus != "open" || !door.OpenedAt.Equal(openedAt) || door.HeldOpen {
+		c.mu.Unlock()
+		return
+	}
+	door.HeldOpen = true
+	delete(c.heldOpenTimers, key)
+	c.mu.Unlock()
+
+	logger.Warn("Door held open", "door", door.Name, "since", openedAt.Format(time.RFC3339))
+	c.fireHeldOpen(door)
+}
+
+// fireHeldOpen invokes the OnDoorHeldOpen callback
+func (c *Controller) fireHeldOpen(door *Door) {
+	if c.OnDoorHeldOpen != nil {
+		c.OnDoorHeldOpen(door)
+	}
+}
@@ -0,0 +1,42 @@
+package unifi
+
+import (
+	"time"
+)
+
+// How a doorbell call ended
+const (
+	RingEndCancel  = "cancel"  // the controller cancelled the call, e.g. the visitor left or it was answered elsewhere
+	RingEndDismiss = "dismiss" // dismissed by the gateway
+	RingEndAnswer  = "answer"  // answered by the gateway
+	RingEndTimeout = "timeout" // still ringing after the ring timeout, the cancel was missed
+)
+
+// DoorbellRecord is a completed doorbell call, kept after the call state is
+// cleared
+type DoorbellRecord struct {
+	RequestID     string
+	DeviceID      string // Device that started the call
+	RoomID        string
+	SelfTriggered bool
+	StartedAt     time.Time
+	EndedAt       time.Time
+	EndedBy       string // RingEndCancel, RingEndDismiss, ...
+}
+
+// recordLastRing keeps the call of a ringing door as its LastRing before the
+// call is cleared. Must be called with c.mu held.
+func (c *Controller) recordLastRing(door *Door, endedBy string, now time.Time) {
+	if !door.DoorbellRinging {
+		return
+	}
+	door.LastRing = &DoorbellRecord{
+		RequestID:     door.DoorbellRequestID,
+		DeviceID:      door.DoorbellDeviceID,
+		RoomID:        door.DoorbellRoomID,
+		SelfTriggered: door.SelfTriggeredRing,
+		StartedAt:     door.RingStartedAt,
+		EndedAt:       now,
+		EndedBy:       endedBy,
+	}
+}
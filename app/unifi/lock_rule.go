@@ -0,0 +1,148 @@
+package unifi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// Lock rule types reported by the controller
+const (
+	LockRuleSchedule   = "schedule"    // door follows its unlock schedule and is inside a window
+	LockRuleKeepUnlock = "keep_unlock" // kept unlocked until changed
+	LockRuleKeepLock   = "keep_lock"   // kept locked until changed
+	LockRuleCustom     = "custom"      // unlocked until a custom end time
+	LockRuleLockEarly  = "lock_early"  // schedule window ended early
+)
+
+// LockRule is the active lock rule of a door
+type LockRule struct {
+	Type      string `json:"type"`
+	EndedTime int64  `json:"ended_time"` // Unix seconds; 0 when open-ended
+}
+
+// GetDoorLockRule returns the active lock rule of a door (location ID)
+func (c *Client) GetDoorLockRule(locationID string) (*LockRule, error) {
+	data, err := c.developerGet(fmt.Sprintf("/doors/%s/lock_rule", locationID))
+	if err != nil {
+		return nil, fmt.Errorf("lock rule request failed: %w", err)
+	}
+
+	var resp struct {
+		Data LockRule `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse lock rule response: %w", err)
+	}
+	return &resp.Data, nil
+}
+
+// getDeveloperAPIURL constructs the URL of the developer API (v1) on the proxy
+func (c *Client) getDeveloperAPIURL(path string) string {
+	if c.site == "" {
+		return fmt.Sprintf("%s/proxy/access/api/v1/developer%s", c.host, path)
+	}
+	return fmt.Sprintf("%s/proxy/access/api/v1/developer/s/%s%s", c.host, url.PathEscape(c.site), path)
+}
+
+// developerGet performs a GET against the developer API. It requires the API
+// token; the request isn't sent without one.
+func (c *Client) developerGet(path string) ([]byte, error) {
+	if c.authorizationHeader() == "" {
+		return nil, ErrDeveloperAPIToken
+	}
+	return c.get(c.context(), c.getDeveloperAPIURL(path))
+}
+
+// scheduledUnlocked reports whether the rule keeps the door unlocked by
+// schedule at the given (controller) time
+func (r *LockRule) scheduledUnlocked(now time.Time) bool {
+	if r == nil || r.Type != LockRuleSchedule {
+		return false
+	}
+	return r.EndedTime == 0 || now.Before(time.Unix(r.EndedTime, 0))
+}
+
+// refreshLockRule fetches the lock rule of a door and recomputes whether it is
+// scheduled-unlocked. OnScheduleChange fires when that changes.
+func (c *Controller) refreshLockRule(door *Door) {
+	if door.Device.Door == nil {
+		return
+	}
+
+	rule, err := c.api.GetDoorLockRule(door.Device.Door.UniqueID)
+	if errors.Is(err, ErrDeveloperAPIToken) {
+		return // warned once by StartLockRuleMonitor
+	}
+	if err != nil {
+		// Refreshed every minute: warn on the first failure only
+		if c.lockRuleFailing.Swap(true) {
+			logger.Debug("Failed to get door lock rule", "door", door.Name, "err", err)
+		} else {
+			logger.Warn("Failed to get door lock rule, scheduled_unlocked follows the schedule windows", "door", door.Name, "err", err)
+		}
+		return
+	}
+	if c.lockRuleFailing.Swap(false) {
+		logger.Info("Door lock rules available again", "door", door.Name)
+	}
+	c.applyLockRule(door, rule)
+}
+
+// applyLockRule stores a lock rule and fires OnScheduleChange if the
+// scheduled-unlocked state changed
+func (c *Controller) applyLockRule(door *Door, rule *LockRule) {
+	scheduled := rule.scheduledUnlocked(c.client.ControllerTime())
+
+	c.mu.Lock()
+	changed := door.ScheduledUnlocked != scheduled || door.LockRule != rule.Type
+	door.LockRule = rule.Type
+	door.ScheduledUnlocked = scheduled
+	door.LockRuleEndsAt = time.Time{}
+	if rule.EndedTime > 0 {
+		door.LockRuleEndsAt = time.Unix(rule.EndedTime, 0)
+	}
+	c.mu.Unlock()
+
+	if changed {
+		logger.Info("Door lock rule", "door", door.Name, "rule", rule.Type, "scheduled_unlocked", scheduled)
+		if c.OnScheduleChange != nil {
+			c.OnScheduleChange(door)
+		}
+	}
+}
+
+// RefreshLockRules refreshes the lock rule of every door
+func (c *Controller) RefreshLockRules() {
+	for _, door := range c.GetDoors() {
+		c.refreshLockRule(door)
+	}
+}
+
+// StartLockRuleMonitor refreshes lock rules and unlock schedules now and then
+// periodically, so scheduled_unlocked follows schedule windows opening and
+// closing, until the controller is disconnected. Both are read from the
+// developer API, so nothing is refreshed without an API token.
+func (c *Controller) StartLockRuleMonitor(interval time.Duration) {
+	if c.client.authorizationHeader() == "" {
+		logger.Warn("Lock rules and unlock schedules need an apiToken for the developer API, scheduled_unlocked is not tracked")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			c.RefreshLockRules()
+			c.RefreshSchedules()
+			select {
+			case <-c.client.context().Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
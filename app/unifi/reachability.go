@@ -0,0 +1,70 @@
+package unifi
+
+import (
+	"errors"
+	"time"
+)
+
+// Reachability states reported by CheckReachability
+const (
+	ReachabilityOK          = "ok"
+	ReachabilityAuthFailed  = "auth_failed" // controller answered but rejected the session
+	ReachabilityHTTPError   = "http_error"  // controller answered with another error status
+	ReachabilityUnreachable = "unreachable" // no HTTP response (DNS, TCP, TLS, timeout)
+)
+
+// Reachability is the result of a REST API probe. It is independent of the
+// WebSocket state: either channel can fail while the other still works.
+type Reachability struct {
+	Reachable  bool      `json:"reachable"`
+	Status     string    `json:"status"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	LatencyMs  int64     `json:"latency_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// Ping performs a cheap authenticated GET against the controller. With an
+// API token there is no UniFi OS session, so the developer API is probed
+// instead.
+func (c *Client) Ping() error {
+	if c.authorizationHeader() != "" {
+		_, err := c.developerGet("/doors")
+		return err
+	}
+	_, err := c.get(c.context(), c.host+"/api/users/self")
+	return err
+}
+
+// CheckReachability probes the controller's REST API and classifies the result
+func (c *Controller) CheckReachability() Reachability {
+	start := time.Now()
+	err := c.api.Ping()
+
+	result := Reachability{
+		Reachable: err == nil,
+		Status:    ReachabilityOK,
+		LatencyMs: time.Since(start).Milliseconds(),
+		CheckedAt: start,
+	}
+	if err == nil {
+		return result
+	}
+
+	result.Error = err.Error()
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.IsAuth():
+		// The controller is up, only the session is not
+		result.Reachable = true
+		result.Status = ReachabilityAuthFailed
+		result.StatusCode = apiErr.StatusCode
+	case errors.As(err, &apiErr):
+		result.Reachable = true
+		result.Status = ReachabilityHTTPError
+		result.StatusCode = apiErr.StatusCode
+	default:
+		result.Status = ReachabilityUnreachable
+	}
+	return result
+}
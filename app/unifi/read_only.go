@@ -0,0 +1,27 @@
+package unifi
+
+import "strings"
+
+// SetReadOnlyDoors sets the doors, by name or ID, whose state is published
+// but that must not be unlocked or locked by commands. Names are compared
+// case-insensitively.
+func (c *Controller) SetReadOnlyDoors(doors []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readOnlyDoors = doors
+}
+
+// IsReadOnly reports whether commands that unlock or lock a door are rejected
+func (c *Controller) IsReadOnly(door *Door) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	keys := []string{door.ID, door.Name, door.TopicName(), SanitizeName(door.TopicName())}
+	for _, name := range c.readOnlyDoors {
+		for _, key := range keys {
+			if strings.EqualFold(strings.TrimSpace(name), key) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package unifi
+
+import (
+	"errors"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// Refresh bootstraps again, e.g. to pick up a door added in the UniFi console,
+// and fires OnRefresh so the doors are republished. Concurrent refreshes run
+// one after the other. Like Connect, it returns ErrNoDoors when the controller
+// has no doors.
+func (c *Controller) Refresh() error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	logger.Info("Refreshing doors from the controller")
+	err := c.bootstrap()
+	if err != nil && !errors.Is(err, ErrNoDoors) {
+		return err
+	}
+
+	if c.OnRefresh != nil {
+		c.OnRefresh()
+	}
+	return err
+}
@@ -0,0 +1,24 @@
+package unifi
+
+import "context"
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// newRequestID returns a short random ID correlating the log lines of one
+// operation, e.g. an unlock and the API calls it makes
+func newRequestID() string {
+	return generateRandomString(8)
+}
+
+// withRequestID returns a copy of ctx carrying a request ID. API calls made
+// with the context log it instead of generating their own.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFromContext returns the request ID of ctx, or ""
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,60 @@
+package unifi
+
+import (
+	"time"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// Default time a doorbell call may ring before it is cleared without a cancel
+const defaultRingTimeout = 60 * time.Second
+
+// SetRingTimeout sets how long a doorbell call may ring before it is cleared,
+// in case the cancel event was missed
+func (c *Controller) SetRingTimeout(timeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if timeout > 0 {
+		c.ringTimeout = timeout
+	}
+}
+
+// startRingTimer starts the ring timeout of a ringing door, replacing the one
+// of a previous call. Must be called with c.mu held.
+func (c *Controller) startRingTimer(door *Door) {
+	c.stopRingTimer(door)
+
+	key := door.Key
+	requestID := door.DoorbellRequestID
+	c.ringTimers[key] = time.AfterFunc(c.ringTimeout, func() {
+		c.ringTimeoutExpired(key, requestID)
+	})
+}
+
+// stopRingTimer cancels the ring timeout of a door. Must be called with c.mu
+// held.
+func (c *Controller) stopRingTimer(door *Door) {
+	if timer := c.ringTimers[door.Key]; timer != nil {
+		timer.Stop()
+		delete(c.ringTimers, door.Key)
+	}
+}
+
+// ringTimeoutExpired clears a call that is still ringing when its timeout has
+// passed, as if it had been cancelled
+func (c *Controller) ringTimeoutExpired(key, requestID string) {
+	c.mu.Lock()
+	door := c.doors[key]
+	if door == nil || !door.DoorbellRinging || door.DoorbellRequestID != requestID {
+		c.mu.Unlock()
+		return
+	}
+	c.clearDoorbellCall(door, RingEndTimeout)
+	timeout := c.ringTimeout
+	c.mu.Unlock()
+
+	logger.Warn("Doorbell call timed out without a cancel, clearing it", "door", door.Name, "request_id", requestID, "timeout", timeout)
+	if c.OnDoorbellCancel != nil {
+		c.OnDoorbellCancel(door)
+	}
+}
@@ -0,0 +1,196 @@
+package unifi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// DoorSchedule is an unlock schedule of the controller with its weekly
+// time windows
+type DoorSchedule struct {
+	ID        string                      `json:"id"`
+	Name      string                      `json:"name"`
+	Weekly    map[string][]ScheduleWindow `json:"weekly"`    // Windows by lower-case weekday, e.g. "monday"
+	Resources []ScheduleResource          `json:"resources"` // Doors the schedule applies to
+}
+
+// ScheduleWindow is a time window of a day, as "HH:MM:SS" in the
+// controller's time zone
+type ScheduleWindow struct {
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+}
+
+// ScheduleResource is a door (or other resource) a schedule applies to
+type ScheduleResource struct {
+	ID   string `json:"id"`
+	Type string `json:"type"` // "door" for a door (location ID)
+}
+
+// GetDoorSchedules returns the unlock schedules of the controller
+func (c *Client) GetDoorSchedules() ([]DoorSchedule, error) {
+	data, err := c.developerGet("/door_policies/schedules")
+	if err != nil {
+		return nil, fmt.Errorf("schedules request failed: %w", err)
+	}
+
+	var resp struct {
+		Data []DoorSchedule `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse schedules response: %w", err)
+	}
+	return resp.Data, nil
+}
+
+// appliesTo reports whether the schedule lists the door with the location ID
+func (s *DoorSchedule) appliesTo(locationID string) bool {
+	for _, resource := range s.Resources {
+		if resource.Type == "door" && resource.ID == locationID {
+			return true
+		}
+	}
+	return false
+}
+
+// activeUntil returns the end of the window that contains now, if any. A
+// window ending before it starts (e.g. 22:00-06:00) runs past midnight into
+// the next day.
+func (s *DoorSchedule) activeUntil(now time.Time) (time.Time, bool) {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	since := now.Sub(midnight)
+	for _, window := range s.windows(now.Weekday()) {
+		if window.start <= window.end {
+			if since >= window.start && since <= window.end {
+				return midnight.Add(window.end), true
+			}
+		} else if since >= window.start {
+			return midnight.AddDate(0, 0, 1).Add(window.end), true
+		}
+	}
+
+	// Windows of the previous day that run past midnight
+	for _, window := range s.windows((now.Weekday() + 6) % 7) {
+		if window.start > window.end && since <= window.end {
+			return midnight.Add(window.end), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// clockWindow is a parsed schedule window as times since midnight
+type clockWindow struct {
+	start, end time.Duration
+}
+
+// windows returns the parsed windows of a weekday, skipping malformed ones
+func (s *DoorSchedule) windows(day time.Weekday) []clockWindow {
+	var windows []clockWindow
+	for _, window := range s.Weekly[strings.ToLower(day.String())] {
+		start, err1 := parseClock(window.StartTime)
+		end, err2 := parseClock(window.EndTime)
+		if err1 != nil || err2 != nil {
+			logger.Debug("Ignoring malformed schedule window", "schedule", s.Name, "start", window.StartTime, "end", window.EndTime)
+			continue
+		}
+		windows = append(windows, clockWindow{start: start, end: end})
+	}
+	return windows
+}
+
+// parseClock parses "HH:MM:SS" (or "HH:MM") into the time since midnight
+func parseClock(s string) (time.Duration, error) {
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time of day %q", s)
+}
+
+// SetTimeZone sets the controller's time zone, which schedule windows are
+// given in. Without one they are evaluated in the gateway's zone.
+func (c *Controller) SetTimeZone(loc *time.Location) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timeZone = loc
+}
+
+// scheduleTime returns t in the zone of the schedule windows
+func (c *Controller) scheduleTime(t time.Time) time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.timeZone == nil {
+		return t
+	}
+	return t.In(c.timeZone)
+}
+
+// RefreshSchedules fetches the unlock schedules and sets the active schedule
+// of every door. OnScheduleChange fires for doors whose schedule changed.
+func (c *Controller) RefreshSchedules() {
+	schedules, err := c.api.GetDoorSchedules()
+	if errors.Is(err, ErrDeveloperAPIToken) {
+		return // warned once by StartLockRuleMonitor
+	}
+	if err != nil {
+		// Refreshed every minute: warn on the first failure only
+		if c.schedulesFailing.Swap(true) {
+			logger.Debug("Failed to get door schedules", "err", err)
+		} else {
+			logger.Warn("Failed to get door schedules, schedule names are not updated", "err", err)
+		}
+		return
+	}
+	if c.schedulesFailing.Swap(false) {
+		logger.Info("Door schedules available again")
+	}
+	now := c.scheduleTime(c.client.ControllerTime())
+	for _, door := range c.GetDoors() {
+		c.applySchedules(door, schedules, now)
+	}
+}
+
+// applySchedules sets the schedule of the door whose window contains now.
+// ScheduledUnlocked follows the lock rule when the controller reported one,
+// and the schedule windows otherwise.
+func (c *Controller) applySchedules(door *Door, schedules []DoorSchedule, now time.Time) {
+	if door.Device.Door == nil {
+		return
+	}
+
+	var name string
+	var until time.Time
+	for i := range schedules {
+		if !schedules[i].appliesTo(door.Device.Door.UniqueID) {
+			continue
+		}
+		if end, ok := schedules[i].activeUntil(now); ok {
+			name, until = schedules[i].Name, end
+			break
+		}
+	}
+
+	c.mu.Lock()
+	changed := door.ScheduleName != name
+	door.ScheduleName = name
+	door.ScheduleEndsAt = until
+	if door.LockRule == "" {
+		changed = changed || door.ScheduledUnlocked != (name != "")
+		door.ScheduledUnlocked = name != ""
+	}
+	scheduled := door.ScheduledUnlocked
+	c.mu.Unlock()
+
+	if changed {
+		logger.Info("Door schedule", "door", door.Name, "schedule", name, "scheduled_unlocked", scheduled)
+		if c.OnScheduleChange != nil {
+			c.OnScheduleChange(door)
+		}
+	}
+}
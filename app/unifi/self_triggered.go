@@ -0,0 +1,39 @@
+package unifi
+
+import "time"
+
+// How long a request ID of a gateway-triggered ring is remembered
+const selfTriggeredTTL = 2 * time.Minute
+
+// rememberSelfTriggered records the request ID of a ring sent by the gateway
+func (c *Controller) rememberSelfTriggered(requestID string) {
+	c.selfTriggeredMu.Lock()
+	defer c.selfTriggeredMu.Unlock()
+
+	now := time.Now()
+	for id, at := range c.selfTriggered {
+		if now.Sub(at) > selfTriggeredTTL {
+			delete(c.selfTriggered, id)
+		}
+	}
+	c.selfTriggered[requestID] = now
+}
+
+// isSelfTriggered reports whether a ring event is the echo of a ring sent by
+// the gateway
+func (c *Controller) isSelfTriggered(requestID string) bool {
+	c.selfTriggeredMu.Lock()
+	defer c.selfTriggeredMu.Unlock()
+
+	at, ok := c.selfTriggered[requestID]
+	return ok && time.Since(at) <= selfTriggeredTTL
+}
+
+// SetSuppressSelfTriggeredRings controls whether rings triggered by the
+// gateway itself are reported through OnDoorbellRing. They are always marked
+// with Door.SelfTriggeredRing.
+func (c *Controller) SetSuppressSelfTriggeredRings(suppress bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.suppressSelfTriggered = suppress
+}
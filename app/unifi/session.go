@@ -0,0 +1,102 @@
+package unifi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// DefaultSessionRefreshInterval is how often the session is renewed before the
+// controller expires the session cookie and CSRF token
+const DefaultSessionRefreshInterval = 12 * time.Hour
+
+// refreshSession logs in again unless another goroutine already did so after
+// since. Concurrent callers wait for a single re-login instead of each
+// starting their own.
+func (c *Client) refreshSession(since time.Time) error {
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+
+	c.mu.RLock()
+	lastLogin := c.lastLogin
+	c.mu.RUnlock()
+	if lastLogin.After(since) {
+		return nil
+	}
+
+	return c.Login()
+}
+
+// StartSessionRefresh re-runs the login every interval so the session never
+// expires while the gateway is running. Stopped by StopSessionRefresh.
+func (c *Client) StartSessionRefresh(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultSessionRefreshInterval
+	}
+
+	c.mu.Lock()
+	if c.refreshStop != nil {
+		c.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	c.refreshStop = stop
+	c.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				logger.Debug("Refreshing controller session", "interval", interval)
+				if err := c.refreshSession(time.Now()); err != nil {
+					logger.Error("Failed to refresh controller session", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+// StopSessionRefresh stops the background session refresh
+func (c *Client) StopSessionRefresh() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.refreshStop != nil {
+		close(c.refreshStop)
+		c.refreshStop = nil
+	}
+}
+
+// retryUnauthorized reports whether a failed request should be sent again
+// after logging in: the session expired (401), or the controller rotated the
+// CSRF token and rejects the one we have (403). Requests authenticated with an
+// API token are not, as a new login doesn't change the token.
+func (c *Client) retryUnauthorized(req *http.Request, err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.StatusCode != http.StatusUnauthorized && !apiErr.isCSRFRejection() {
+		return false
+	}
+	if c.authorizationHeader() != "" {
+		return false
+	}
+	// The body was consumed by the first attempt and can only be resent
+	// when the request knows how to recreate it
+	return req.Body == nil || req.GetBody != nil
+}
+
+// isCSRFRejection reports whether the controller rejected the request's CSRF
+// token, as opposed to a 403 for missing permissions
+func (e *APIError) isCSRFRejection() bool {
+	return e.StatusCode == http.StatusForbidden && strings.Contains(strings.ToLower(e.Body), "csrf")
+}
@@ -0,0 +1,58 @@
+package unifi
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// Event timestamp sources
+const (
+	TimestampSourceEvent    = "event"    // prefer the time embedded in the event (default)
+	TimestampSourceReceived = "received" // always use the time the gateway received the event
+)
+
+// Keys inside event data that may carry the time the event happened
+var eventTimeKeys = []string{"timestamp", "event_time", "create_time", "time"}
+
+// eventTimestamp returns the time embedded in an event: the top-level
+// timestamp, or one of the well-known keys in its data.
+func eventTimestamp(event EventPacket) (time.Time, bool) {
+	if !event.Timestamp.IsZero() {
+		return event.Timestamp, true
+	}
+	for _, key := range eventTimeKeys {
+		if t, ok := parseTimestamp(event.Data[key]); ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseTimestamp parses Unix seconds, Unix milliseconds or RFC 3339 values
+func parseTimestamp(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case float64:
+		return unixTimestamp(v)
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, true
+		}
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return unixTimestamp(f)
+		}
+	}
+	return time.Time{}, false
+}
+
+// unixTimestamp interprets n as seconds or, when too large for that,
+// milliseconds. Fractional seconds are kept to the millisecond.
+func unixTimestamp(n float64) (time.Time, bool) {
+	if n <= 0 {
+		return time.Time{}, false
+	}
+	if n > 1e11 { // beyond year 5000 in seconds: must be milliseconds
+		return time.UnixMilli(int64(math.Round(n))), true
+	}
+	return time.UnixMilli(int64(math.Round(n * 1000))), true
+}
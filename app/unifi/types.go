@@ -8,9 +8,9 @@ import (
 
 // TopologyResponse represents the raw response from topology4 API
 type TopologyResponse struct {
-	Code  int               `json:"code"`
-	CodeS string            `json:"codeS"`
-	Data  []BuildingConfig  `json:"data"`
+	Code  int              `json:"code"`
+	CodeS string           `json:"codeS"`
+	Data  []BuildingConfig `json:"data"`
 }
 
 // BuildingConfig represents a building in the topology
@@ -23,11 +23,11 @@ type BuildingConfig struct {
 
 // BootstrapResponse represents the parsed bootstrap data
 type BootstrapResponse struct {
-	Version string           `json:"version"`
-	Host    ControllerHost   `json:"host"`
-	Devices []DeviceConfig   `json:"devices"`
-	Doors   []DoorConfig     `json:"full_doors"`
-	Viewers []DeviceConfig   `json:"viewers"` // Intercom Viewer devices
+	Version string         `json:"version"`
+	Host    ControllerHost `json:"host"`
+	Devices []DeviceConfig `json:"devices"`
+	Doors   []DoorConfig   `json:"full_doors"`
+	Viewers []DeviceConfig `json:"viewers"` // Intercom Viewer devices
 }
 
 // ControllerHost represents the UniFi Access controller information
@@ -44,6 +44,7 @@ type DeviceConfig struct {
 	Name           string         `json:"name"`
 	DeviceType     string         `json:"device_type"` // UAH, UGT, UA-ULTRA, UA-Hub-Door-Mini, UA-Int-Viewer
 	DisplayModel   string         `json:"display_model"`
+	Firmware       string         `json:"firmware,omitempty"`
 	MAC            string         `json:"mac"`
 	IP             string         `json:"ip,omitempty"`
 	IsOnline       bool           `json:"is_online"`
@@ -77,22 +78,26 @@ type Extension struct {
 
 // DoorReference represents a reference to a door
 type DoorReference struct {
-	UniqueID string `json:"unique_id"`
-	Name     string `json:"name"`
+	UniqueID     string `json:"unique_id"`
+	Name         string `json:"name"`
+	BuildingID   string `json:"building_id,omitempty"`
+	BuildingName string `json:"building_name,omitempty"`
+	FloorID      string `json:"floor_id,omitempty"`
+	FloorName    string `json:"floor_name,omitempty"`
 }
 
 // DoorConfig represents a door configuration
 type DoorConfig struct {
 	UniqueID            string `json:"unique_id"`
 	Name                string `json:"name"`
-	DoorPositionStatus  string `json:"door_position_status,omitempty"` // "open" or "close"
+	DoorPositionStatus  string `json:"door_position_status,omitempty"`   // "open" or "close"
 	DoorLockRelayStatus string `json:"door_lock_relay_status,omitempty"` // "lock" or "unlock"
 }
 
 // FloorConfig represents a floor configuration
 type FloorConfig struct {
-	UniqueID string              `json:"unique_id"`
-	Name     string              `json:"name"`
+	UniqueID string               `json:"unique_id"`
+	Name     string               `json:"name"`
 	Doors    []DoorLocationConfig `json:"doors"`
 }
 
@@ -112,7 +117,8 @@ type EventPacket struct {
 	Data          map[string]interface{} `json:"-"`
 	DataString    string                 `json:"-"`
 	Meta          *EventMeta             `json:"meta,omitempty"`
-	Timestamp     time.Time              `json:"timestamp,omitempty"`
+	Timestamp     time.Time              `json:"timestamp,omitempty"` // Event time: embedded in the event when present, otherwise ReceivedAt
+	ReceivedAt    time.Time              `json:"-"`                   // Time the gateway received the event
 }
 
 // UnmarshalJSON accepts `data` as either a JSON object or a string.
@@ -124,7 +130,7 @@ func (e *EventPacket) UnmarshalJSON(b []byte) error {
 		EventObjectID string          `json:"event_object_id,omitempty"`
 		Data          json.RawMessage `json:"data,omitempty"`
 		Meta          *EventMeta      `json:"meta,omitempty"`
-		Timestamp     time.Time       `json:"timestamp,omitempty"`
+		Timestamp     any             `json:"timestamp,omitempty"`
 	}{}
 	if err := json.Unmarshal(b, &aux); err != nil {
 		return err
@@ -132,7 +138,8 @@ func (e *EventPacket) UnmarshalJSON(b []byte) error {
 	e.Event = aux.Event
 	e.EventObjectID = aux.EventObjectID
 	e.Meta = aux.Meta
-	e.Timestamp = aux.Timestamp
+	// Controllers send seconds, milliseconds or RFC 3339 strings
+	e.Timestamp, _ = parseTimestamp(aux.Timestamp)
 
 	if len(aux.Data) == 0 {
 		return nil
@@ -153,11 +160,15 @@ type EventMeta struct {
 
 // DoorbellRingData represents doorbell ring event data
 type DoorbellRingData struct {
-	RequestID      string `json:"request_id"`
-	ConnectedUAHID string `json:"connected_uah_id"`
-	DeviceID       string `json:"device_id"`       // The actual doorbell/camera device ID
-	RoomID         string `json:"room_id"`         // Room ID for the call
+	RequestID       string `json:"request_id"`
+	ConnectedUAHID  string `json:"connected_uah_id"`
+	DeviceID        string `json:"device_id"`        // The actual doorbell/camera device ID
+	RoomID          string `json:"room_id"`          // Room ID for the call
 	DoorbellChannel string `json:"doorbell_channel"` // Doorbell channel
+
+	// Agora call channel and token a client needs to join the call ("" when not sent)
+	AgoraChannel string `json:"agora_channel"`
+	AgoraToken   string `json:"agora_token"`
 }
 
 // DoorbellCancelData represents doorbell cancel event data
@@ -186,6 +197,9 @@ const (
 	EventDoorbellRing       = "access.remote_view"
 	EventDoorbellCancel     = "access.remote_view.change"
 	EventDeviceDelete       = "access.data.device.delete"
+	EventAccessLog          = "access.logs.add"
+	EventAccessDenied       = "access.logs.insights.add" // Insights, including failed access attempts
+	EventDeviceTamper       = "access.hw.tamper"         // Hub or reader tamper switch triggered
 	EventBootstrap          = "bootstrap"
 )
 
@@ -202,15 +216,15 @@ const (
 
 // Device capabilities
 const (
-	CapabilityIsHub            = "is_hub"
-	CapabilityIsReader         = "is_reader"
-	CapabilityDoorbell         = "door_bell"
-	CapabilityFaceUnlock       = "identity_face_unlock"
-	CapabilityHandWave         = "hand_wave"
-	CapabilityMobileUnlock     = "mobile_unlock_ver2"
-	CapabilityNFC              = "nfc"
-	CapabilityPinCode          = "pin_code"
-	CapabilityQRCode           = "qr_code"
+	CapabilityIsHub        = "is_hub"
+	CapabilityIsReader     = "is_reader"
+	CapabilityDoorbell     = "door_bell"
+	CapabilityFaceUnlock   = "identity_face_unlock"
+	CapabilityHandWave     = "hand_wave"
+	CapabilityMobileUnlock = "mobile_unlock_ver2"
+	CapabilityNFC          = "nfc"
+	CapabilityPinCode      = "pin_code"
+	CapabilityQRCode       = "qr_code"
 )
 
 // HasCapability checks if a device has a specific capability
@@ -233,6 +247,29 @@ func (d *DeviceConfig) IsReader() bool {
 	return d.HasCapability(CapabilityIsReader)
 }
 
+// FirmwareVersion returns the firmware version of the device, falling back
+// to the firmware config entries some devices report instead
+func (d *DeviceConfig) FirmwareVersion() string {
+	if d.Firmware != "" {
+		return d.Firmware
+	}
+	for _, key := range []string{"firmware_version", "fw"} {
+		if value := d.GetConfigValue(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Model returns the display model of the device, e.g. "UA Hub", falling back
+// to the device type
+func (d *DeviceConfig) Model() string {
+	if d.DisplayModel != "" {
+		return d.DisplayModel
+	}
+	return d.DeviceType
+}
+
 // GetConfigValue returns the value of a config entry by key
 func (d *DeviceConfig) GetConfigValue(key string) string {
 	for _, c := range d.Configs {
@@ -245,27 +282,66 @@ func (d *DeviceConfig) GetConfigValue(key string) string {
 
 // Door represents a door with its associated device and current state
 type Door struct {
-	ID                  string
-	Name                string
-	Device              *DeviceConfig
-	LockStatus          string // "locked" or "unlocked"
-	DoorStatus          string // "open" or "closed"
-	DoorbellRinging     bool
-	DoorbellRequestID   string
-	DoorbellDeviceID    string   // Device ID from active doorbell call (cleared when call ends)
-	DoorbellRoomID      string   // Room ID for the active call
-	DoorbellChannel     string   // Doorbell channel for the active call
-	ReaderDeviceID      string   // Configured reader device ID (UA-G3, UA-G3-Pro) - set at bootstrap, never cleared
-	IsOnline            bool
-	ViewerIDs           []string // Associated Viewer device IDs for doorbell notifications
+	ID                string
+	Key               string // Map key within the controller; equals ID unless qualified
+	LocationID        string // Door (location) ID from the topology, used to unlock UGT doors
+	Name              string
+	BuildingName      string
+	FloorName         string // Floor of the door in the topology ("" when not on a floor)
+	Qualified         bool   // Door collided with another door's ID or name and is qualified with its building
+	Device            *DeviceConfig
+	Model             string // Display model of the hub, e.g. "UA Hub"
+	Firmware          string // Firmware version of the hub ("" if not reported)
+	LockStatus        string // "locked" or "unlocked"
+	DoorStatus        string // "open" or "closed"
+	HasPositionSensor bool   // The door reported a position (DPS), so DoorStatus is real
+	DoorbellRinging   bool
+	DoorbellRequestID string
+	DoorbellDeviceID  string          // Device ID from active doorbell call (cleared when call ends)
+	DoorbellRoomID    string          // Room ID for the active call
+	DoorbellChannel   string          // Doorbell channel for the active call
+	AgoraChannel      string          // Agora channel of the active call, to join it from a custom client
+	AgoraToken        string          // Agora token of the active call, if the controller sent one
+	SelfTriggeredRing bool            // Active call was triggered by the gateway (e.g. MQTT ring command)
+	RingStartedAt     time.Time       // Time the active call started (zero when idle)
+	LastRing          *DoorbellRecord // Most recent completed call (nil until one ended)
+	ReaderDeviceID    string          // Configured reader device ID (UA-G3, UA-G3-Pro) - set at bootstrap, never cleared
+	IsOnline          bool
+	ViewerIDs         []string  // Associated Viewer device IDs for doorbell notifications
+	LastUnlockAt      time.Time // Time of the last unlock transition (cleared once an entry is detected)
+	LastChangedAt     time.Time // Event time of the last lock or position change (zero until the first change)
+	CycleCount        int64     // Relay actuations, see CycleCountSource
+	CycleCountSource  string    // CycleCountSourceDevice or CycleCountSourceInternal ("" until known)
+	LockRule          string    // Active lock rule type (LockRuleSchedule, ...), "" until fetched
+	LockRuleEndsAt    time.Time // End of the active lock rule (zero when open-ended)
+	ScheduledUnlocked bool      // Door is inside a keep-unlocked schedule window
+	ScheduleName      string    // Unlock schedule whose window contains now ("" outside any window)
+	ScheduleEndsAt    time.Time // End of the active schedule window (zero outside any window)
+	BatteryLevel      int       // Battery level in percent of the door's reader (valid if HasBattery)
+	SignalStrength    int       // Signal strength (RSSI, dBm) of the door's reader (valid if HasSignal)
+	HasBattery        bool
+	HasSignal         bool
+	LastActor         string    // User who last unlocked the door (from access logs)
+	LastAccessMethod  string    // Normalized method of the last access (AccessMethodFace, ...)
+	OpenedAt          time.Time // Time the door was last opened (zero while closed)
+	HeldOpen          bool      // Door has been open longer than the held-open threshold
+	Alarm             string    // Active door alarm (AlarmForcedOpen), "" when none
+
+	UnlockDurationSeconds int       // Time the door stays unlocked after an unlock (0 if not reported)
+	ExpectedRelockAt      time.Time // Time the door is expected to lock again (zero while locked or unknown)
+
+	Capabilities []string // Capabilities of the hub and reader by name ("doorbell", "nfc", ...), set at bootstrap
 }
 
 // NewDoor creates a new Door from device and door config
 func NewDoor(device *DeviceConfig, door *DoorConfig) *Door {
 	d := &Door{
 		ID:         device.UniqueID,
+		Key:        device.UniqueID,
 		Name:       door.Name,
 		Device:     device,
+		Model:      device.Model(),
+		Firmware:   device.FirmwareVersion(),
 		IsOnline:   device.IsOnline,
 		LockStatus: "locked",
 		DoorStatus: "closed",
@@ -277,6 +353,21 @@ func NewDoor(device *DeviceConfig, door *DoorConfig) *Door {
 	if door.DoorPositionStatus == "open" {
 		d.DoorStatus = "open"
 	}
+	// Doors without a position sensor report no position at all
+	d.HasPositionSensor = door.DoorPositionStatus != ""
+	if device.Door != nil {
+		d.BuildingName = device.Door.BuildingName
+		d.FloorName = device.Door.FloorName
+	}
 
 	return d
 }
+
+// TopicName returns the name used to address the door in MQTT topics. Doors
+// that collide with another door are prefixed with their building name.
+func (d *Door) TopicName() string {
+	if d.Qualified && d.BuildingName != "" {
+		return d.BuildingName + " " + d.Name
+	}
+	return d.Name
+}
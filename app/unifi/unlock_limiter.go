@@ -0,0 +1,95 @@
+package unifi
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// Default unlock rate limit: one unlock per door every two seconds
+const (
+	defaultUnlockRateLimit    = 1
+	defaultUnlockRateInterval = 2 * time.Second
+)
+
+// ErrUnlockRateLimited is returned by the unlock methods when a door was
+// unlocked too often in a short time; nothing is sent to the controller
+var ErrUnlockRateLimited = errors.New("unlock rate limit exceeded")
+
+// unlockLimiter is a token bucket per door. Each bucket holds up to limit
+// tokens and refills at limit tokens per interval.
+type unlockLimiter struct {
+	limit    int
+	interval time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newUnlockLimiter(limit int, interval time.Duration) *unlockLimiter {
+	if limit <= 0 {
+		limit = defaultUnlockRateLimit
+	}
+	if interval <= 0 {
+		interval = defaultUnlockRateInterval
+	}
+	return &unlockLimiter{
+		limit:    limit,
+		interval: interval,
+		buckets:  make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from the bucket of a door and reports whether the
+// unlock may be sent
+func (l *unlockLimiter) allow(doorKey string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[doorKey]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(l.limit), last: now}
+		l.buckets[doorKey] = bucket
+	}
+
+	rate := float64(l.limit) / l.interval.Seconds()
+	bucket.tokens += now.Sub(bucket.last).Seconds() * rate
+	if bucket.tokens > float64(l.limit) {
+		bucket.tokens = float64(l.limit)
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// SetUnlockRateLimit limits the unlocks sent for each door to limit per
+// interval, whether they come from MQTT or the HTTP API. Zero values keep the
+// defaults.
+func (c *Controller) SetUnlockRateLimit(limit int, interval time.Duration) {
+	c.unlockLimiter = newUnlockLimiter(limit, interval)
+}
+
+// allowUnlock returns ErrUnlockRateLimited when the rate limit of a door is
+// exceeded. Dropped unlocks are logged and fire OnUnlockLimited.
+func (c *Controller) allowUnlock(door *Door) error {
+	if c.unlockLimiter.allow(door.Key, time.Now()) {
+		return nil
+	}
+	logger.Warn("Dropped unlock, rate limit exceeded", "door", door.Name,
+		"limit", c.unlockLimiter.limit, "interval", c.unlockLimiter.interval)
+	if c.OnUnlockLimited != nil {
+		c.OnUnlockLimited(door)
+	}
+	return ErrUnlockRateLimited
+}
@@ -0,0 +1,58 @@
+package unifi
+
+import (
+	"time"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// Unlock pulse sources
+const (
+	UnlockSourceGateway = "gateway" // unlocked by this gateway (MQTT, HTTP API)
+	UnlockSourceRemote  = "remote"  // remote unlock reported by the controller, e.g. from the UniFi app
+)
+
+// A remote unlock event within this time after an unlock by the gateway is
+// the controller's echo of it and no separate pulse
+const unlockEchoWindow = 5 * time.Second
+
+// UnlockPulse is a momentary unlock of a door. Unlike the lock status it is
+// reported even when the relay locks again before anyone looks.
+type UnlockPulse struct {
+	At     time.Time
+	Actor  string // User who unlocked the door, "" when unknown
+	Source string // UnlockSourceGateway or UnlockSourceRemote
+}
+
+// fireUnlockPulse invokes OnDoorUnlockPulse, skipping the echo of an unlock
+// the gateway reported itself
+func (c *Controller) fireUnlockPulse(door *Door, pulse UnlockPulse) {
+	c.mu.Lock()
+	if pulse.Source == UnlockSourceGateway {
+		c.gatewayUnlocks[door.Key] = time.Now()
+	} else if at, ok := c.gatewayUnlocks[door.Key]; ok && time.Since(at) < unlockEchoWindow {
+		c.mu.Unlock()
+		logger.Debug("Skipping unlock pulse of the gateway's own unlock", "door", door.Name)
+		return
+	}
+	c.mu.Unlock()
+
+	logger.Debug("Door unlock pulse", "door", door.Name, "source", pulse.Source, "actor", pulse.Actor)
+	if c.OnDoorUnlockPulse != nil {
+		c.OnDoorUnlockPulse(door, pulse)
+	}
+}
+
+// remoteUnlockActor returns the user of a remote unlock event, if the
+// controller sent one
+func remoteUnlockActor(event EventPacket) string {
+	if actor, ok := event.Data["actor"].(map[string]interface{}); ok {
+		if name, _ := actor["display_name"].(string); name != "" {
+			return name
+		}
+		name, _ := actor["name"].(string)
+		return name
+	}
+	name, _ := event.Data["user_name"].(string)
+	return name
+}
@@ -0,0 +1,104 @@
+package unifi
+
+import (
+	"errors"
+	"time"
+
+	"github.com/philipparndt/go-logger"
+)
+
+// Unlock token defaults
+const (
+	defaultUnlockTokenTTL    = 5 * time.Minute
+	unlockTokenLength        = 24
+	unlockTokenSweepInterval = time.Minute
+)
+
+// ErrInvalidUnlockToken is returned by UnlockWithToken for a token that is
+// unknown, expired, already used or issued for another door
+var ErrInvalidUnlockToken = errors.New("invalid or expired unlock token")
+
+// unlockToken is an issued one-time unlock token
+type unlockToken struct {
+	doorKey   string
+	expiresAt time.Time
+}
+
+// IssueUnlockToken returns a random single-use token that unlocks door until
+// ttl (5 minutes when zero) has passed. Tokens are only kept in memory, so a
+// restart invalidates them.
+func (c *Controller) IssueUnlockToken(door *Door, ttl time.Duration) (string, time.Time) {
+	if ttl <= 0 {
+		ttl = defaultUnlockTokenTTL
+	}
+	token := generateRandomString(unlockTokenLength)
+	expiresAt := time.Now().Add(ttl)
+
+	c.tokensMu.Lock()
+	c.unlockTokens[token] = unlockToken{doorKey: door.Key, expiresAt: expiresAt}
+	c.tokensMu.Unlock()
+
+	c.sweepOnce.Do(func() { go c.sweepUnlockTokens() })
+	logger.Info("Issued unlock token", "door", door.Name, "expires_at", expiresAt.Format(time.RFC3339))
+	return token, expiresAt
+}
+
+// UnlockWithToken unlocks door for seconds with a token issued for it. It
+// returns ErrInvalidUnlockToken unless the token is valid, unused and for this
+// door. The token is only used up by a successful unlock, so a failed unlock
+// can be retried with it; a token presented for another door is used up.
+func (c *Controller) UnlockWithToken(door *Door, token string, seconds int) error {
+	issued, err := c.redeemUnlockToken(door, token)
+	if err != nil {
+		return err
+	}
+	if err := c.UnlockForDuration(door, seconds); err != nil {
+		c.tokensMu.Lock()
+		c.unlockTokens[token] = issued
+		c.tokensMu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// redeemUnlockToken removes a token and returns it if it was issued for door
+// and has not expired. Removing it first keeps two concurrent commands from
+// unlocking with the same token.
+func (c *Controller) redeemUnlockToken(door *Door, token string) (unlockToken, error) {
+	c.tokensMu.Lock()
+	issued, ok := c.unlockTokens[token]
+	delete(c.unlockTokens, token)
+	c.tokensMu.Unlock()
+
+	if !ok || time.Now().After(issued.expiresAt) || issued.doorKey != door.Key {
+		logger.Warn("Rejected unlock token", "door", door.Name)
+		return unlockToken{}, ErrInvalidUnlockToken
+	}
+	return issued, nil
+}
+
+// sweepUnlockTokens drops expired tokens periodically until the controller
+// is disconnected
+func (c *Controller) sweepUnlockTokens() {
+	ticker := time.NewTicker(unlockTokenSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.client.context().Done():
+			return
+		case now := <-ticker.C:
+			c.dropExpiredUnlockTokens(now)
+		}
+	}
+}
+
+// dropExpiredUnlockTokens removes the tokens that have expired at now
+func (c *Controller) dropExpiredUnlockTokens(now time.Time) {
+	c.tokensMu.Lock()
+	defer c.tokensMu.Unlock()
+	for token, issued := range c.unlockTokens {
+		if now.After(issued.expiresAt) {
+			delete(c.unlockTokens, token)
+		}
+	}
+}